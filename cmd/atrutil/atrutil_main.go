@@ -16,6 +16,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"sort"
 
 	//"runtime"
 	"strconv"
@@ -40,6 +41,8 @@ var gPackageMode = false
 var gFindTestVal string
 var gFindTestCoverage = false
 var flagTidCsvPath string
+var flagPrereqCacheDir string
+var flagNavLayerPath string
 
 // sh /tmp/artwork-T1560.002_3-458617291/goart-T1560.002-test.bash
 var gRxUnixRedirect = regexp.MustCompile(`\d?>>?[ ]?([#{}._/\-0-9A-Za-z ]+)`)
@@ -56,7 +59,9 @@ func init() {
 	flag.StringVar(&flagPlatform, "platform", "", "optional platform specifier (linux,macos,windows)")
 	flag.StringVar(&flagGenCriteria, "gencriteria", "", "supply name of test (Ex: T1070.004) and the CSV for the criteria will be outputted")
 	flag.StringVar(&flagGenCriteriaOutPath, "outfile", "", "supply name of directory to store generated criteria in csv form (requires gencriteria flag)")
-	flag.StringVar(&flagTidCsvPath, "tidcsvpath", "", "for package mode, a CSV file with testIDs to run in first column")
+	flag.StringVar(&flagTidCsvPath, "tidcsvpath", "", "for package or prereqcache mode, a CSV file with testIDs to run in first column")
+	flag.StringVar(&flagPrereqCacheDir, "prereqcache", "", "download urls of get_prereq commands into dir, for goartrun/harness --prereqcache on offline hosts")
+	flag.StringVar(&flagNavLayerPath, "navlayer", "", "with coverage, also write ATT&CK Navigator layer of techniques with criteria to file")
 }
 
 func ToInt64(valstr string) int64 {
@@ -248,12 +253,51 @@ func FindTestCoverage() (error, float32) {
 		return errRead, 0.0
 	}
 
-	percentage := FindTestCoverageHelper(flagCriteriaPath, &atomicTests)
+	covered := map[*types.TestSpec]bool{}
+	percentage := FindTestCoverageHelper(flagCriteriaPath, &atomicTests, covered)
+
+	if len(flagNavLayerPath) > 0 {
+		layer := GetCriteriaCoverageLayer(atomicTests, covered, percentage)
+		if err := utils.SaveNavigatorLayer(filepath.FromSlash(flagNavLayerPath), layer); err != nil {
+			fmt.Println("ERROR: unable to write navigator layer", err)
+			return err, percentage
+		}
+		fmt.Println("Wrote navigator layer", flagNavLayerPath)
+	}
 
 	return nil, percentage
 }
 
-func FindTestCoverageHelper(dirPath string, atomicMap *map[string][]*types.TestSpec) float32 {
+/*
+ * GetCriteriaCoverageLayer returns navigator layer with score of each
+ * technique the percentage of its atomic tests that have criteria.
+ */
+func GetCriteriaCoverageLayer(atomicMap map[string][]*types.TestSpec, covered map[*types.TestSpec]bool, percentage float32) *types.NavigatorLayer {
+	description := fmt.Sprintf("Atomic tests with validation criteria: %3.1f %%", percentage*100.0)
+	layer := utils.NewNavigatorLayer("atomic-harness criteria "+flagPlatform, description, flagPlatform)
+
+	for tid, tests := range atomicMap {
+		num := 0
+		lines := []string{}
+		for _, test := range tests {
+			line := fmt.Sprintf("[%s] %s: ", test.TestIndex, test.TestName)
+			if covered[test] {
+				num += 1
+				line += "criteria"
+			} else {
+				line += "no criteria"
+			}
+			lines = append(lines, line)
+		}
+		if len(tests) > 0 {
+			utils.AddNavigatorTechnique(layer, tid, num*100/len(tests), strings.Join(lines, "\n"))
+		}
+	}
+	return layer
+}
+
+// covered is filled with tests that have criteria
+func FindTestCoverageHelper(dirPath string, atomicMap *map[string][]*types.TestSpec, covered map[*types.TestSpec]bool) float32 {
 	dirPath = filepath.FromSlash(dirPath)
 	allfiles, err := ioutil.ReadDir(dirPath)
 
@@ -291,7 +335,7 @@ func FindTestCoverageHelper(dirPath string, atomicMap *map[string][]*types.TestS
 			fmt.Println("Loading " + f.Name())
 		}
 
-		criteria += FindCoverage(filepath.FromSlash(dirPath+"/"+f.Name()), *atomicMap)
+		criteria += FindCoverage(filepath.FromSlash(dirPath+"/"+f.Name()), *atomicMap, covered)
 		if err != nil {
 			fmt.Println("ERROR:", err)
 			return 0.0
@@ -305,7 +349,7 @@ func FindTestCoverageHelper(dirPath string, atomicMap *map[string][]*types.TestS
 	return percentage
 }
 
-func FindCoverage(filename string, atomicMap map[string][]*types.TestSpec) int {
+func FindCoverage(filename string, atomicMap map[string][]*types.TestSpec, covered map[*types.TestSpec]bool) int {
 	platformName := utils.GetPlatformName()
 
 	if gVerbose {
@@ -348,6 +392,7 @@ func FindCoverage(filename string, atomicMap map[string][]*types.TestSpec) int {
 			for _, entry := range atomicMap[cur.Technique] {
 				if len(cur.TestGuid) > 0 && strings.HasPrefix(entry.TestGuid, cur.TestGuid) {
 					criteria += 1
+					covered[entry] = true
 					break
 				}
 
@@ -358,6 +403,7 @@ func FindCoverage(filename string, atomicMap map[string][]*types.TestSpec) int {
 
 				if cur.TestIndex > 0 && cur.TestIndex == ToUInt(entry.TestIndex) {
 					criteria += 1
+					covered[entry] = true
 					break
 				}
 
@@ -834,6 +880,102 @@ func fileSize(path string) (int64,error) {
 	return fi.Size(),nil
 }
 
+/*
+ * GetPrereqUrls returns urls in get_prereq commands of test, with default
+ * args.  Urls with args that have no default are skipped.
+ */
+func GetPrereqUrls(test *types.AtomicTest, atomicsDir string) []string {
+	args := map[string]string{}
+	for name, arg := range test.InputArugments {
+		args[name] = arg.Default
+	}
+	urls := []string{}
+	for _, dep := range test.Dependencies {
+		command := utils.InterpolateWithArgs(dep.GetPrereqCommand, atomicsDir, args)
+		for _, u := range utils.FindPrereqUrls(command) {
+			if strings.Contains(u, "#{") || utils.StringInList(u, urls) {
+				continue
+			}
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+/*
+ * FillPrereqCache downloads urls of get_prereq commands of tests for
+ * platform into cacheDir.  Tests are from tidCsvPath if set, otherwise
+ * all techniques in atomics dir.  Urls already in cache are skipped.
+ */
+func FillPrereqCache(cacheDir string, tidCsvPath string) error {
+	techniques := []string{}
+	if len(tidCsvPath) > 0 {
+		tids, err := LoadTestList(tidCsvPath)
+		if err != nil {
+			return err
+		}
+		techniques = GetTechniquesFromTids(tids)
+	} else {
+		entries, err := os.ReadDir(flagAtomicsPath)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if entry.IsDir() && strings.HasPrefix(entry.Name(), "T") {
+				techniques = append(techniques, entry.Name())
+			}
+		}
+	}
+	sort.Strings(techniques)
+
+	err := os.MkdirAll(cacheDir, 0755)
+	if err != nil {
+		return err
+	}
+	index, err := utils.LoadPrereqCacheIndex(cacheDir)
+	if err != nil {
+		return err
+	}
+
+	atomicsDir, _ := filepath.Abs(flagAtomicsPath)
+	numCached, numFetched, numFailed := 0, 0, 0
+	for _, tid := range techniques {
+		atomic, err := utils.LoadAtomicsTechniqueYaml(tid, atomicsDir)
+		if err != nil {
+			fmt.Println("ERROR:", err)
+			continue
+		}
+		for _, test := range atomic.AtomicTests {
+			if !utils.StringInList(flagPlatform, test.SupportedPlatforms) {
+				continue
+			}
+			for _, u := range GetPrereqUrls(&test, atomicsDir) {
+				if _, ok := index.Entries[u]; ok {
+					numCached += 1
+					continue
+				}
+				entry, err := utils.AddToPrereqCache(cacheDir, index, u)
+				if err != nil {
+					fmt.Println("ERROR:", tid, test.Name, err)
+					numFailed += 1
+					continue
+				}
+				numFetched += 1
+				if gVerbose {
+					fmt.Println(tid, u, entry.Size, "bytes")
+				}
+			}
+		}
+	}
+
+	err = utils.SavePrereqCacheIndex(cacheDir, index)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Prereq cache %s: %d fetched, %d already cached, %d failed, %d total\n", cacheDir, numFetched, numCached, numFailed, len(index.Entries))
+	return nil
+}
+
 // fmt.Println("Found", numMatched, "in", total, "tests for platform", flagPlatform)
 
 func main() {
@@ -855,6 +997,15 @@ func main() {
 		return
 	}
 
+	if len(flagPrereqCacheDir) > 0 {
+		err := FillPrereqCache(flagPrereqCacheDir, flagTidCsvPath)
+		if err != nil {
+			fmt.Println("ERROR:", err)
+			os.Exit(2)
+		}
+		return
+	}
+
 	if len(gFindTestVal) > 0 {
 		FindMatchingTests(strings.ToLower(gFindTestVal))
 		return
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
 )
 
 func TestStripComment(t *testing.T) {
@@ -56,3 +60,50 @@ func TestSplitPipedCmds(t *testing.T) {
 	assert.Equal(t, " grep pa ", a[1])
 	assert.Equal(t, " sort", a[2])
 }
+
+func TestGetPrereqUrls(t *testing.T) {
+	test := &types.AtomicTest{
+		InputArugments: map[string]types.InputArgument{"tool_url": {Default: "https://example.com/tool.zip"}},
+		Dependencies: []types.Dependency{
+			{GetPrereqCommand: "curl -o /tmp/tool.zip #{tool_url}"},
+			{GetPrereqCommand: "wget #{no_default}/x.sh; wget https://example.com/tool.zip"},
+		},
+	}
+	assert.Equal(t, []string{"https://example.com/tool.zip"}, GetPrereqUrls(test, "/atomics"))
+}
+
+func TestCriteriaCoverageLayer(t *testing.T) {
+	dir := t.TempDir()
+	indexDir := filepath.Join(dir, "atomics", "Indexes", "Indexes-CSV")
+	os.MkdirAll(indexDir, 0755)
+	os.WriteFile(filepath.Join(indexDir, "linux-index.csv"), []byte(`Tactic,Technique #,Technique Name,Test #,Test Name,Test GUID,Executor Name
+defense-evasion,T1070.004,File Deletion,1,Delete a single file,562d737f-2fc6-4b09-8c2a-7f8ff0828480,sh
+defense-evasion,T1070.004,File Deletion,2,Delete an entire folder,a415f17e-ce8d-4ce2-a8b4-83b674e7017e,sh
+execution,T1059.004,Unix Shell,1,Create and Execute Bash Shell Script,7e7ac3ed-f795-4fa5-b711-09d6fbe9b873,sh
+`), 0644)
+	criteriaDir := filepath.Join(dir, "criteria")
+	os.Mkdir(criteriaDir, 0755)
+	os.WriteFile(filepath.Join(criteriaDir, "linux.csv"), []byte(`T1070.004,linux,2,Delete an entire folder
+_E_,File,DELETE,path~=victim-folder
+`), 0644)
+
+	prevAtomicsPath, prevPlatform := flagAtomicsPath, flagPlatform
+	flagAtomicsPath, flagPlatform = filepath.Join(dir, "atomics"), "linux"
+	defer func() { flagAtomicsPath, flagPlatform = prevAtomicsPath, prevPlatform }()
+
+	atomicMap := map[string][]*types.TestSpec{}
+	covered := map[*types.TestSpec]bool{}
+	percentage := FindTestCoverageHelper(criteriaDir, &atomicMap, covered)
+	assert.InDelta(t, 1.0/3.0, percentage, 0.001)
+	assert.Equal(t, 1, len(covered))
+
+	layer := GetCriteriaCoverageLayer(atomicMap, covered, percentage)
+	assert.Equal(t, []string{"Linux"}, layer.Filters.Platforms)
+	byId := map[string]*types.NavigatorTechnique{}
+	for _, obj := range layer.Techniques {
+		byId[obj.TechniqueId] = obj
+	}
+	assert.Equal(t, 50, *byId["T1070.004"].Score)
+	assert.Equal(t, "[1] Delete a single file: no criteria\n[2] Delete an entire folder: criteria", byId["T1070.004"].Comment)
+	assert.Equal(t, 0, *byId["T1059.004"].Score)
+}
@@ -1,13 +1,15 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	types "github.com/secureworks/atomic-harness/pkg/types"
@@ -16,6 +18,17 @@ import (
 
 var SupportedExecutors = []string{"bash", "sh", "command_prompt", "powershell"}
 
+var ErrTimedOut = errors.New("TIMED OUT")
+var ErrCancelled = errors.New("CANCELLED")
+
+// cancelled on SIGTERM or SIGINT. The prereq and test stages are
+// aborted, but cleanup still runs, limited by the stage timeout.
+var gCancelCtx, gCancelRun = context.WithCancel(context.Background())
+
+// default timeouts if not specified in RunSpec
+const kTestStageTimeout = 30 * time.Second
+const kOtherStageTimeout = 15 * time.Second
+
 func Execute(test *types.AtomicTest, runSpec *types.RunSpec) (*types.AtomicTest, error, types.TestStatus) {
 	tid := runSpec.Technique
 	env := []string{} // TODO
@@ -58,6 +71,20 @@ func Execute(test *types.AtomicTest, runSpec *types.RunSpec) (*types.AtomicTest,
 		return nil, err, types.StatusInvalidArguments
 	}
 
+	if !runSpec.Unsafe && test.Executor != nil {
+		violation, err := checkSafety(test, args, runSpec)
+		if err != nil {
+			return nil, err, types.StatusInvalidArguments
+		}
+		if violation != nil {
+			fmt.Println("****** REFUSED BY SAFETY POLICY ******")
+			fmt.Println(" " + violation.String())
+			fmt.Println(" Use --unsafe to run anyway")
+			test.UnsafeRule = violation.Rule
+			return test, fmt.Errorf("unsafe command, rule %s", violation.Rule), types.StatusUnsafe
+		}
+	}
+
 	//var results string
 
 	stages := []string{"prereq", "test", "cleanup"}
@@ -65,8 +92,20 @@ func Execute(test *types.AtomicTest, runSpec *types.RunSpec) (*types.AtomicTest,
 		stages = []string{stage}
 	}
 
+	// residue is checked only if all stages are run. Changes made by
+	// prereq stages are not counted, since they are usually kept.
+
+	var before *types.HostSnapshot
+	checkResidue := !runSpec.SkipResidueCheck && stage == "" && runtime.GOOS != "windows"
+	residuePaths := utils.GetResiduePaths(args, runSpec.ResiduePaths)
+	residueExcludes := []string{runSpec.TempDir, runSpec.ResultsDir}
+
 	status := types.StatusUnknown
 	for _, stage = range stages {
+		if IsCancelled() && stage != "cleanup" {
+			fmt.Println("Cancelled, skipping stage", stage)
+			continue
+		}
 		switch stage {
 		case "cleanup":
 			_, err = executeStage(stage, test.Executor.CleanupCommand, test.Executor.Name, test.BaseDir, args, env, tid, test.Name, runSpec)
@@ -78,16 +117,15 @@ func Execute(test *types.AtomicTest, runSpec *types.RunSpec) (*types.AtomicTest,
 
 		case "prereq":
 			if len(test.Dependencies) != 0 {
-				executorName := test.DependencyExecutorName
-				if len(executorName) == 0 {
-					executorName = test.Executor.Name
-				}
+				executorName := getDependencyExecutorName(test)
 				if IsUnsupportedExecutor(executorName) {
 					return nil, fmt.Errorf("dependency executor %s (%s) is not supported", test.DependencyExecutorName, test.Executor.Name), types.StatusInvalidArguments
 				}
 
 				fmt.Printf("\nChecking dependencies...\n")
 
+				cache := &prereqCache{dir: runSpec.PrereqCacheDir}
+
 				for i, dep := range test.Dependencies {
 					fmt.Printf("  - %s", dep.Description)
 
@@ -98,7 +136,12 @@ func Execute(test *types.AtomicTest, runSpec *types.RunSpec) (*types.AtomicTest,
 						continue
 					}
 
-					result, err := executeStage(fmt.Sprintf("getPrereq%d", i), dep.GetPrereqCommand, executorName, test.BaseDir, args, env, tid, test.Name, runSpec)
+					getPrereqCommand := dep.GetPrereqCommand
+					if cache.dir != "" {
+						getPrereqCommand = cache.Rewrite(test, i, dep.GetPrereqCommand, args)
+					}
+
+					result, err := executeStage(fmt.Sprintf("getPrereq%d", i), getPrereqCommand, executorName, test.BaseDir, args, env, tid, test.Name, runSpec)
 
 					if err != nil {
 						if result == "" {
@@ -107,10 +150,32 @@ func Execute(test *types.AtomicTest, runSpec *types.RunSpec) (*types.AtomicTest,
 
 						fmt.Printf("   * XX - dependency check failed: %s\n", result)
 
+						if IsCancelled() {
+							break
+						}
+						cache.Stop()
 						return nil, fmt.Errorf("not all dependency checks passed"), types.StatusPreReqFail
 					}
 				}
+				// test and cleanup stages don't use the cache
+				cache.Stop()
+			}
+		case "checkprereq":
+			// only check, don't get prereqs. used by harness --preflight
+			executorName := getDependencyExecutorName(test)
+			if len(test.Dependencies) != 0 && IsUnsupportedExecutor(executorName) {
+				return nil, fmt.Errorf("dependency executor %s (%s) is not supported", test.DependencyExecutorName, test.Executor.Name), types.StatusInvalidArguments
+			}
+			status = types.StatusTestSuccess
+			for i, dep := range test.Dependencies {
+				fmt.Printf("  - %s", dep.Description)
+				result, err := executeStage(fmt.Sprintf("checkPrereq%d", i), dep.PrereqCommand, executorName, test.BaseDir, args, env, tid, test.Name, runSpec)
+				test.PrereqResults = append(test.PrereqResults, types.PrereqResult{Description: dep.Description, IsMet: err == nil, Output: result})
+				if err != nil {
+					status = types.StatusPreReqFail
+				}
 			}
+
 		case "test":
 			if test.Executor == nil {
 				return nil, fmt.Errorf("test has no executor"), types.StatusInvalidArguments
@@ -119,6 +184,9 @@ func Execute(test *types.AtomicTest, runSpec *types.RunSpec) (*types.AtomicTest,
 			if IsUnsupportedExecutor(test.Executor.Name) {
 				return nil, fmt.Errorf("executor %s is not supported", test.Executor.Name), types.StatusInvalidArguments
 			}
+			if checkResidue {
+				before = utils.TakeHostSnapshot(residuePaths, residueExcludes, runSpec.ResidueFilesOnly)
+			}
 			test.StartTime = time.Now().UnixNano()
 
 			results, err := executeStage(stage, test.Executor.Command, test.Executor.Name, test.BaseDir, args, env, tid, test.Name, runSpec)
@@ -126,7 +194,15 @@ func Execute(test *types.AtomicTest, runSpec *types.RunSpec) (*types.AtomicTest,
 			test.EndTime = time.Now().UnixNano()
 
 			errstr := ""
-			if err != nil {
+			if errors.Is(err, ErrCancelled) {
+				fmt.Println("****** EXECUTOR CANCELLED ******")
+				status = types.StatusCancelled
+				errstr = fmt.Sprint(err)
+			} else if errors.Is(err, ErrTimedOut) {
+				fmt.Println("****** EXECUTOR TIMED OUT ******")
+				status = types.StatusTestTimeout
+				errstr = fmt.Sprint(err)
+			} else if err != nil {
 				fmt.Println("****** EXECUTOR FAILED ******")
 				status = types.StatusTestFail
 				errstr = fmt.Sprint(err)
@@ -157,10 +233,181 @@ func Execute(test *types.AtomicTest, runSpec *types.RunSpec) (*types.AtomicTest,
 			return nil, nil, types.StatusRunnerFailure
 		}
 	}
+	if before != nil {
+		test.Residue = utils.DiffHostSnapshots(before, utils.TakeHostSnapshot(residuePaths, residueExcludes, runSpec.ResidueFilesOnly))
+		test.IsDirty = len(test.Residue) > 0
+		if test.IsDirty {
+			fmt.Println("****** RESIDUE AFTER CLEANUP ******")
+			for _, item := range test.Residue {
+				fmt.Println(" " + item.String())
+			}
+		} else {
+			fmt.Println("No residue found after cleanup")
+		}
+	}
+
+	if IsCancelled() {
+		test.IsCancelled = true
+		status = types.StatusCancelled
+		if test.IsCleanedUp {
+			fmt.Println("Cancelled. cleanup succeeded")
+		} else {
+			fmt.Println("Cancelled. NOT CLEANED UP")
+		}
+	}
 	return test, nil, status
 
 }
 
+// checkSafety checks commands of all stages, interpolated with args,
+// against the default policy plus runSpec.SafetyPolicyPath if set.
+func checkSafety(test *types.AtomicTest, args map[string]string, runSpec *types.RunSpec) (*types.SafetyViolation, error) {
+	policy := utils.DefaultSafetyPolicy()
+	if runSpec.SafetyPolicyPath != "" {
+		if err := utils.LoadSafetyPolicyCsv(runSpec.SafetyPolicyPath, policy); err != nil {
+			return nil, err
+		}
+	}
+	return utils.CheckStagesSafety(policy, utils.GetInterpolatedStages(test, test.BaseDir, args)), nil
+}
+
+// serves files of offline prereq cache, started on first use
+type prereqCache struct {
+	dir     string
+	index   *types.PrereqCacheIndex
+	baseUrl string
+	stop    func()
+}
+
+/*
+ * Rewrite replaces urls in get_prereq_command of dependency i that are in
+ * cache with urls of local server, and records a lookup per url in test.
+ * Command is returned unchanged if cache can't be loaded or served.
+ */
+func (c *prereqCache) Rewrite(test *types.AtomicTest, i int, command string, args map[string]string) string {
+	command = utils.InterpolateWithArgs(command, test.BaseDir, args)
+	if c.index == nil {
+		index, err := utils.LoadPrereqCacheIndex(c.dir)
+		if err != nil {
+			fmt.Println("WARNING: unable to load prereq cache", c.dir, err)
+			index = &types.PrereqCacheIndex{}
+		}
+		c.index = index
+	}
+	if len(c.index.Entries) > 0 && c.baseUrl == "" {
+		baseUrl, stop, err := utils.ServePrereqCache(c.dir)
+		if err != nil {
+			fmt.Println("WARNING: unable to serve prereq cache", err)
+			c.index.Entries = nil
+		} else {
+			c.baseUrl, c.stop = baseUrl, stop
+		}
+	}
+	command, lookups := utils.RewritePrereqUrls(command, c.index, c.baseUrl)
+	for _, lookup := range lookups {
+		lookup.Dependency = i
+		if lookup.IsHit {
+			fmt.Println("   prereq cache hit", lookup.Url)
+		} else {
+			fmt.Println("   prereq cache miss", lookup.Url)
+		}
+		test.PrereqCacheLookups = append(test.PrereqCacheLookups, lookup)
+	}
+	return command
+}
+
+func (c *prereqCache) Stop() {
+	if c.stop != nil {
+		c.stop()
+	}
+}
+
+func getDependencyExecutorName(test *types.AtomicTest) string {
+	if len(test.DependencyExecutorName) > 0 {
+		return test.DependencyExecutorName
+	}
+	return test.Executor.Name
+}
+
+func GetStageTimeout(stage string, runSpec *types.RunSpec) time.Duration {
+	if stage == "test" {
+		if runSpec.TimeoutSeconds > 0 {
+			return time.Duration(runSpec.TimeoutSeconds) * time.Second
+		}
+		return kTestStageTimeout
+	}
+	if runSpec.StageTimeoutSeconds > 0 {
+		return time.Duration(runSpec.StageTimeoutSeconds) * time.Second
+	}
+	return kOtherStageTimeout
+}
+
+// cleanup is not aborted by cancel, only by its timeout
+func GetStageContext(stage string) context.Context {
+	if stage == "cleanup" {
+		return context.Background()
+	}
+	return gCancelCtx
+}
+
+func IsCancelled() bool {
+	return gCancelCtx.Err() != nil
+}
+
+// scripts running now, killed by KillRunningScripts before exit
+var gScripts = map[*exec.Cmd]bool{}
+var gScriptsMutex sync.Mutex
+
+// kills process group of each running script, on second cancel signal
+func KillRunningScripts() {
+	gScriptsMutex.Lock()
+	defer gScriptsMutex.Unlock()
+	for cmd := range gScripts {
+		KillScript(cmd)
+	}
+}
+
+/*
+ * runScript runs cmd in its own process group, and kills the group
+ * when ctx is done, so that children of the script don't keep running
+ * (and holding the output pipe open) after a timeout or cancel.
+ */
+func runScript(ctx context.Context, cmd *exec.Cmd) ([]byte, error) {
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	SetScriptProcAttrs(cmd)
+
+	gScriptsMutex.Lock()
+	err := cmd.Start()
+	if err == nil {
+		gScripts[cmd] = true
+	}
+	gScriptsMutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			KillScript(cmd)
+		case <-done:
+		}
+	}()
+
+	err = cmd.Wait()
+	close(done)
+	gScriptsMutex.Lock()
+	delete(gScripts, cmd)
+	gScriptsMutex.Unlock()
+	if err == nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return output.Bytes(), err
+}
+
 func IsUnsupportedExecutor(executorName string) bool {
 	for _, e := range SupportedExecutors {
 		if executorName == e {
@@ -337,37 +584,15 @@ func executeStage(stage, cmds, executorName, base string, args map[string]string
 }
 
 func interpolateWithArgs(interpolatee, base string, args map[string]string, quiet bool) (string, error) {
-	interpolated := strings.TrimSpace(interpolatee)
-
-	// replace folder path if present in script
-
-	interpolated = strings.ReplaceAll(interpolated, "$PathToAtomicsFolder", base)
-	interpolated = strings.ReplaceAll(interpolated, "PathToAtomicsFolder", base)
-
-	if len(args) == 0 {
-		return interpolated, nil
-	}
-
-	if !quiet {
+	if !quiet && len(args) > 0 {
 		fmt.Println("\nInterpolating command with input arguments...")
-	}
 
-	for k, v := range args {
-		if !quiet {
+		for k, v := range args {
 			fmt.Printf("  - interpolating [#{%s}] => [%s]\n", k, v)
 		}
-
-		if AtomicsFolderRegex.MatchString(v) {
-			v = AtomicsFolderRegex.ReplaceAllString(v, "")
-			v = strings.ReplaceAll(v, `\`, `/`)
-			v = strings.TrimSuffix(base, "/") + "/" + v
-		}
-
-		v = filepath.FromSlash(v)
-		interpolated = strings.ReplaceAll(interpolated, "#{"+k+"}", v)
 	}
 
-	return interpolated, nil
+	return utils.InterpolateWithArgs(interpolatee, base, args), nil
 }
 
 func executeShell(shellName string, command string, env []string, stage string, technique string, testName string, runSpec *types.RunSpec) (string, error) {
@@ -391,21 +616,21 @@ func executeShell(shellName string, command string, env []string, stage string,
 
 	// guard against hanging tests - kill after a timeout
 
-	timeoutSec := 30 * time.Second
-	if stage != "test" {
-		timeoutSec = 15 * time.Second
-	}
-	ctx, cancel := context.WithTimeout(context.Background(), timeoutSec)
+	timeoutSec := GetStageTimeout(stage, runSpec)
+	ctx, cancel := context.WithTimeout(GetStageContext(stage), timeoutSec)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, shellName, f.Name())
+	cmd := exec.Command(shellName, f.Name())
 
 	cmd.Env = append(os.Environ(), env...)
 
-	output, err := cmd.CombinedOutput()
+	output, err := runScript(ctx, cmd)
 	if err != nil {
 		if context.DeadlineExceeded == ctx.Err() {
-			return string(output), fmt.Errorf("TIMED OUT: script %w", err)
+			return string(output), fmt.Errorf("%w after %v: script %v", ErrTimedOut, timeoutSec, err)
+		}
+		if context.Canceled == ctx.Err() {
+			return string(output), fmt.Errorf("%w: script %v", ErrCancelled, err)
 		}
 		return string(output), fmt.Errorf("executing %s script: %w", shellName, err)
 	}
@@ -444,21 +669,21 @@ func executeCMD(shellName string, command string, env []string, stage string, te
 
 	// guard against hanging tests - kill after a timeout
 
-	timeoutSec := 30 * time.Second
-	if stage != "test" {
-		timeoutSec = 15 * time.Second
-	}
-	ctx, cancel := context.WithTimeout(context.Background(), timeoutSec)
+	timeoutSec := GetStageTimeout(stage, runSpec)
+	ctx, cancel := context.WithTimeout(GetStageContext(stage), timeoutSec)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, shellName, "/c", f.Name())
+	cmd := exec.Command(shellName, "/c", f.Name())
 
 	cmd.Env = append(os.Environ(), env...)
 
-	output, err := cmd.CombinedOutput()
+	output, err := runScript(ctx, cmd)
 	if err != nil {
 		if context.DeadlineExceeded == ctx.Err() {
-			return string(output), fmt.Errorf("TIMED OUT: script %w", err)
+			return string(output), fmt.Errorf("%w after %v: script %v", ErrTimedOut, timeoutSec, err)
+		}
+		if context.Canceled == ctx.Err() {
+			return string(output), fmt.Errorf("%w: script %v", ErrCancelled, err)
 		}
 		return string(output), fmt.Errorf("executing %s script: %w", shellName, err)
 	}
@@ -487,21 +712,21 @@ func executePS(shellName string, command string, env []string, stage string, tec
 
 	// guard against hanging tests - kill after a timeout
 
-	timeoutSec := 30 * time.Second
-	if stage != "test" {
-		timeoutSec = 15 * time.Second
-	}
-	ctx, cancel := context.WithTimeout(context.Background(), timeoutSec)
+	timeoutSec := GetStageTimeout(stage, runSpec)
+	ctx, cancel := context.WithTimeout(GetStageContext(stage), timeoutSec)
 	defer cancel()
 
-	cmd := exec.CommandContext(ctx, shellName, "-ExecutionPolicy", "Bypass", "-NoProfile", f.Name())
+	cmd := exec.Command(shellName, "-ExecutionPolicy", "Bypass", "-NoProfile", f.Name())
 
 	cmd.Env = append(os.Environ(), env...)
 
-	output, err := cmd.CombinedOutput()
+	output, err := runScript(ctx, cmd)
 	if err != nil {
 		if context.DeadlineExceeded == ctx.Err() {
-			return string(output), fmt.Errorf("TIMED OUT: script %w", err)
+			return string(output), fmt.Errorf("%w after %v: script %v", ErrTimedOut, timeoutSec, err)
+		}
+		if context.Canceled == ctx.Err() {
+			return string(output), fmt.Errorf("%w: script %v", ErrCancelled, err)
 		}
 		return string(output), fmt.Errorf("executing %s script: %w", shellName, err)
 	}
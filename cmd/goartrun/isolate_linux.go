@@ -0,0 +1,188 @@
+//go:build linux
+// +build linux
+
+package main
+
+/*
+ * Isolation mode: goartrun re-runs itself in new mount, pid, uts and
+ * network namespaces.  The child mounts an overlay on top of the real
+ * root, with a tmpfs upper dir, and chroots into it, so writes outside
+ * of the bind-mounted working, results and atomics dirs are discarded
+ * when it exits.  Other mounts, e.g. a separate /home, are not visible.
+ */
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+)
+
+var isolateNamespaces = []string{"mnt", "pid", "uts", "net"}
+
+const isolateCloneFlags = syscall.CLONE_NEWNS | syscall.CLONE_NEWPID | syscall.CLONE_NEWUTS | syscall.CLONE_NEWNET
+
+/*
+ * RunIsolated runs goartrun with --isolatedroot in new namespaces, passing
+ * runSpec on stdin, and returns its exit status.  SIGTERM and SIGINT are
+ * forwarded, so cancel works as without isolation.
+ */
+func RunIsolated(runSpec *types.RunSpec) types.TestStatus {
+	if os.Geteuid() != 0 {
+		fmt.Println("ERROR: isolation requires root")
+		return types.StatusInvalidArguments
+	}
+	self, err := os.Executable()
+	if err != nil {
+		fmt.Println("ERROR: unable to find goartrun executable", err)
+		return types.StatusRunnerFailure
+	}
+	stagingDir, err := os.MkdirTemp("", "goart-isolate-")
+	if err != nil {
+		fmt.Println("ERROR: unable to make isolation dir", err)
+		return types.StatusRunnerFailure
+	}
+	defer os.RemoveAll(stagingDir)
+
+	data, err := json.Marshal(runSpec)
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		return types.StatusRunnerFailure
+	}
+
+	cmd := exec.Command(self, "--config", "-", "--isolatedroot", stagingDir, "--resultsformat", flagResultsFormat)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Cloneflags: isolateCloneFlags}
+
+	fmt.Println("Running in isolated namespaces:", strings.Join(isolateNamespaces, ","))
+	if err = cmd.Start(); err != nil {
+		fmt.Println("ERROR: unable to start isolated runner", err)
+		return types.StatusRunnerFailure
+	}
+
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		for sig := range c {
+			cmd.Process.Signal(sig)
+		}
+	}()
+
+	cmd.Wait()
+	signal.Stop(c)
+	if cmd.ProcessState.ExitCode() < 0 {
+		return types.StatusRunnerFailure
+	}
+	return types.TestStatus(cmd.ProcessState.ExitCode())
+}
+
+/*
+ * EnterIsolation is called in the child, before privilege is dropped.
+ * stagingDir is an empty dir, made by parent, for the tmpfs with overlay
+ * upper, work and merged root dirs.  Returns namespace ids, e.g.
+ * "net" -> "4026532208", for run_summary.
+ */
+func EnterIsolation(stagingDir string, runSpec *types.RunSpec) (map[string]string, error) {
+	cwd, _ := os.Getwd()
+
+	// don't propagate our mounts to host
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return nil, fmt.Errorf("make / private: %w", err)
+	}
+	if err := syscall.Mount("tmpfs", stagingDir, "tmpfs", 0, "mode=0700"); err != nil {
+		return nil, fmt.Errorf("mount tmpfs: %w", err)
+	}
+	upperDir := filepath.Join(stagingDir, "upper")
+	workDir := filepath.Join(stagingDir, "work")
+	rootDir := filepath.Join(stagingDir, "root")
+	for _, dir := range []string{upperDir, workDir, rootDir} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			return nil, err
+		}
+	}
+	opts := fmt.Sprintf("lowerdir=/,upperdir=%s,workdir=%s", upperDir, workDir)
+	if err := syscall.Mount("overlay", rootDir, "overlay", 0, opts); err != nil {
+		return nil, fmt.Errorf("mount overlay: %w", err)
+	}
+
+	if err := syscall.Mount("proc", filepath.Join(rootDir, "proc"), "proc", 0, ""); err != nil {
+		return nil, fmt.Errorf("mount proc: %w", err)
+	}
+	for _, dir := range []string{"/dev", "/sys"} {
+		if err := syscall.Mount(dir, filepath.Join(rootDir, dir), "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+			return nil, fmt.Errorf("bind %s: %w", dir, err)
+		}
+	}
+
+	// dirs whose contents are kept, at same path in new root
+	keepDirs := []string{runSpec.TempDir, runSpec.ResultsDir, runSpec.AtomicsDir, runSpec.PrereqCacheDir}
+	for _, dir := range keepDirs {
+		if len(dir) == 0 {
+			continue
+		}
+		dir, _ = filepath.Abs(dir)
+		target := filepath.Join(rootDir, dir)
+		if err := os.MkdirAll(target, 0755); err != nil {
+			return nil, err
+		}
+		if err := syscall.Mount(dir, target, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+			return nil, fmt.Errorf("bind %s: %w", dir, err)
+		}
+	}
+
+	if err := syscall.Chroot(rootDir); err != nil {
+		return nil, fmt.Errorf("chroot: %w", err)
+	}
+	if len(cwd) == 0 || os.Chdir(cwd) != nil {
+		os.Chdir("/")
+	}
+
+	if err := setLoopbackUp(); err != nil {
+		fmt.Println("WARNING: unable to bring up loopback interface", err)
+	}
+
+	namespaces := map[string]string{}
+	for _, name := range isolateNamespaces {
+		link, err := os.Readlink("/proc/self/ns/" + name)
+		if err != nil {
+			return nil, err
+		}
+		// e.g. "net:[4026532208]"
+		namespaces[name] = strings.TrimSuffix(strings.TrimPrefix(link, name+":["), "]")
+	}
+	return namespaces, nil
+}
+
+// new network namespace has only lo, and it is down
+func setLoopbackUp() error {
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM, 0)
+	if err != nil {
+		return err
+	}
+	defer syscall.Close(fd)
+
+	var ifr struct {
+		name  [syscall.IFNAMSIZ]byte
+		flags uint16
+		_     [22]byte
+	}
+	copy(ifr.name[:], "lo")
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.SIOCGIFFLAGS, uintptr(unsafe.Pointer(&ifr))); errno != 0 {
+		return errno
+	}
+	ifr.flags |= syscall.IFF_UP
+	if _, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), syscall.SIOCSIFFLAGS, uintptr(unsafe.Pointer(&ifr))); errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"fmt"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+)
+
+func RunIsolated(runSpec *types.RunSpec) types.TestStatus {
+	fmt.Println("ERROR: isolation is only supported on linux")
+	return types.StatusInvalidArguments
+}
+
+func EnterIsolation(stagingDir string, runSpec *types.RunSpec) (map[string]string, error) {
+	return nil, fmt.Errorf("isolation is only supported on linux")
+}
@@ -25,8 +25,15 @@ var flagTempDir     string
 var flagRunSpecPath string
 var flagResultsFormat string
 var flagResultsDir string
+var flagTimeoutSeconds int
+var flagStageTimeoutSeconds int
+var flagUnsafe bool
+var flagSafetyPolicyPath string
+var flagSkipResidueCheck bool
+var flagPrereqCacheDir string
+var flagIsolate bool
+var flagIsolatedRoot string
 
-var AtomicsFolderRegex = regexp.MustCompile(`PathToAtomicsFolder(\\|\/)`)
 var BlockQuoteRegex    = regexp.MustCompile(`<\/?blockquote>`)
 
 func init() {
@@ -34,12 +41,20 @@ func init() {
         flag.StringVar(&flagTestName, "n", "", "test name")
         flag.IntVar(&flagTestIndex, "i", -1, "0-based test index")
 
-        flag.StringVar(&flagTestStage, "stage", "", "single stage (checkprereq, getprereq, test, cleanup)")
+        flag.StringVar(&flagTestStage, "stage", "", "single stage (prereq, checkprereq, test, cleanup). checkprereq only checks, without getting prereqs")
         flag.StringVar(&flagAtomicsPath, "atomicsdir", "", "path to atomics folder (required)")
         flag.StringVar(&flagTempDir, "tempdir", "", "path to working folder to use for test. Will be random if not set")
         flag.StringVar(&flagRunSpecPath, "config", "", "path to RunSpec config. Use - for stdin")
         flag.StringVar(&flagResultsFormat, "resultsformat", "json", "json or yaml output summary file")
         flag.StringVar(&flagResultsDir, "resultsdir", "", "location to save output")
+        flag.IntVar(&flagTimeoutSeconds, "timeout", 0, "seconds before test stage is killed. Default is 30")
+        flag.IntVar(&flagStageTimeoutSeconds, "stagetimeout", 0, "seconds before prereq, cleanup stages are killed. Default is 15")
+        flag.BoolVar(&flagUnsafe, "unsafe", false, "run test even if its commands violate the safety policy")
+        flag.StringVar(&flagSafetyPolicyPath, "safetypolicy", "", "path to csv of deny patterns and protected paths, added to the default safety policy")
+        flag.BoolVar(&flagSkipResidueCheck, "skipresiduecheck", false, "don't check for files, crontabs, units, users, sockets left after cleanup")
+        flag.BoolVar(&flagIsolate, "isolate", false, "linux, as root: run stages in new mount, pid, uts, network namespaces, with writes outside of working, results, atomics dirs discarded")
+        flag.StringVar(&flagIsolatedRoot, "isolatedroot", "", "internal, set by --isolate for runner in new namespaces")
+        flag.StringVar(&flagPrereqCacheDir, "prereqcache", "", "dir populated by atrutil --prereqcache. Cached urls in get_prereq commands are served from it")
 }
 
 
@@ -68,7 +83,15 @@ func FillRunSpecFromFlags(runSpec *types.RunSpec) {
 	runSpec.TestIndex = flagTestIndex
 	runSpec.AtomicsDir = flagAtomicsPath
 	runSpec.TempDir = flagTempDir
+	runSpec.Stage = flagTestStage
 	runSpec.ResultsDir = flagResultsDir
+	runSpec.TimeoutSeconds = flagTimeoutSeconds
+	runSpec.StageTimeoutSeconds = flagStageTimeoutSeconds
+	runSpec.Unsafe = flagUnsafe
+	runSpec.SafetyPolicyPath = flagSafetyPolicyPath
+	runSpec.SkipResidueCheck = flagSkipResidueCheck
+	runSpec.PrereqCacheDir = flagPrereqCacheDir
+	runSpec.Isolate = flagIsolate
 
 	// TODO: get input args
 	/*
@@ -91,6 +114,23 @@ func main() {
 		FillRunSpecFromFlags(runSpec)
 	}
 
+	// command line can loosen or extend policy of RunSpec config
+	if flagUnsafe {
+		runSpec.Unsafe = true
+	}
+	if flagSafetyPolicyPath != "" {
+		runSpec.SafetyPolicyPath = flagSafetyPolicyPath
+	}
+	if flagSkipResidueCheck {
+		runSpec.SkipResidueCheck = true
+	}
+	if flagPrereqCacheDir != "" {
+		runSpec.PrereqCacheDir = flagPrereqCacheDir
+	}
+	if flagIsolate {
+		runSpec.Isolate = true
+	}
+
 	// TODO: check for required params
 
 	atomicTest, err := getTest(runSpec.Technique, runSpec.TestName, runSpec.TestIndex, runSpec)
@@ -124,10 +164,23 @@ func main() {
 		}
 	}
 
+	if runSpec.Isolate && flagIsolatedRoot == "" {
+		os.Exit(int(RunIsolated(runSpec)))
+	}
+	if flagIsolatedRoot != "" {
+		atomicTest.Namespaces, err = EnterIsolation(flagIsolatedRoot, runSpec)
+		if err != nil {
+			fmt.Println("ERROR: unable to isolate test", err)
+			os.Exit(int(types.StatusRunnerFailure))
+		}
+	}
+
 	if runtime.GOOS != "windows" {
 		ManagePrivilege(atomicTest, runSpec)
 	}
 
+	HandleCancelSignals()
+
 	test, err, status := Execute(atomicTest, runSpec)
 	if err != nil {
 		fmt.Println("error occurred:", err)
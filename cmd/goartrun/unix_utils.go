@@ -5,6 +5,8 @@ package main
 import (
 	"fmt"
 	"os"
+	"os/exec"
+	"os/signal"
 	"os/user"
 	"strconv"
 	"syscall"
@@ -72,3 +74,33 @@ func ManagePrivilege(atomicTest *types.AtomicTest, runSpec *types.RunSpec) {
 		return
 	}
 }
+
+// run script in its own process group, so KillScript gets its children
+func SetScriptProcAttrs(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func KillScript(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+	err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	if err != nil {
+		cmd.Process.Kill()
+	}
+}
+
+// SIGTERM (from harness) or SIGINT cancels run. A second one exits now.
+func HandleCancelSignals() {
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		<-c
+		fmt.Println("Signal received, cancelling. cleanup will still run")
+		gCancelRun()
+		<-c
+		fmt.Println("Second signal received, exiting without cleanup")
+		KillRunningScripts()
+		os.Exit(int(types.StatusCancelled))
+	}()
+}
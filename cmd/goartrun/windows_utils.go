@@ -3,9 +3,44 @@
 package main
 
 import (
+   "fmt"
+   "os"
+   "os/exec"
+   "os/signal"
+   "strconv"
+
    types "github.com/secureworks/atomic-harness/pkg/types"
 )
 
 func ManagePrivilege(atomicTest *types.AtomicTest, runSpec *types.RunSpec) {
    // TODO: implement windows equivalent
 }
+
+func SetScriptProcAttrs(cmd *exec.Cmd) {
+}
+
+// kill script and its children. Process.Kill only gets the script
+func KillScript(cmd *exec.Cmd) {
+   if cmd.Process == nil {
+      return
+   }
+   err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run()
+   if err != nil {
+      cmd.Process.Kill()
+   }
+}
+
+// Ctrl-C / Ctrl-Break cancels run. A second one exits now.
+func HandleCancelSignals() {
+   c := make(chan os.Signal, 2)
+   signal.Notify(c, os.Interrupt)
+   go func() {
+      <-c
+      fmt.Println("Signal received, cancelling. cleanup will still run")
+      gCancelRun()
+      <-c
+      fmt.Println("Second signal received, exiting without cleanup")
+      KillRunningScripts()
+      os.Exit(int(types.StatusCancelled))
+   }()
+}
@@ -0,0 +1,300 @@
+package main
+
+/*
+ * atomic-harness compare OLD NEW: tests of two results dirs are aligned
+ * by technique, guid and iteration, and status transitions and expected
+ * events gained or lost are reported.  A run without --repeat is aligned
+ * with the first iteration of a --repeat run.  A test regressed if its status is
+ * lower (Validated > Partial > NoTelemetry > run errors), or an expected
+ * event that was matched in the old run is not matched in the new run.
+ * Exit code is 1 if any test regressed or was removed, 2 on error.
+ */
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"strings"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+)
+
+var flagCompareFormat string
+
+var kCompareChangeOrder = []types.TestChange{types.TestRegressed, types.TestImproved, types.TestChanged, types.TestAdded, types.TestRemoved, types.TestUnchanged}
+var kCompareChangeLabels = []string{"Regressed", "Improved", "Changed", "Added", "Removed", "Unchanged"}
+
+func init() {
+	flag.StringVar(&flagCompareFormat, "compareformat", "text", "output of compare: text, json or markdown")
+}
+
+/*
+ * GetStatusRank orders status for compare.  Returns -1 if status can't
+ * be compared, e.g. Skipped or Cancelled.
+ */
+func GetStatusRank(status types.TestStatus) int {
+	switch status {
+	case types.StatusValidateSuccess:
+		return 3
+	case types.StatusValidatePartial:
+		return 2
+	case types.StatusValidateFail:
+		return 1
+	}
+	if JUnitResult(status) == "skipped" {
+		return -1
+	}
+	return 0
+}
+
+// iterations of --repeat start at 1, other runs have iteration 0
+func getCompareKey(progress *types.TestProgress) string {
+	iteration := progress.Iteration
+	if iteration == 0 {
+		iteration = 1
+	}
+	return fmt.Sprintf("%s#%s#%d", progress.Technique, progress.TestGuid, iteration)
+}
+
+// e.g. "_e2e: File DELETE path=/tmp/x", or without suffix for default telemetry tool
+func GetToolEventName(suffix string, exp *types.ExpectedEvent) string {
+	if len(suffix) == 0 {
+		return DescribeExpectedEvent(exp)
+	}
+	return suffix + ": " + DescribeExpectedEvent(exp)
+}
+
+// expected events of test by telemetry tool suffix, as "suffix: description" -> matched
+func getReportTestEvents(test *ReportTest, suffix string) ([]string, map[string]bool) {
+	names := []string{}
+	matched := map[string]bool{}
+	for _, tool := range test.Tools {
+		if tool.Suffix != suffix {
+			continue
+		}
+		for _, exp := range tool.Summary.TestData.ExpectedEvents {
+			name := GetToolEventName(suffix, exp)
+			if _, ok := matched[name]; !ok {
+				names = append(names, name)
+			}
+			matched[name] = matched[name] || len(exp.Matches) > 0
+		}
+	}
+	return names, matched
+}
+
+// CompareReportTests compares test of both runs, either may be nil
+func CompareReportTests(oldTest *ReportTest, newTest *ReportTest) *types.TestComparison {
+	cmp := &types.TestComparison{}
+	var progress *types.TestProgress
+	if newTest != nil {
+		progress = &newTest.Progress
+	} else {
+		progress = &oldTest.Progress
+	}
+	cmp.Technique = progress.Technique
+	cmp.TestIndex = progress.TestIndex
+	cmp.TestGuid = progress.TestGuid
+	cmp.TestName = progress.TestName
+	cmp.Iteration = progress.Iteration
+
+	if oldTest == nil {
+		cmp.NewStatus = newTest.Progress.Status.String()
+		cmp.Change = types.TestAdded
+		return cmp
+	}
+	cmp.OldStatus = oldTest.Progress.Status.String()
+	if newTest == nil {
+		cmp.Change = types.TestRemoved
+		return cmp
+	}
+	cmp.NewStatus = newTest.Progress.Status.String()
+
+	// only compare events of telemetry tools validated in both runs
+	for _, oldTool := range oldTest.Tools {
+		oldNames, oldMatched := getReportTestEvents(oldTest, oldTool.Suffix)
+		newNames, newMatched := getReportTestEvents(newTest, oldTool.Suffix)
+		if len(newNames) == 0 {
+			continue
+		}
+		for _, name := range oldNames {
+			if oldMatched[name] && !newMatched[name] {
+				cmp.LostEvents = append(cmp.LostEvents, name)
+			}
+		}
+		for _, name := range newNames {
+			if newMatched[name] && !oldMatched[name] {
+				cmp.GainedEvents = append(cmp.GainedEvents, name)
+			}
+		}
+	}
+
+	oldRank := GetStatusRank(oldTest.Progress.Status)
+	newRank := GetStatusRank(newTest.Progress.Status)
+	switch {
+	case oldRank >= 0 && newRank >= 0 && newRank < oldRank:
+		cmp.Change = types.TestRegressed
+	case len(cmp.LostEvents) > 0:
+		cmp.Change = types.TestRegressed
+	case oldRank >= 0 && newRank >= 0 && newRank > oldRank:
+		cmp.Change = types.TestImproved
+	case oldTest.Progress.Status != newTest.Progress.Status:
+		cmp.Change = types.TestChanged
+	case len(cmp.GainedEvents) > 0:
+		cmp.Change = types.TestImproved
+	default:
+		cmp.Change = types.TestUnchanged
+	}
+	return cmp
+}
+
+// CompareRuns aligns tests of old and new results dirs, in order of new run
+func CompareRuns(oldDir string, newDir string) (*types.RunComparison, error) {
+	oldReport, err := LoadReport(oldDir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load %s: %v", oldDir, err)
+	}
+	newReport, err := LoadReport(newDir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load %s: %v", newDir, err)
+	}
+
+	result := &types.RunComparison{OldDir: oldDir, NewDir: newDir, Counts: map[types.TestChange]int{}, Tests: []*types.TestComparison{}}
+	oldTests := map[string]*ReportTest{}
+	for _, test := range oldReport.Tests {
+		oldTests[getCompareKey(&test.Progress)] = test
+	}
+	for _, test := range newReport.Tests {
+		key := getCompareKey(&test.Progress)
+		result.Tests = append(result.Tests, CompareReportTests(oldTests[key], test))
+		delete(oldTests, key)
+	}
+	for _, test := range oldReport.Tests {
+		if _, ok := oldTests[getCompareKey(&test.Progress)]; ok {
+			result.Tests = append(result.Tests, CompareReportTests(test, nil))
+		}
+	}
+	for _, cmp := range result.Tests {
+		result.Counts[cmp.Change] += 1
+	}
+	return result, nil
+}
+
+func sprintComparisonCounts(result *types.RunComparison, sep string) string {
+	parts := []string{}
+	for i, change := range kCompareChangeOrder {
+		parts = append(parts, fmt.Sprintf("%s%s%d", kCompareChangeLabels[i], sep, result.Counts[change]))
+	}
+	return strings.Join(parts, " ")
+}
+
+func getComparisonTestName(cmp *types.TestComparison) string {
+	s := fmt.Sprintf("%s [%s] %s", cmp.Technique, cmp.TestIndex, cmp.TestName)
+	if cmp.Iteration > 0 {
+		s += fmt.Sprintf(" #%d", cmp.Iteration)
+	}
+	return s
+}
+
+func getComparisonStatus(cmp *types.TestComparison) string {
+	oldStatus, newStatus := cmp.OldStatus, cmp.NewStatus
+	if len(oldStatus) == 0 {
+		oldStatus = "-"
+	}
+	if len(newStatus) == 0 {
+		newStatus = "-"
+	}
+	return oldStatus + " -> " + newStatus
+}
+
+// SPrintComparison returns text of changed tests, grouped by change
+func SPrintComparison(result *types.RunComparison) string {
+	s := fmt.Sprintf("Comparing %s -> %s\n", result.OldDir, result.NewDir)
+	for _, change := range kCompareChangeOrder {
+		if change == types.TestUnchanged {
+			continue
+		}
+		for _, cmp := range result.Tests {
+			if cmp.Change != change {
+				continue
+			}
+			s += fmt.Sprintf("%-9s %s: %s\n", strings.ToUpper(string(change)), getComparisonTestName(cmp), getComparisonStatus(cmp))
+			for _, name := range cmp.LostEvents {
+				s += "    lost   " + name + "\n"
+			}
+			for _, name := range cmp.GainedEvents {
+				s += "    gained " + name + "\n"
+			}
+		}
+	}
+	s += "=== " + sprintComparisonCounts(result, ":") + "\n"
+	return s
+}
+
+// escapes text for markdown table cell
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", " ")
+}
+
+// SPrintComparisonMarkdown returns markdown for PR comments
+func SPrintComparisonMarkdown(result *types.RunComparison) string {
+	s := "### atomic-harness run comparison\n\n"
+	s += fmt.Sprintf("`%s` -> `%s`\n\n", result.OldDir, result.NewDir)
+	s += "**" + sprintComparisonCounts(result, ": ") + "**\n\n"
+	if len(result.Tests) == result.Counts[types.TestUnchanged] {
+		return s + "No changes.\n"
+	}
+	s += "| Change | Test | Status | Expected events |\n|---|---|---|---|\n"
+	for _, change := range kCompareChangeOrder {
+		if change == types.TestUnchanged {
+			continue
+		}
+		for _, cmp := range result.Tests {
+			if cmp.Change != change {
+				continue
+			}
+			events := []string{}
+			for _, name := range cmp.LostEvents {
+				events = append(events, "lost `"+name+"`")
+			}
+			for _, name := range cmp.GainedEvents {
+				events = append(events, "gained `"+name+"`")
+			}
+			s += fmt.Sprintf("| %s | %s | %s | %s |\n", change, markdownCell(getComparisonTestName(cmp)), markdownCell(getComparisonStatus(cmp)),
+				markdownCell(strings.Join(events, "<br>")))
+		}
+	}
+	return s
+}
+
+// RunCompare is main() of compare. args are old and new results dirs
+func RunCompare(args []string) int {
+	if len(args) != 2 {
+		fmt.Println("usage: atomic-harness compare [--compareformat text|json|markdown] <old resultsdir> <new resultsdir>")
+		return 2
+	}
+	result, err := CompareRuns(args[0], args[1])
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		return 2
+	}
+
+	switch flagCompareFormat {
+	case "text":
+		fmt.Print(SPrintComparison(result))
+	case "json":
+		data, _ := json.MarshalIndent(result, "", "  ")
+		fmt.Println(string(data))
+	case "markdown":
+		fmt.Print(SPrintComparisonMarkdown(result))
+	default:
+		fmt.Println("ERROR: unknown compareformat", flagCompareFormat)
+		return 2
+	}
+
+	if result.Counts[types.TestRegressed] > 0 || result.Counts[types.TestRemoved] > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+)
+
+// writes status.json and a validate_summary.json per test, with expected events matched as given
+func writeCompareResultsDir(t *testing.T, progress []types.TestProgress, matched [][]bool) string {
+	dir := t.TempDir()
+	data, _ := json.Marshal(progress)
+	os.WriteFile(filepath.Join(dir, "status.json"), data, 0644)
+
+	for i, p := range progress {
+		testDir := filepath.Join(dir, GetReportTestDirName(&p))
+		os.Mkdir(testDir, 0755)
+		summary := ExtractState{}
+		for j, isMatched := range matched[i] {
+			exp := &types.ExpectedEvent{EventType: "File", SubType: "DELETE", FieldChecks: []types.FieldCriteria{{FieldName: "path", Op: "=", Value: "/tmp/" + string(rune('a'+j))}}}
+			if isMatched {
+				exp.Matches = []*types.SimpleEvent{{}}
+			}
+			summary.TestData.ExpectedEvents = append(summary.TestData.ExpectedEvents, exp)
+		}
+		data, _ = json.Marshal(summary)
+		os.WriteFile(filepath.Join(testDir, "validate_summary.json"), data, 0644)
+	}
+	return dir
+}
+
+func TestCompareRuns(t *testing.T) {
+	oldDir := writeCompareResultsDir(t, []types.TestProgress{
+		{Technique: "T1070.004", TestIndex: "1", TestGuid: "aaaa", TestName: "rm", Status: types.StatusValidateSuccess},
+		{Technique: "T1070.004", TestIndex: "2", TestGuid: "bbbb", TestName: "shred", Status: types.StatusValidatePartial},
+		{Technique: "T1485", TestIndex: "1", TestGuid: "cccc", TestName: "dd", Status: types.StatusValidatePartial},
+		{Technique: "T1485", TestIndex: "2", TestGuid: "dddd", TestName: "wipe", Status: types.StatusValidateSuccess},
+		{Technique: "T1105", TestIndex: "1", TestGuid: "eeee", TestName: "curl", Status: types.StatusValidateSuccess},
+	}, [][]bool{{true, true}, {true, false}, {true, false}, {true}, {true}})
+
+	newDir := writeCompareResultsDir(t, []types.TestProgress{
+		{Technique: "T1070.004", TestIndex: "1", TestGuid: "aaaa", TestName: "rm", Status: types.StatusValidatePartial},
+		{Technique: "T1070.004", TestIndex: "2", TestGuid: "bbbb", TestName: "shred", Status: types.StatusValidateSuccess},
+		{Technique: "T1485", TestIndex: "1", TestGuid: "cccc", TestName: "dd", Status: types.StatusValidatePartial},
+		{Technique: "T1485", TestIndex: "2", TestGuid: "dddd", TestName: "wipe", Status: types.StatusSkipped},
+		{Technique: "T1059.004", TestIndex: "1", TestGuid: "ffff", TestName: "sh", Status: types.StatusValidateSuccess},
+	}, [][]bool{{true, false}, {true, true}, {true, false}, {}, {true}})
+
+	result, err := CompareRuns(oldDir, newDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, len(result.Tests))
+	assert.Equal(t, 1, result.Counts[types.TestRegressed])
+	assert.Equal(t, 1, result.Counts[types.TestImproved])
+	assert.Equal(t, 1, result.Counts[types.TestChanged])
+	assert.Equal(t, 1, result.Counts[types.TestUnchanged])
+	assert.Equal(t, 1, result.Counts[types.TestAdded])
+	assert.Equal(t, 1, result.Counts[types.TestRemoved])
+
+	regressed := result.Tests[0]
+	assert.Equal(t, types.TestRegressed, regressed.Change)
+	assert.Equal(t, "Validated", regressed.OldStatus)
+	assert.Equal(t, "Partial", regressed.NewStatus)
+	assert.Equal(t, []string{"File DELETE path=/tmp/b"}, regressed.LostEvents)
+	assert.Equal(t, []string{"File DELETE path=/tmp/b"}, result.Tests[1].GainedEvents)
+	assert.Equal(t, types.TestRemoved, result.Tests[5].Change)
+	assert.Equal(t, "T1105", result.Tests[5].Technique)
+
+	s := SPrintComparison(result)
+	assert.Contains(t, s, "REGRESSED T1070.004 [1] rm: Validated -> Partial\n    lost   File DELETE path=/tmp/b\n")
+	assert.Contains(t, s, "CHANGED   T1485 [2] wipe: Validated -> Skipped\n")
+	assert.Contains(t, s, "ADDED     T1059.004 [1] sh: - -> Validated\n")
+	assert.NotContains(t, s, "[1] dd")
+	assert.Contains(t, s, "=== Regressed:1 Improved:1 Changed:1 Added:1 Removed:1 Unchanged:1\n")
+
+	md := SPrintComparisonMarkdown(result)
+	assert.Contains(t, md, "| regressed | T1070.004 [1] rm | Validated -> Partial | lost `File DELETE path=/tmp/b` |\n")
+	assert.Contains(t, md, "| improved | T1070.004 [2] shred | Partial -> Validated | gained `File DELETE path=/tmp/b` |\n")
+
+	// event lost with same status is a regression
+	oldTest := &ReportTest{Progress: types.TestProgress{Status: types.StatusValidatePartial}, Tools: []*ReportToolResult{{}}}
+	newTest := &ReportTest{Progress: types.TestProgress{Status: types.StatusValidatePartial}, Tools: []*ReportToolResult{{}}}
+	oldTest.Tools[0].Summary.TestData.ExpectedEvents = []*types.ExpectedEvent{{EventType: "Process", Matches: []*types.SimpleEvent{{}}}, {EventType: "File"}}
+	newTest.Tools[0].Summary.TestData.ExpectedEvents = []*types.ExpectedEvent{{EventType: "Process"}, {EventType: "File", Matches: []*types.SimpleEvent{{}}}}
+	cmp := CompareReportTests(oldTest, newTest)
+	assert.Equal(t, types.TestRegressed, cmp.Change)
+	assert.Equal(t, []string{"Process"}, cmp.LostEvents)
+	assert.Equal(t, []string{"File"}, cmp.GainedEvents)
+
+	// events of a telemetry tool not in both runs are not compared
+	newTest.Tools[0].Suffix = "_e2e"
+	assert.Equal(t, types.TestUnchanged, CompareReportTests(oldTest, newTest).Change)
+
+	assert.Equal(t, 1, RunCompare([]string{oldDir, newDir}))
+	assert.Equal(t, 0, RunCompare([]string{oldDir, oldDir}))
+	assert.Equal(t, 2, RunCompare([]string{oldDir, filepath.Join(oldDir, "missing")}))
+}
+
+func TestCompareRepeatRun(t *testing.T) {
+	oldDir := writeCompareResultsDir(t, []types.TestProgress{
+		{Technique: "T1070.004", TestIndex: "1", TestGuid: "aaaa", TestName: "rm", Status: types.StatusValidateSuccess},
+		{Technique: "T1105", TestIndex: "1", TestGuid: "eeee", TestName: "curl", Status: types.StatusValidateSuccess},
+	}, [][]bool{{true}, {true}})
+
+	repeatDir := writeCompareResultsDir(t, []types.TestProgress{
+		{Technique: "T1070.004", TestIndex: "1", TestGuid: "aaaa", TestName: "rm", Iteration: 1, Status: types.StatusValidateSuccess},
+		{Technique: "T1070.004", TestIndex: "1", TestGuid: "aaaa", TestName: "rm", Iteration: 2, Status: types.StatusValidateSuccess},
+		{Technique: "T1105", TestIndex: "1", TestGuid: "eeee", TestName: "curl", Iteration: 1, Status: types.StatusValidateSuccess},
+		{Technique: "T1105", TestIndex: "1", TestGuid: "eeee", TestName: "curl", Iteration: 2, Status: types.StatusValidateSuccess},
+	}, [][]bool{{true}, {true}, {true}, {true}})
+
+	// run without --repeat is compared with first iteration
+	result, err := CompareRuns(oldDir, repeatDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, result.Counts[types.TestUnchanged])
+	assert.Equal(t, 2, result.Counts[types.TestAdded])
+	assert.Equal(t, 0, result.Counts[types.TestRemoved])
+	assert.Equal(t, 0, RunCompare([]string{oldDir, repeatDir}))
+
+	// removed test fails compare
+	result, err = CompareRuns(repeatDir, oldDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, result.Counts[types.TestRemoved])
+	assert.Equal(t, 0, result.Counts[types.TestRegressed])
+	assert.Equal(t, 1, RunCompare([]string{repeatDir, oldDir}))
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	utils "github.com/secureworks/atomic-harness/pkg/utils"
+)
+
+/*
+ * HarnessConfigFile is loaded from --config path (YAML or JSON).
+ * Keys are the command-line flag names.  Values in a profile override
+ * the defaults, and flags given on the command-line override both.
+ * 'tests' is a list of test specs, used if none are on command-line.
+ *
+ *   defaults:
+ *     criteriapath: ../atomic-validation-criteria/linux
+ *     serverscsv: ./doc/example_servers_config.csv
+ *   profiles:
+ *     ubuntu-edr-a:
+ *       telemetrytoolpath: [ ./telemtool_edra, ./telemtool_e2e ]
+ *       username: bob
+ *       tests: [ T1053.003, T1562.004#7 ]
+ */
+type HarnessConfigFile struct {
+	Defaults map[string]interface{}            `yaml:"defaults" json:"defaults"`
+	Profiles map[string]map[string]interface{} `yaml:"profiles" json:"profiles"`
+}
+
+const kConfigTestsKey = "tests"
+
+// flags of one-shot modes and their dirs, not saved in effective config, so reusing it doesn't replay them
+var kConfigModeFlags = []string{"resume", "revalidate", "retryfailed", "norun", "report", "preflight", "listnocriteria",
+	"listen", "servedir", "apitoken", "resultspath"}
+
+var flagConfigPath string
+var flagConfigProfile string
+
+func init() {
+	flag.StringVar(&flagConfigPath, "config", "", "path to harness config file (YAML or JSON) with defaults and named profiles of flag values")
+	flag.StringVar(&flagConfigProfile, "profile", "", "name of profile in config file to use")
+}
+
+func LoadHarnessConfigFile(path string) (*HarnessConfigFile, error) {
+	data, err := os.ReadFile(filepath.FromSlash(path))
+	if err != nil {
+		return nil, err
+	}
+	obj := &HarnessConfigFile{}
+	if err = yaml.Unmarshal(data, obj); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return obj, nil
+}
+
+/*
+ * ApplyHarnessConfig sets the flags in fs from the defaults and profile
+ * of config file, except for flags that were set on the command-line.
+ * @return test specs listed in config
+ */
+func ApplyHarnessConfig(fs *flag.FlagSet, path string, profile string) ([]string, error) {
+	cfg, err := LoadHarnessConfigFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]interface{}{}
+	for k, v := range cfg.Defaults {
+		values[k] = v
+	}
+	if len(profile) > 0 {
+		profileValues, ok := cfg.Profiles[profile]
+		if !ok {
+			names := []string{}
+			for name := range cfg.Profiles {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("profile '%s' not found in %s. Profiles: %s", profile, path, strings.Join(names, ","))
+		}
+		for k, v := range profileValues {
+			values[k] = v
+		}
+	}
+
+	isSetOnCmdline := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		isSetOnCmdline[f.Name] = true
+	})
+
+	tests := []string{}
+	for name, val := range values {
+		if name == kConfigTestsKey {
+			tests = ConfigValueAsList(val)
+			continue
+		}
+		if name == "config" || name == "profile" {
+			return nil, fmt.Errorf("'%s' is not allowed in config file", name)
+		}
+		if fs.Lookup(name) == nil {
+			return nil, fmt.Errorf("unknown flag name in config file: %s", name)
+		}
+		if isSetOnCmdline[name] {
+			if gVerbose {
+				fmt.Println("config", name, "overridden on command-line")
+			}
+			continue
+		}
+		if err = fs.Set(name, strings.Join(ConfigValueAsList(val), ",")); err != nil {
+			return nil, fmt.Errorf("config value for %s: %w", name, err)
+		}
+	}
+	return tests, nil
+}
+
+// scalars are returned as single entry list
+func ConfigValueAsList(val interface{}) []string {
+	ret := []string{}
+	switch v := val.(type) {
+	case nil:
+	case []interface{}:
+		for _, entry := range v {
+			ret = append(ret, fmt.Sprint(entry))
+		}
+	default:
+		ret = append(ret, fmt.Sprint(v))
+	}
+	return ret
+}
+
+/*
+ * WriteEffectiveConfig saves the value of every flag, and the test
+ * specs, as a config file in resultsDir.  It can be used with --config
+ * to repeat the run.  Mode flags, e.g. --resume or --norun, are left out.
+ */
+func WriteEffectiveConfig(fs *flag.FlagSet, resultsDir string, tests []string) {
+	values := map[string]interface{}{}
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" || f.Name == "profile" || strings.HasPrefix(f.Name, "test.") || utils.StringInList(f.Name, kConfigModeFlags) {
+			return
+		}
+		values[f.Name] = f.Value.String()
+	})
+	if len(tests) > 0 {
+		values[kConfigTestsKey] = tests
+	}
+
+	cfg := &HarnessConfigFile{}
+	cfg.Defaults = values
+
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		return
+	}
+
+	header := "# effective config of harness run"
+	if len(flagConfigPath) > 0 {
+		header += ". loaded from " + flagConfigPath
+		if len(flagConfigProfile) > 0 {
+			header += " profile " + flagConfigProfile
+		}
+	}
+	data = append([]byte(header+"\n"), data...)
+
+	outPath := filepath.FromSlash(resultsDir + "/harness_config.yaml")
+	err = os.WriteFile(outPath, data, 0644)
+	if err != nil {
+		fmt.Println("ERROR: unable to write file", outPath, err)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const kTestConfigYaml = `
+defaults:
+  criteriapath: ../atomic-validation-criteria/linux
+  username: alice
+  jobs: 1
+profiles:
+  ubuntu-edr-a:
+    telemetrytoolpath: [ ./telemtool_edra, ./telemtool_e2e ]
+    username: bob
+    jobs: 4
+    tests: [ T1053.003, "T1562.004#7" ]
+  rhel-edr-b:
+    telemetrytoolpath: ./telemtool_edrb
+`
+
+func newTestFlagSet() (*flag.FlagSet, map[string]*string) {
+	fs := flag.NewFlagSet("harness", flag.ContinueOnError)
+	vals := map[string]*string{}
+	for _, name := range []string{"criteriapath", "username", "jobs", "telemetrytoolpath", "resume"} {
+		vals[name] = fs.String(name, "", "")
+	}
+	return fs, vals
+}
+
+func TestHarnessConfigProfiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "harness.yaml")
+	os.WriteFile(path, []byte(kTestConfigYaml), 0644)
+
+	fs, vals := newTestFlagSet()
+	fs.Parse([]string{"--jobs", "2"})
+	tests, err := ApplyHarnessConfig(fs, path, "ubuntu-edr-a")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"T1053.003", "T1562.004#7"}, tests)
+	assert.Equal(t, "../atomic-validation-criteria/linux", *vals["criteriapath"])
+	assert.Equal(t, "bob", *vals["username"])
+	assert.Equal(t, "2", *vals["jobs"]) // command-line wins
+	assert.Equal(t, "./telemtool_edra,./telemtool_e2e", *vals["telemetrytoolpath"])
+
+	fs, vals = newTestFlagSet()
+	tests, err = ApplyHarnessConfig(fs, path, "")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(tests))
+	assert.Equal(t, "alice", *vals["username"])
+	assert.Equal(t, "", *vals["telemetrytoolpath"])
+
+	fs, _ = newTestFlagSet()
+	_, err = ApplyHarnessConfig(fs, path, "no-such-profile")
+	assert.NotNil(t, err)
+}
+
+func TestEffectiveConfigRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+
+	fs, _ := newTestFlagSet()
+	fs.Parse([]string{"--username", "carol", "--telemetrytoolpath", "./a,./b", "--resume", "./testruns/harness-results-1"})
+	WriteEffectiveConfig(fs, dir, []string{"T1027.001#1"})
+
+	fs, vals := newTestFlagSet()
+	tests, err := ApplyHarnessConfig(fs, filepath.Join(dir, "harness_config.yaml"), "")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"T1027.001#1"}, tests)
+	assert.Equal(t, "carol", *vals["username"])
+	assert.Equal(t, "./a,./b", *vals["telemetrytoolpath"])
+	assert.Equal(t, "", *vals["resume"]) // mode flags are not saved
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+	utils "github.com/secureworks/atomic-harness/pkg/utils"
+)
+
+/*
+ * Selection filters are applied to the tests resolved from the test specs,
+ * runlist and tactics.  A test must pass every filter that is set.
+ */
+var flagFilterExecutors string
+var flagFilterElevated string
+var flagFilterHasDeps string
+var flagFilterHasCriteria string
+var flagListNoCriteria bool
+var flagFilterMatch string
+var flagFilterNoMatch string
+var flagExcludeFilePath string
+
+var gAtomicYamls = map[string]*types.Atomic{} // tid -> loaded atomic yaml, see GetAtomicTest()
+
+// trailing comment in exclude file. "T1562.004#7  # disables firewall"
+var ExcludeCommentRegex = regexp.MustCompile(`\s+#(\s.*)?$`)
+
+func init() {
+	flag.StringVar(&flagFilterExecutors, "executor", "", "comma-delimited executor names of tests to run. Prefix with ! to exclude, e.g. !powershell")
+	flag.StringVar(&flagFilterElevated, "elevated", "", "if true, only tests with elevation_required. if false, only tests without")
+	flag.StringVar(&flagFilterHasDeps, "hasdeps", "", "if true, only tests with dependencies (prereqs). if false, only tests without")
+	flag.StringVar(&flagFilterHasCriteria, "hascriteria", "", "if true, omit tests without criteria quietly. false is not supported, see --listnocriteria")
+	flag.BoolVar(&flagListNoCriteria, "listnocriteria", false, "list the selected tests that have no criteria, and exit")
+	flag.StringVar(&flagFilterMatch, "match", "", "regex. only tests with matching name or description")
+	flag.StringVar(&flagFilterNoMatch, "nomatch", "", "regex. omit tests with matching name or description")
+	flag.StringVar(&flagExcludeFilePath, "exclude", "", "path to file of test specs to never run, one per line. # starts a comment")
+}
+
+type TestFilters struct {
+	includeExecutors []string
+	excludeExecutors []string
+	elevated         *bool
+	hasDeps          *bool
+	hasCriteria      *bool
+	match            *regexp.Regexp
+	noMatch          *regexp.Regexp
+	exclude          []*types.TestSpec
+}
+
+func parseOptionalBool(name string, val string) (*bool, error) {
+	if len(val) == 0 {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return nil, fmt.Errorf("--%s should be true or false: %s", name, val)
+	}
+	return &b, nil
+}
+
+// LoadTestFilters parses filter flags and loads exclude file
+func LoadTestFilters() (*TestFilters, error) {
+	var err error
+	filters := &TestFilters{}
+
+	for _, name := range strings.Split(flagFilterExecutors, ",") {
+		name = strings.TrimSpace(name)
+		if strings.HasPrefix(name, "!") {
+			filters.excludeExecutors = append(filters.excludeExecutors, name[1:])
+		} else if len(name) > 0 {
+			filters.includeExecutors = append(filters.includeExecutors, name)
+		}
+	}
+	if filters.elevated, err = parseOptionalBool("elevated", flagFilterElevated); err != nil {
+		return nil, err
+	}
+	if filters.hasDeps, err = parseOptionalBool("hasdeps", flagFilterHasDeps); err != nil {
+		return nil, err
+	}
+	if filters.hasCriteria, err = parseOptionalBool("hascriteria", flagFilterHasCriteria); err != nil {
+		return nil, err
+	}
+	if filters.hasCriteria != nil && false == *filters.hasCriteria {
+		return nil, fmt.Errorf("--hascriteria false is not supported, tests without criteria can't be run. use --listnocriteria to list them")
+	}
+	if filters.hasCriteria != nil && flagListNoCriteria {
+		return nil, fmt.Errorf("--hascriteria true omits the tests --listnocriteria lists")
+	}
+	if len(flagFilterMatch) > 0 {
+		if filters.match, err = regexp.Compile(flagFilterMatch); err != nil {
+			return nil, fmt.Errorf("--match: %w", err)
+		}
+	}
+	if len(flagFilterNoMatch) > 0 {
+		if filters.noMatch, err = regexp.Compile(flagFilterNoMatch); err != nil {
+			return nil, fmt.Errorf("--nomatch: %w", err)
+		}
+	}
+	if len(flagExcludeFilePath) > 0 {
+		if filters.exclude, err = LoadExcludeFile(flagExcludeFilePath); err != nil {
+			return nil, err
+		}
+	}
+	return filters, nil
+}
+
+/*
+ * LoadExcludeFile reads test specs, in any format accepted by
+ * ParseTestSpecs, one per line.
+ */
+func LoadExcludeFile(path string) ([]*types.TestSpec, error) {
+	data, err := os.ReadFile(filepath.FromSlash(path))
+	if err != nil {
+		return nil, err
+	}
+
+	lines := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(ExcludeCommentRegex.ReplaceAllString(scanner.Text(), ""))
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return nil, nil
+	}
+
+	// ParseTestSpecs adds to gTestSpecs, so swap in an empty list
+
+	saved := gTestSpecs
+	gTestSpecs = []*types.TestSpec{}
+	ok := ParseTestSpecs(lines)
+	excluded := gTestSpecs
+	gTestSpecs = saved
+
+	if !ok {
+		return nil, fmt.Errorf("invalid test spec in %s", path)
+	}
+	return excluded, nil
+}
+
+/*
+ * GetAtomicTest returns test from atomics yaml by 1-based index,
+ * or by guid prefix or name.
+ * @return nil if not found
+ */
+func GetAtomicTest(tid string, testIndex string, guid string, name string) *types.AtomicTest {
+	atomic, ok := gAtomicYamls[tid]
+	if !ok {
+		var err error
+		atomic, err = utils.LoadAtomicsTechniqueYaml(tid, filepath.FromSlash(flagAtomicsPath))
+		if err != nil && gVerbose {
+			fmt.Println("filter:", err)
+		}
+		gAtomicYamls[tid] = atomic
+	}
+	if atomic == nil {
+		return nil
+	}
+	for i := range atomic.AtomicTests {
+		test := &atomic.AtomicTests[i]
+		if len(guid) > 0 && len(test.GUID) > 0 {
+			if strings.HasPrefix(test.GUID, guid) {
+				return test
+			}
+			continue
+		}
+		if fmt.Sprintf("%d", i+1) == testIndex || (len(testIndex) == 0 && test.Name == name) {
+			return test
+		}
+	}
+	return nil
+}
+
+/*
+ * SpecMatchesTest returns true if spec selects the test.  As on the
+ * command-line, a technique without test selects its sub-techniques too.
+ */
+func SpecMatchesTest(spec *types.TestSpec, tid string, testIndex string, guid string, name string) bool {
+	isTechniqueOnly := len(spec.TestGuid) == 0 && len(spec.TestIndex) == 0 && len(spec.TestName) == 0
+	if isTechniqueOnly {
+		return tid == spec.Technique || strings.HasPrefix(tid, spec.Technique+".")
+	}
+	if spec.Technique != tid {
+		return false
+	}
+	if len(spec.TestGuid) > 0 {
+		return len(guid) > 0 && (strings.HasPrefix(spec.TestGuid, guid) || strings.HasPrefix(guid, spec.TestGuid))
+	}
+	if len(spec.TestIndex) > 0 {
+		return spec.TestIndex == testIndex
+	}
+	if len(spec.TestName) > 0 {
+		return spec.TestName == name
+	}
+	return true
+}
+
+/*
+ * IsSelected checks test against filters.
+ * @return empty string if selected, otherwise the reason it is not.
+ */
+func (f *TestFilters) IsSelected(tid string, testIndex string, guid string, name string, hasCriteria bool) string {
+	if len(guid) == 0 && len(f.exclude) > 0 {
+		if test := GetAtomicTest(tid, testIndex, guid, name); test != nil {
+			guid = test.GUID
+		}
+	}
+	for _, spec := range f.exclude {
+		if SpecMatchesTest(spec, tid, testIndex, guid, name) {
+			return "excluded"
+		}
+	}
+	if f.hasCriteria != nil && *f.hasCriteria != hasCriteria {
+		return "hascriteria"
+	}
+
+	needsAtomic := len(f.includeExecutors) > 0 || len(f.excludeExecutors) > 0 || f.elevated != nil ||
+		f.hasDeps != nil || f.match != nil || f.noMatch != nil
+	if !needsAtomic {
+		return ""
+	}
+
+	test := GetAtomicTest(tid, testIndex, guid, name)
+	if test == nil {
+		return "atomic not found"
+	}
+
+	executor := ""
+	elevated := false
+	if test.Executor != nil {
+		executor = test.Executor.Name
+		elevated = test.Executor.ElevationRequired
+	}
+	if len(f.includeExecutors) > 0 && !utils.StringInList(executor, f.includeExecutors) {
+		return "executor " + executor
+	}
+	if utils.StringInList(executor, f.excludeExecutors) {
+		return "executor " + executor
+	}
+	if f.elevated != nil && *f.elevated != elevated {
+		return "elevated"
+	}
+	if f.hasDeps != nil && *f.hasDeps != (len(test.Dependencies) > 0) {
+		return "hasdeps"
+	}
+	if f.match != nil && !f.match.MatchString(test.Name) && !f.match.MatchString(test.Description) {
+		return "match"
+	}
+	if f.noMatch != nil && (f.noMatch.MatchString(test.Name) || f.noMatch.MatchString(test.Description)) {
+		return "nomatch"
+	}
+	return ""
+}
+
+/*
+ * ApplyTestFilters removes criteria of tests not selected from
+ * gTestSpecs.  Specs of tests without criteria are kept, unless
+ * --hascriteria true.  With --listnocriteria, only those passing
+ * the other filters are kept.
+ */
+func ApplyTestFilters(filters *TestFilters) {
+	specs := []*types.TestSpec{}
+	for _, spec := range gTestSpecs {
+		if len(spec.Criteria) == 0 {
+			if filters.hasCriteria != nil {
+				continue
+			}
+			if flagListNoCriteria && "" != filters.IsSelected(spec.Technique, spec.TestIndex, spec.TestGuid, spec.TestName, false) {
+				continue
+			}
+			specs = append(specs, spec)
+			continue
+		}
+
+		kept := []*types.AtomicTestCriteria{}
+		for _, rec := range spec.Criteria {
+			reason := filters.IsSelected(rec.Technique, fmt.Sprintf("%d", rec.TestIndex), rec.TestGuid, rec.TestName, true)
+			if len(reason) > 0 {
+				if gVerbose {
+					fmt.Println("filtered out", rec.Id(), reason)
+				}
+				continue
+			}
+			kept = append(kept, rec)
+		}
+		spec.Criteria = kept
+		if len(kept) > 0 {
+			specs = append(specs, spec)
+		}
+	}
+	gTestSpecs = specs
+}
+
+// PrintResolvedTests prints the tests that will be run
+func PrintResolvedTests() {
+	s := ""
+	num := 0
+	for _, spec := range gTestSpecs {
+		if len(spec.Criteria) == 0 {
+			if len(spec.TestIndex) > 0 || len(spec.TestName) > 0 {
+				s += fmt.Sprintf("  %9s %2s %-8s %-14s \"%s\"\n", spec.Technique, spec.TestIndex, ShortGuid(spec.TestGuid), "NoCriteria", spec.TestName)
+			}
+			continue
+		}
+		for _, rec := range spec.Criteria {
+			executor := ""
+			if test := GetAtomicTest(rec.Technique, fmt.Sprintf("%d", rec.TestIndex), rec.TestGuid, rec.TestName); test != nil && test.Executor != nil {
+				executor = test.Executor.Name
+				if test.Executor.ElevationRequired {
+					executor += ",elev"
+				}
+			}
+			s += fmt.Sprintf("  %9s %2d %-8s %-14s \"%s\"\n", rec.Technique, rec.TestIndex, ShortGuid(rec.TestGuid), executor, rec.TestName)
+			num += 1
+		}
+	}
+	fmt.Printf("Resolved %d tests to run:\n%s", num, s)
+}
+
+// PrintTestsWithoutCriteria prints the selected tests that have no criteria, for --listnocriteria
+func PrintTestsWithoutCriteria() {
+	s := ""
+	num := 0
+	for _, spec := range gTestSpecs {
+		if len(spec.Criteria) > 0 || (len(spec.TestIndex) == 0 && len(spec.TestName) == 0) {
+			continue
+		}
+		s += fmt.Sprintf("  %9s %2s %-8s \"%s\"\n", spec.Technique, spec.TestIndex, ShortGuid(spec.TestGuid), spec.TestName)
+		num += 1
+	}
+	fmt.Printf("%d tests without criteria:\n%s", num, s)
+}
+
+func ShortGuid(guid string) string {
+	if len(guid) > 8 {
+		return guid[0:8]
+	}
+	return guid
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+)
+
+const kTestFilterAtomicYaml = `
+attack_technique: T1562.004
+display_name: Disable or Modify System Firewall
+atomic_tests:
+- name: Disable iptables
+  auto_generated_guid: 7784c64e-ed0b-4b65-bf63-c86db229fd56
+  description: Stop the firewall
+  supported_platforms: [linux]
+  executor:
+    name: sh
+    elevation_required: true
+    command: systemctl stop iptables
+- name: Add rule with ufw
+  auto_generated_guid: b2563a4e-c4b8-429c-8d47-d5bcb227ba7a
+  description: Adds a rule
+  supported_platforms: [linux]
+  dependencies:
+  - description: ufw installed
+    prereq_command: which ufw
+  executor:
+    name: bash
+    command: ufw allow 1234
+`
+
+func TestSelectionFilters(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "T1562.004"), 0755)
+	os.WriteFile(filepath.Join(dir, "T1562.004", "T1562.004.yaml"), []byte(kTestFilterAtomicYaml), 0644)
+	flagAtomicsPath = dir
+	gAtomicYamls = map[string]*types.Atomic{}
+
+	excludePath := filepath.Join(dir, "exclude.txt")
+	os.WriteFile(excludePath, []byte("# host breaking\nT1562.004#7784c64e  # stops firewall\n\nT1529\n"), 0644)
+
+	gTestSpecs = []*types.TestSpec{{Technique: "T1000"}}
+	flagExcludeFilePath = excludePath
+	flagFilterExecutors = "!powershell"
+	defer func() {
+		flagExcludeFilePath = ""
+		flagFilterExecutors = ""
+		flagFilterElevated = ""
+	}()
+
+	filters, err := LoadTestFilters()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(gTestSpecs)) // exclude file does not add to run
+	assert.Equal(t, 2, len(filters.exclude))
+
+	assert.Equal(t, "excluded", filters.IsSelected("T1562.004", "1", "7784c64e-ed0b-4b65-bf63-c86db229fd56", "Disable iptables", true))
+	assert.Equal(t, "excluded", filters.IsSelected("T1529", "3", "", "Reboot", true))
+	assert.Equal(t, "excluded", filters.IsSelected("T1529.001", "1", "", "", true))
+	assert.NotEqual(t, "excluded", filters.IsSelected("T15290", "1", "", "", true))
+
+	// excluding a technique excludes its sub-techniques
+	filters.exclude = append(filters.exclude, &types.TestSpec{Technique: "T1562"})
+	assert.Equal(t, "excluded", filters.IsSelected("T1562.004", "2", "", "Add rule with ufw", true))
+	assert.Equal(t, "excluded", filters.IsSelected("T1562", "1", "", "", true))
+	filters.exclude = filters.exclude[:2]
+	assert.Equal(t, "", filters.IsSelected("T1562.004", "2", "", "Add rule with ufw", true))
+
+	flagExcludeFilePath = ""
+	flagFilterElevated = "false"
+	filters, err = LoadTestFilters()
+	assert.Nil(t, err)
+	assert.Equal(t, "elevated", filters.IsSelected("T1562.004", "1", "", "", true))
+	assert.Equal(t, "", filters.IsSelected("T1562.004", "2", "", "", true))
+
+	filters = &TestFilters{includeExecutors: []string{"bash"}}
+	assert.Equal(t, "executor sh", filters.IsSelected("T1562.004", "1", "", "", true))
+
+	flagFilterElevated = ""
+	flagFilterHasDeps = "true"
+	flagFilterMatch = "(?i)firewall"
+	filters, err = LoadTestFilters()
+	flagFilterHasDeps = ""
+	flagFilterMatch = ""
+	assert.Nil(t, err)
+	assert.Equal(t, "hasdeps", filters.IsSelected("T1562.004", "1", "", "", true))
+	assert.Equal(t, "match", filters.IsSelected("T1562.004", "2", "", "", true))
+
+	// filtering removes criteria of tests not selected
+
+	mkrec := func(index uint) *types.AtomicTestCriteria {
+		rec := &types.AtomicTestCriteria{}
+		rec.Technique = "T1562.004"
+		rec.TestIndex = index
+		return rec
+	}
+	gTestSpecs = []*types.TestSpec{{Technique: "T1562.004", Criteria: []*types.AtomicTestCriteria{mkrec(1), mkrec(2)}}}
+	ApplyTestFilters(&TestFilters{excludeExecutors: []string{"sh"}})
+	assert.Equal(t, 1, len(gTestSpecs[0].Criteria))
+	assert.Equal(t, uint(2), gTestSpecs[0].Criteria[0].TestIndex)
+
+	// hascriteria is a filter only, listing tests without criteria is --listnocriteria
+
+	flagFilterHasCriteria = "false"
+	_, err = LoadTestFilters()
+	flagFilterHasCriteria = ""
+	assert.NotNil(t, err)
+
+	noCriteria := &types.TestSpec{Technique: "T1562.004", TestIndex: "1"}
+	gTestSpecs = []*types.TestSpec{noCriteria, {Technique: "T1562.004", TestIndex: "2"}}
+	flagListNoCriteria = true
+	ApplyTestFilters(&TestFilters{excludeExecutors: []string{"sh"}})
+	flagListNoCriteria = false
+	assert.Equal(t, 1, len(gTestSpecs))
+	assert.Equal(t, "2", gTestSpecs[0].TestIndex)
+
+	gTestSpecs = []*types.TestSpec{noCriteria}
+	hasCriteria := true
+	ApplyTestFilters(&TestFilters{hasCriteria: &hasCriteria})
+	assert.Equal(t, 0, len(gTestSpecs))
+}
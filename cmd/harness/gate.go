@@ -0,0 +1,259 @@
+package main
+
+/*
+ * CI gate of a run.  --fail-on is a comma separated list of policies:
+ *   any-regression   a test has lower status than its minimum in --baseline,
+ *                    or a baseline test is missing from the run
+ *   any-notelemetry  a test has status NoTelemetry
+ *   coverage:X       less than X percent of tests are Validated, not counting
+ *                    tests that were skipped, unsafe, cancelled or missing prereqs
+ * --baseline alone implies any-regression.  Violations are listed at end of
+ * the summary, and the harness exits with kGateExitCode.
+ */
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+)
+
+const kGateExitCode = 3
+
+const kFailOnRegression = "any-regression"
+const kFailOnNoTelemetry = "any-notelemetry"
+const kFailOnCoveragePrefix = "coverage:"
+
+var flagBaseline string
+var flagFailOn string
+
+type GatePolicy struct {
+	failOnRegression  bool
+	failOnNoTelemetry bool
+	minCoverage       float64 // percent, 0 if not set
+	baseline          []types.BaselineEntry
+}
+
+var gGatePolicy *GatePolicy  // nil if no gate
+var gGateViolations []string // set at end of run by CheckGate
+var gGateChecked bool
+
+func init() {
+	flag.StringVar(&flagBaseline, "baseline", "", "path to baseline json of minimum status per test, or a previous resultsdir. Implies --fail-on any-regression")
+	flag.StringVar(&flagFailOn, "fail-on", "", "exit code "+strconv.Itoa(kGateExitCode)+" if: any-regression (see --baseline), any-notelemetry, coverage:X (percent Validated below X). comma separated")
+}
+
+/*
+ * LoadBaseline loads a json list of BaselineEntry, or status.json of
+ * a previous results dir, where status of each test is its minimum.
+ * With --repeat, the minimum is the lowest status of its iterations.
+ */
+func LoadBaseline(path string) ([]types.BaselineEntry, error) {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, "status.json")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	baseline := []types.BaselineEntry{}
+	if filepath.Base(path) == "status.json" {
+		progress := []types.TestProgress{}
+		if err = json.Unmarshal(data, &progress); err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", path, err)
+		}
+		indexes := map[string]int{}
+		for _, p := range progress {
+			if GetStatusRank(p.Status) < 0 {
+				continue
+			}
+			key := p.Technique + "#" + p.TestIndex + "#" + p.TestGuid
+			if i, ok := indexes[key]; ok {
+				prev, _ := types.ParseTestStatus(baseline[i].MinStatus)
+				if GetStatusRank(p.Status) < GetStatusRank(prev) {
+					baseline[i].MinStatus = p.Status.String()
+				}
+				continue
+			}
+			indexes[key] = len(baseline)
+			baseline = append(baseline, types.BaselineEntry{Technique: p.Technique, TestIndex: p.TestIndex, TestGuid: p.TestGuid, MinStatus: p.Status.String()})
+		}
+		return baseline, nil
+	}
+
+	if err = json.Unmarshal(data, &baseline); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", path, err)
+	}
+	for _, entry := range baseline {
+		if len(entry.Technique) == 0 || (len(entry.TestIndex) == 0 && len(entry.TestGuid) == 0) {
+			return nil, fmt.Errorf("baseline entry needs technique and test_index or test_guid: %v", entry)
+		}
+		if _, ok := types.ParseTestStatus(entry.MinStatus); !ok {
+			return nil, fmt.Errorf("unknown min_status '%s' for %s", entry.MinStatus, entry.Technique)
+		}
+	}
+	return baseline, nil
+}
+
+// ParseGateFlags returns nil if neither --baseline or --fail-on
+func ParseGateFlags(failOn string, baselinePath string) (*GatePolicy, error) {
+	if len(failOn) == 0 && len(baselinePath) == 0 {
+		return nil, nil
+	}
+	policy := &GatePolicy{}
+	if len(failOn) == 0 {
+		failOn = kFailOnRegression
+	}
+	for _, name := range strings.Split(failOn, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		switch {
+		case name == kFailOnRegression:
+			policy.failOnRegression = true
+		case name == kFailOnNoTelemetry:
+			policy.failOnNoTelemetry = true
+		case strings.HasPrefix(name, kFailOnCoveragePrefix):
+			val, err := strconv.ParseFloat(strings.TrimSuffix(name[len(kFailOnCoveragePrefix):], "%"), 64)
+			if err != nil || val <= 0 || val > 100 {
+				return nil, fmt.Errorf("--fail-on %s: coverage should be a percent, e.g. coverage:80", name)
+			}
+			policy.minCoverage = val
+		default:
+			return nil, fmt.Errorf("unknown --fail-on policy '%s'", name)
+		}
+	}
+	if policy.failOnRegression {
+		if len(baselinePath) == 0 {
+			return nil, fmt.Errorf("--fail-on %s requires --baseline", kFailOnRegression)
+		}
+		baseline, err := LoadBaseline(baselinePath)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load baseline: %v", err)
+		}
+		policy.baseline = baseline
+	}
+	return policy, nil
+}
+
+func CheckGateFlags() error {
+	policy, err := ParseGateFlags(flagFailOn, flagBaseline)
+	if err != nil {
+		return err
+	}
+	gGatePolicy = policy
+	return nil
+}
+
+func getGateTestName(criteria *types.AtomicTestCriteria, iteration int) string {
+	s := fmt.Sprintf("%s [%d] %s", criteria.Technique, criteria.TestIndex, criteria.TestName)
+	if iteration > 0 {
+		s += fmt.Sprintf(" #%d", iteration)
+	}
+	return s
+}
+
+func getBaselineEntryName(entry types.BaselineEntry) string {
+	if len(entry.TestIndex) > 0 {
+		return fmt.Sprintf("%s [%s]", entry.Technique, entry.TestIndex)
+	}
+	return entry.Technique + " " + entry.TestGuid
+}
+
+// GetValidatedCoverage returns percent of tests Validated, of tests not skipped
+func GetValidatedCoverage(tests []*SingleTestRun) (float64, int) {
+	numValidated, numCounted := 0, 0
+	for _, testRun := range tests {
+		if JUnitResult(testRun.status) == "skipped" {
+			continue
+		}
+		numCounted += 1
+		if testRun.status == types.StatusValidateSuccess {
+			numValidated += 1
+		}
+	}
+	if numCounted == 0 {
+		return 0, 0
+	}
+	return 100 * float64(numValidated) / float64(numCounted), numCounted
+}
+
+// GetGateViolations returns description of each violation of policy by tests
+func GetGateViolations(policy *GatePolicy, tests []*SingleTestRun) []string {
+	violations := []string{}
+
+	if policy.failOnRegression {
+		for _, entry := range policy.baseline {
+			minStatus, _ := types.ParseTestStatus(entry.MinStatus)
+			found := false
+			for _, testRun := range tests {
+				criteria := testRun.criteria
+				if criteria.Technique != entry.Technique {
+					continue
+				}
+				if len(entry.TestGuid) > 0 && criteria.TestGuid != entry.TestGuid {
+					continue
+				}
+				if len(entry.TestGuid) == 0 && fmt.Sprintf("%d", criteria.TestIndex) != entry.TestIndex {
+					continue
+				}
+				found = true
+				if GetStatusRank(testRun.status) < GetStatusRank(minStatus) {
+					violations = append(violations, fmt.Sprintf("regression: %s is %s, baseline %s", getGateTestName(criteria, testRun.iteration), testRun.status, minStatus))
+				}
+			}
+			if !found {
+				violations = append(violations, fmt.Sprintf("missing from run: %s, baseline %s", getBaselineEntryName(entry), minStatus))
+			}
+		}
+	}
+
+	if policy.failOnNoTelemetry {
+		for _, testRun := range tests {
+			if testRun.status == types.StatusValidateFail {
+				violations = append(violations, "NoTelemetry: "+getGateTestName(testRun.criteria, testRun.iteration))
+			}
+		}
+	}
+
+	if policy.minCoverage > 0 {
+		coverage, numCounted := GetValidatedCoverage(tests)
+		if coverage < policy.minCoverage {
+			violations = append(violations, fmt.Sprintf("coverage: %.1f%% of %d tests Validated, below %g%%", coverage, numCounted, policy.minCoverage))
+		}
+	}
+	return violations
+}
+
+// CheckGate sets gGateViolations at end of run.  Returns false if gate failed
+func CheckGate(tests []*SingleTestRun) bool {
+	if gGatePolicy == nil {
+		return true
+	}
+	gGateViolations = GetGateViolations(gGatePolicy, tests)
+	gGateChecked = true
+	return len(gGateViolations) == 0
+}
+
+func IsGateFailed() bool {
+	return len(gGateViolations) > 0
+}
+
+// SPrintGate returns gate result for end of summary, empty if not checked
+func SPrintGate() string {
+	if !gGateChecked {
+		return ""
+	}
+	if len(gGateViolations) == 0 {
+		return "=== Gate: passed\n"
+	}
+	s := fmt.Sprintf("=== Gate: FAILED, %d violations\n", len(gGateViolations))
+	for _, violation := range gGateViolations {
+		s += "!!! " + violation + "\n"
+	}
+	return s
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+)
+
+func TestGate(t *testing.T) {
+	dir := t.TempDir()
+	baselinePath := filepath.Join(dir, "baseline.json")
+	os.WriteFile(baselinePath, []byte(`[
+		{"technique": "T1070.004", "test_index": "1", "min_status": "Validated"},
+		{"technique": "T1070.004", "test_guid": "bbbb", "min_status": "partial"},
+		{"technique": "T1485", "test_index": "1", "min_status": "Partial"},
+		{"technique": "T1485", "test_guid": "eeee", "min_status": "Partial"},
+		{"technique": "T1529", "test_index": "3", "min_status": "Validated"}
+	]`), 0644)
+
+	tests := []*SingleTestRun{
+		newTestRun("T1070.004", 1, "aaaa", types.StatusValidatePartial),
+		newTestRun("T1070.004", 2, "bbbb", types.StatusValidateFail),
+		newTestRun("T1485", 1, "cccc", types.StatusValidateSuccess),
+		newTestRun("T1485", 2, "dddd", types.StatusSkipped),
+	}
+
+	policy, err := ParseGateFlags("", baselinePath)
+	assert.Nil(t, err)
+	assert.True(t, policy.failOnRegression)
+	assert.Equal(t, 5, len(policy.baseline))
+	assert.Equal(t, []string{
+		"regression: T1070.004 [1] test is Partial, baseline Validated",
+		"regression: T1070.004 [2] test is NoTelemetry, baseline Partial",
+		"missing from run: T1485 eeee, baseline Partial",
+		"missing from run: T1529 [3], baseline Validated",
+	}, GetGateViolations(policy, tests))
+
+	policy, err = ParseGateFlags("any-NoTelemetry, coverage:50", "")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"NoTelemetry: T1070.004 [2] test",
+		"coverage: 33.3% of 3 tests Validated, below 50%",
+	}, GetGateViolations(policy, tests))
+
+	policy, _ = ParseGateFlags("coverage:30%", "")
+	assert.Equal(t, 0, len(GetGateViolations(policy, tests)))
+
+	policy, err = ParseGateFlags("", "")
+	assert.Nil(t, err)
+	assert.Nil(t, policy)
+
+	_, err = ParseGateFlags("any-regression", "")
+	assert.NotNil(t, err)
+	_, err = ParseGateFlags("coverage:abc", "")
+	assert.NotNil(t, err)
+	_, err = ParseGateFlags("any-timeout", "")
+	assert.NotNil(t, err)
+	os.WriteFile(baselinePath, []byte(`[{"technique": "T1485", "test_index": "1", "min_status": "Great"}]`), 0644)
+	_, err = ParseGateFlags("", baselinePath)
+	assert.NotNil(t, err)
+
+	// previous results dir as baseline, skipped tests are left out
+	progress := []types.TestProgress{
+		{Technique: "T1485", TestIndex: "1", TestGuid: "cccc", Status: types.StatusValidateSuccess},
+		{Technique: "T1485", TestIndex: "2", TestGuid: "dddd", Status: types.StatusSkipped},
+	}
+	data, _ := json.Marshal(progress)
+	os.WriteFile(filepath.Join(dir, "status.json"), data, 0644)
+	baseline, err := LoadBaseline(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, []types.BaselineEntry{{Technique: "T1485", TestIndex: "1", TestGuid: "cccc", MinStatus: "Validated"}}, baseline)
+
+	// --repeat results dir, lowest status of iterations
+	progress = []types.TestProgress{
+		{Technique: "T1485", TestIndex: "1", TestGuid: "cccc", Iteration: 1, Status: types.StatusValidateSuccess},
+		{Technique: "T1485", TestIndex: "1", TestGuid: "cccc", Iteration: 2, Status: types.StatusValidatePartial},
+		{Technique: "T1485", TestIndex: "1", TestGuid: "cccc", Iteration: 3, Status: types.StatusValidateSuccess},
+		{Technique: "T1485", TestIndex: "2", TestGuid: "dddd", Iteration: 1, Status: types.StatusValidateSuccess},
+		{Technique: "T1485", TestIndex: "2", TestGuid: "dddd", Iteration: 2, Status: types.StatusSkipped},
+	}
+	data, _ = json.Marshal(progress)
+	os.WriteFile(filepath.Join(dir, "status.json"), data, 0644)
+	baseline, err = LoadBaseline(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, []types.BaselineEntry{
+		{Technique: "T1485", TestIndex: "1", TestGuid: "cccc", MinStatus: "Partial"},
+		{Technique: "T1485", TestIndex: "2", TestGuid: "dddd", MinStatus: "Validated"},
+	}, baseline)
+
+	gGatePolicy = &GatePolicy{failOnNoTelemetry: true}
+	defer func() { gGatePolicy, gGateViolations, gGateChecked = nil, nil, false }()
+	assert.False(t, CheckGate(tests))
+	assert.True(t, IsGateFailed())
+	assert.Equal(t, "=== Gate: FAILED, 1 violations\n!!! NoTelemetry: T1070.004 [2] test\n", SPrintGate())
+}
@@ -0,0 +1,472 @@
+package main
+
+/*
+ * Run history: at end of each run, status and match details of every test
+ * are added to the history store in --historydir, with host and agent
+ * metadata saved in run_info.json at start of run, so results can be
+ * queried across runs.  Cancelled runs are kept, but marked.
+ *
+ *   atomic-harness history ingest RESULTSDIR...   add previous runs
+ *   atomic-harness history test SPEC...           results of tests, e.g. T1053.003#2
+ *   atomic-harness history trend [TECHNIQUE...]   status counts per run
+ *   atomic-harness history failing [TECHNIQUE...] tests not Validated in latest
+ *                                                 run, and since when
+ */
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+	utils "github.com/secureworks/atomic-harness/pkg/utils"
+)
+
+const kHistoryTimeFormat = "2006-01-02 15:04"
+
+var flagHistoryDir string
+var flagNoHistory bool
+var flagAgentInfo string
+var flagHistoryFormat string
+
+func init() {
+	flag.StringVar(&flagHistoryDir, "historydir", "", "run history store, each run is added at end. Default is history dir next to results dir, e.g. ./testruns/history. See 'atomic-harness history'")
+	flag.BoolVar(&flagNoHistory, "nohistory", false, "do not add run to history store")
+	flag.StringVar(&flagAgentInfo, "agentinfo", "", "agent name and version for run history, e.g. \"edr 7.2.1\"")
+	flag.StringVar(&flagHistoryFormat, "historyformat", "text", "output of history queries: text or json")
+}
+
+// host tests ran on: --remote host, else local hostname
+func GetHistoryHost() string {
+	if len(flagRemote) > 0 {
+		host := flagRemote
+		if i := strings.LastIndex(host, "@"); i >= 0 {
+			host = host[i+1:]
+		}
+		return host
+	}
+	if len(gSysInfo.Hostname) > 0 {
+		return gSysInfo.Hostname
+	}
+	host, _ := os.Hostname()
+	return host
+}
+
+// SetRunInfoHost sets host, agent and telemetry tools of this run in info
+func SetRunInfoHost(info *types.RunInfo) {
+	info.Host = GetHistoryHost()
+	info.Platform = ""
+	if len(flagRemote) == 0 {
+		info.Platform = runtime.GOOS
+	}
+	info.Agent = flagAgentInfo
+	info.TelemetryTools = nil
+	for _, tool := range gTelemTools {
+		info.TelemetryTools = append(info.TelemetryTools, tool.Name)
+	}
+}
+
+// GetHistoryRecords returns run and test records of report, with metadata from run_info.json
+func GetHistoryRecords(report *Report, info *types.RunInfo) (*types.HistoryRun, []*types.HistoryTest) {
+	startTime := info.StartTime
+	run := &types.HistoryRun{ResultsDir: report.ResultsDir, StartTime: startTime, EndTime: info.EndTime, Host: info.Host, Platform: info.Platform,
+		Agent: info.Agent, TelemetryTools: info.TelemetryTools, Cancelled: info.Cancelled, Counts: map[string]int{}}
+
+	tests := []*types.HistoryTest{}
+	for _, test := range report.Tests {
+		p := &test.Progress
+		run.Counts[p.Status.String()] += 1
+		rec := &types.HistoryTest{Time: startTime, Technique: p.Technique, TestIndex: p.TestIndex, TestGuid: p.TestGuid,
+			TestName: p.TestName, Iteration: p.Iteration, Status: p.Status.String(), MatchString: test.MatchString}
+		for _, tool := range test.Tools {
+			if len(tool.Suffix) > 0 {
+				if rec.ToolMatchStrings == nil {
+					rec.ToolMatchStrings = map[string]string{}
+				}
+				rec.ToolMatchStrings[tool.Suffix] = tool.MatchString
+			}
+			if !IsValidatedStatus(p.Status) {
+				continue
+			}
+			for _, exp := range tool.Summary.TestData.ExpectedEvents {
+				if len(exp.Matches) == 0 {
+					rec.MissingEvents = append(rec.MissingEvents, GetToolEventName(tool.Suffix, exp))
+				}
+			}
+		}
+		tests = append(tests, rec)
+	}
+	return run, tests
+}
+
+// IngestRun adds results dir to history.  A run ingested again replaces previous
+func IngestRun(historyDir string, resultsDir string) error {
+	absDir, err := filepath.Abs(resultsDir)
+	if err != nil {
+		return err
+	}
+	report, err := LoadReport(absDir)
+	if err != nil {
+		return err
+	}
+	info, err := LoadRunInfo(absDir)
+	if err != nil {
+		// made before run_info.json existed. host and agent are unknown
+		info = &types.RunInfo{}
+		if fi, err := os.Stat(filepath.Join(absDir, "status.json")); err == nil {
+			info.StartTime = fi.ModTime().Unix()
+		}
+	}
+	run, tests := GetHistoryRecords(report, info)
+	run.IngestTime = time.Now().UnixNano()
+	return utils.AppendHistory(historyDir, run, tests)
+}
+
+// GetHistoryDir returns --historydir, or history in parent dir of resultsDir
+func GetHistoryDir(resultsDir string) string {
+	if len(flagHistoryDir) > 0 {
+		return flagHistoryDir
+	}
+	if len(resultsDir) == 0 {
+		return filepath.FromSlash("./testruns/history")
+	}
+	return filepath.Join(filepath.Dir(filepath.Clean(resultsDir)), "history")
+}
+
+// AddRunToHistory is called at end of run, unless --nohistory
+func AddRunToHistory(resultsDir string) {
+	if flagNoHistory {
+		return
+	}
+	historyDir := GetHistoryDir(resultsDir)
+	if err := IngestRun(historyDir, resultsDir); err != nil {
+		fmt.Println("ERROR: unable to add run to history", historyDir, err)
+		return
+	}
+	ChownToUser(historyDir)
+}
+
+// MatchHistorySpec returns true if test matches spec: technique, technique#index or technique#guid-prefix
+func MatchHistorySpec(test *types.HistoryTest, spec string) bool {
+	a := strings.SplitN(spec, "#", 2)
+	if test.Technique != a[0] {
+		return false
+	}
+	if len(a) == 1 {
+		return true
+	}
+	if len(a[1]) >= 8 {
+		return strings.HasPrefix(test.TestGuid, a[1])
+	}
+	return test.TestIndex == a[1]
+}
+
+// T1053 matches T1053 and its sub-techniques
+func matchHistoryTechniques(technique string, techniques []string) bool {
+	if len(techniques) == 0 {
+		return true
+	}
+	for _, t := range techniques {
+		if technique == t || strings.HasPrefix(technique, t+".") {
+			return true
+		}
+	}
+	return false
+}
+
+func getHistoryTestKey(test *types.HistoryTest) string {
+	if len(test.TestGuid) > 0 {
+		return test.Technique + "#" + test.TestGuid
+	}
+	return test.Technique + "#" + test.TestIndex
+}
+
+func formatHistoryTime(t int64) string {
+	if t == 0 {
+		return "never"
+	}
+	return time.Unix(t, 0).Format(kHistoryTimeFormat)
+}
+
+// status counts, Validated, Partial, NoTelemetry first
+func sprintStatusCounts(counts map[string]int) string {
+	names := []string{}
+	for name := range counts {
+		names = append(names, name)
+	}
+	order := map[string]int{"Validated": 1, "Partial": 2, "NoTelemetry": 3}
+	sort.Slice(names, func(i, j int) bool {
+		oi, oj := order[names[i]], order[names[j]]
+		if oi == 0 {
+			oi = 4
+		}
+		if oj == 0 {
+			oj = 4
+		}
+		if oi != oj {
+			return oi < oj
+		}
+		return names[i] < names[j]
+	})
+	parts := []string{}
+	for _, name := range names {
+		parts = append(parts, fmt.Sprintf("%s:%d", name, counts[name]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// GetTestHistory returns results of tests matching any of specs, in run order
+func GetTestHistory(tests []*types.HistoryTest, specs []string) []*types.HistoryTest {
+	retval := []*types.HistoryTest{}
+	for _, test := range tests {
+		for _, spec := range specs {
+			if MatchHistorySpec(test, spec) {
+				retval = append(retval, test)
+				break
+			}
+		}
+	}
+	return retval
+}
+
+func SPrintTestHistory(results []*types.HistoryTest, runs []*types.HistoryRun) string {
+	hosts := map[string]string{}
+	for _, run := range runs {
+		hosts[run.ResultsDir] = run.Host
+	}
+	keys := []string{}
+	byTest := map[string][]*types.HistoryTest{}
+	for _, test := range results {
+		key := getHistoryTestKey(test)
+		if _, ok := byTest[key]; !ok {
+			keys = append(keys, key)
+		}
+		byTest[key] = append(byTest[key], test)
+	}
+
+	s := ""
+	for _, key := range keys {
+		var lastValidated *types.HistoryTest
+		first := byTest[key][0]
+		s += fmt.Sprintf("=== %s [%s] %s %s\n", first.Technique, first.TestIndex, first.TestName, first.TestGuid)
+		for _, test := range byTest[key] {
+			iteration := ""
+			if test.Iteration > 0 {
+				iteration = fmt.Sprintf(" #%d", test.Iteration)
+			}
+			s += fmt.Sprintf("%s  %-16s %-12s %-16s %s%s\n", formatHistoryTime(test.Time), hosts[test.ResultsDir], test.Status, test.MatchString, filepath.Base(test.ResultsDir), iteration)
+			for _, name := range test.MissingEvents {
+				s += "    missing " + name + "\n"
+			}
+			if test.Status == types.StatusValidateSuccess.String() {
+				lastValidated = test
+			}
+		}
+		if lastValidated != nil {
+			s += fmt.Sprintf("Last Validated %s in %s\n", formatHistoryTime(lastValidated.Time), filepath.Base(lastValidated.ResultsDir))
+		} else {
+			s += "Never Validated\n"
+		}
+	}
+	if len(s) == 0 {
+		s = "No results in history\n"
+	}
+	return s
+}
+
+/*
+ * GetTechniqueTrends returns status counts per run for each technique,
+ * or of all tests if no techniques given.  Runs without tests of a
+ * technique are left out.
+ */
+func GetTechniqueTrends(runs []*types.HistoryRun, tests []*types.HistoryTest, techniques []string) []*types.TechniqueTrend {
+	if len(techniques) == 0 {
+		trend := &types.TechniqueTrend{Technique: "all"}
+		for _, run := range runs {
+			trend.Runs = append(trend.Runs, &types.TrendPoint{ResultsDir: run.ResultsDir, Time: run.StartTime, Host: run.Host, Cancelled: run.Cancelled, Counts: run.Counts})
+		}
+		return []*types.TechniqueTrend{trend}
+	}
+
+	runMap := map[string]*types.HistoryRun{}
+	for _, run := range runs {
+		runMap[run.ResultsDir] = run
+	}
+	trends := []*types.TechniqueTrend{}
+	byTechnique := map[string]*types.TechniqueTrend{}
+	for _, test := range tests {
+		if !matchHistoryTechniques(test.Technique, techniques) {
+			continue
+		}
+		trend, ok := byTechnique[test.Technique]
+		if !ok {
+			trend = &types.TechniqueTrend{Technique: test.Technique}
+			byTechnique[test.Technique] = trend
+			trends = append(trends, trend)
+		}
+		// tests are in run order
+		if len(trend.Runs) == 0 || trend.Runs[len(trend.Runs)-1].ResultsDir != test.ResultsDir {
+			run := runMap[test.ResultsDir]
+			trend.Runs = append(trend.Runs, &types.TrendPoint{ResultsDir: run.ResultsDir, Time: run.StartTime, Host: run.Host, Cancelled: run.Cancelled, Counts: map[string]int{}})
+		}
+		trend.Runs[len(trend.Runs)-1].Counts[test.Status] += 1
+	}
+	sort.SliceStable(trends, func(i, j int) bool { return trends[i].Technique < trends[j].Technique })
+	return trends
+}
+
+func SPrintTechniqueTrends(trends []*types.TechniqueTrend) string {
+	s := ""
+	for _, trend := range trends {
+		s += "=== " + trend.Technique + "\n"
+		for _, point := range trend.Runs {
+			cancelled := ""
+			if point.Cancelled {
+				cancelled = " (cancelled)"
+			}
+			s += fmt.Sprintf("%s  %-16s %-40s %s%s\n", formatHistoryTime(point.Time), point.Host, sprintStatusCounts(point.Counts), filepath.Base(point.ResultsDir), cancelled)
+		}
+	}
+	if len(s) == 0 {
+		s = "No results in history\n"
+	}
+	return s
+}
+
+/*
+ * GetFailingTests returns tests whose latest validated result is not
+ * Validated, with the first result since the last Validated one.
+ * Results that were skipped, cancelled, etc. or ran without telemetry
+ * validation are not considered, nor are results of cancelled runs.
+ */
+func GetFailingTests(runs []*types.HistoryRun, tests []*types.HistoryTest, techniques []string) []*types.FailingTest {
+	cancelledRuns := map[string]bool{}
+	for _, run := range runs {
+		if run.Cancelled {
+			cancelledRuns[run.ResultsDir] = true
+		}
+	}
+	keys := []string{}
+	byTest := map[string]*types.FailingTest{}
+	for _, test := range tests {
+		if !matchHistoryTechniques(test.Technique, techniques) || cancelledRuns[test.ResultsDir] {
+			continue
+		}
+		status, _ := types.ParseTestStatus(test.Status)
+		if !IsValidatedStatus(status) {
+			continue
+		}
+		key := getHistoryTestKey(test)
+		entry, ok := byTest[key]
+		if !ok {
+			entry = &types.FailingTest{Technique: test.Technique, TestIndex: test.TestIndex, TestGuid: test.TestGuid}
+			byTest[key] = entry
+			keys = append(keys, key)
+		}
+		entry.TestName = test.TestName
+		entry.Status = test.Status
+		if status == types.StatusValidateSuccess {
+			entry.LastValidated = test.Time
+			entry.FailingSince = 0
+			entry.NumFailing = 0
+			continue
+		}
+		if entry.NumFailing == 0 {
+			entry.FailingSince = test.Time
+		}
+		entry.NumFailing += 1
+	}
+
+	failing := []*types.FailingTest{}
+	for _, key := range keys {
+		if byTest[key].NumFailing > 0 {
+			failing = append(failing, byTest[key])
+		}
+	}
+	sort.SliceStable(failing, func(i, j int) bool {
+		if failing[i].Technique != failing[j].Technique {
+			return failing[i].Technique < failing[j].Technique
+		}
+		if len(failing[i].TestIndex) != len(failing[j].TestIndex) {
+			return len(failing[i].TestIndex) < len(failing[j].TestIndex)
+		}
+		return failing[i].TestIndex < failing[j].TestIndex
+	})
+	return failing
+}
+
+func SPrintFailingTests(failing []*types.FailingTest) string {
+	s := ""
+	for _, entry := range failing {
+		s += fmt.Sprintf("%-10s %2s %-12s since %s (%d results), last Validated %s  \"%s\"\n", entry.Technique, entry.TestIndex, entry.Status,
+			formatHistoryTime(entry.FailingSince), entry.NumFailing, formatHistoryTime(entry.LastValidated), entry.TestName)
+	}
+	return s + fmt.Sprintf("=== Failing:%d\n", len(failing))
+}
+
+func printHistoryResult(obj interface{}, text string) {
+	if flagHistoryFormat == "json" {
+		data, _ := json.MarshalIndent(obj, "", "  ")
+		fmt.Println(string(data))
+		return
+	}
+	fmt.Print(text)
+}
+
+// RunHistory is main() of history command
+func RunHistory(args []string) int {
+	if len(args) == 0 {
+		fmt.Println("usage: atomic-harness history [--historydir DIR] [--historyformat text|json] ingest RESULTSDIR... | test SPEC... | trend [TECHNIQUE...] | failing [TECHNIQUE...]")
+		return 2
+	}
+	if flagHistoryFormat != "text" && flagHistoryFormat != "json" {
+		fmt.Println("ERROR: unknown historyformat", flagHistoryFormat)
+		return 2
+	}
+	historyDir := GetHistoryDir(flagResultsPath)
+
+	cmd, args := args[0], args[1:]
+	if cmd == "ingest" {
+		for _, dir := range args {
+			if err := IngestRun(historyDir, dir); err != nil {
+				fmt.Println("ERROR: unable to ingest", dir, err)
+				return 1
+			}
+			fmt.Println("Added", dir, "to", historyDir)
+		}
+		ChownToUser(historyDir)
+		return 0
+	}
+
+	runs, tests, err := utils.LoadHistory(historyDir)
+	if err != nil {
+		fmt.Println("ERROR: unable to load history", historyDir, err)
+		return 1
+	}
+
+	switch cmd {
+	case "test":
+		if len(args) == 0 {
+			fmt.Println("ERROR: history test needs a test spec, e.g. T1053.003#2")
+			return 2
+		}
+		results := GetTestHistory(tests, args)
+		printHistoryResult(results, SPrintTestHistory(results, runs))
+	case "trend":
+		trends := GetTechniqueTrends(runs, tests, args)
+		printHistoryResult(trends, SPrintTechniqueTrends(trends))
+	case "failing":
+		failing := GetFailingTests(runs, tests, args)
+		printHistoryResult(failing, SPrintFailingTests(failing))
+	default:
+		fmt.Println("ERROR: unknown history command", cmd)
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+	utils "github.com/secureworks/atomic-harness/pkg/utils"
+)
+
+// results dir with two tests of T1053.003, started at startTime
+func writeHistoryResultsDir(t *testing.T, startTime int64, status1 types.TestStatus, status2 types.TestStatus) string {
+	dir := t.TempDir()
+	progress := []types.TestProgress{
+		{Technique: "T1053.003", TestIndex: "1", TestGuid: "435057fb-74b1", TestName: "Cron - Replace crontab", Status: status1},
+		{Technique: "T1053.003", TestIndex: "2", TestGuid: "b7d42afa-9086", TestName: "Cron - Add script", Status: status2},
+	}
+	data, _ := json.Marshal(progress)
+	os.WriteFile(filepath.Join(dir, "status.json"), data, 0644)
+	SaveRunInfo(dir, &types.RunInfo{StartTime: startTime, EndTime: startTime + 60, Host: "host1", Platform: "linux", Agent: "edr 7.2.1"})
+
+	testDir := filepath.Join(dir, GetReportTestDirName(&progress[1]))
+	os.Mkdir(testDir, 0755)
+	os.WriteFile(filepath.Join(testDir, "match_string.txt"), []byte("P<F>"), 0644)
+	summary := ExtractState{}
+	summary.TestData.ExpectedEvents = []*types.ExpectedEvent{
+		{EventType: "Process", Matches: []*types.SimpleEvent{{}}},
+		{EventType: "File", SubType: "WRITE", FieldChecks: []types.FieldCriteria{{FieldName: "path", Op: "~=", Value: "/etc/cron"}}},
+	}
+	data, _ = json.Marshal(summary)
+	os.WriteFile(filepath.Join(testDir, "validate_summary.json"), data, 0644)
+	return dir
+}
+
+func TestRunHistory(t *testing.T) {
+	historyDir := t.TempDir()
+	prevAgentInfo := flagAgentInfo
+	flagAgentInfo = "ingesting agent"
+	defer func() { flagAgentInfo = prevAgentInfo }()
+
+	// ingested out of order
+	run2 := writeHistoryResultsDir(t, 1700100000, types.StatusValidateSuccess, types.StatusValidatePartial)
+	run1 := writeHistoryResultsDir(t, 1700000000, types.StatusValidateSuccess, types.StatusValidateSuccess)
+	run3 := writeHistoryResultsDir(t, 1700200000, types.StatusSkipped, types.StatusValidateFail)
+	for _, dir := range []string{run2, run1, run3} {
+		assert.Nil(t, IngestRun(historyDir, dir))
+	}
+
+	runs, tests, err := utils.LoadHistory(historyDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(runs))
+	assert.Equal(t, 6, len(tests))
+	assert.Equal(t, run1, runs[0].ResultsDir)
+	assert.Equal(t, "edr 7.2.1", runs[0].Agent) // from run_info.json, not the ingesting process
+	assert.Equal(t, "host1", runs[0].Host)
+	assert.Equal(t, 2, runs[0].Counts["Validated"])
+	assert.Equal(t, run1, tests[0].ResultsDir)
+	assert.Equal(t, []string{"File WRITE path~=/etc/cron"}, tests[3].MissingEvents)
+	assert.Equal(t, "P<F>", tests[3].MatchString)
+
+	results := GetTestHistory(tests, []string{"T1053.003#2"})
+	assert.Equal(t, 3, len(results))
+	assert.Equal(t, "NoTelemetry", results[2].Status)
+	s := SPrintTestHistory(results, runs)
+	assert.Contains(t, s, "=== T1053.003 [2] Cron - Add script b7d42afa-9086\n")
+	assert.Contains(t, s, "    missing File WRITE path~=/etc/cron\n")
+	assert.Contains(t, s, "Last Validated "+formatHistoryTime(1700000000)+" in "+filepath.Base(run1))
+	assert.Equal(t, 3, len(GetTestHistory(tests, []string{"T1053.003#435057fb"})))
+	assert.Equal(t, 0, len(GetTestHistory(tests, []string{"T1053.002"})))
+
+	trends := GetTechniqueTrends(runs, tests, []string{"T1053"})
+	assert.Equal(t, 1, len(trends))
+	assert.Equal(t, "T1053.003", trends[0].Technique)
+	assert.Equal(t, 3, len(trends[0].Runs))
+	assert.Equal(t, map[string]int{"Validated": 1, "Partial": 1}, trends[0].Runs[1].Counts)
+	assert.Contains(t, SPrintTechniqueTrends(trends), "Validated:1 Partial:1")
+	assert.Equal(t, "all", GetTechniqueTrends(runs, tests, nil)[0].Technique)
+
+	failing := GetFailingTests(runs, tests, nil)
+	assert.Equal(t, 1, len(failing))
+	assert.Equal(t, "2", failing[0].TestIndex)
+	assert.Equal(t, "NoTelemetry", failing[0].Status)
+	assert.Equal(t, int64(1700100000), failing[0].FailingSince)
+	assert.Equal(t, 2, failing[0].NumFailing)
+	assert.Equal(t, int64(1700000000), failing[0].LastValidated)
+	assert.Contains(t, SPrintFailingTests(failing), "=== Failing:1\n")
+
+	// ingesting a run again replaces it
+	os.WriteFile(filepath.Join(run3, "status.json"), []byte(`[{"Technique":"T1053.003","TestIndex":"2","TestGuid":"b7d42afa-9086","Status":13}]`), 0644)
+	assert.Nil(t, IngestRun(historyDir, run3))
+	runs, tests, err = utils.LoadHistory(historyDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(runs))
+	assert.Equal(t, 5, len(tests))
+	assert.Equal(t, 0, len(GetFailingTests(runs, tests, nil)))
+
+	// cancelled run is kept, but not counted in failing tests
+	run4 := writeHistoryResultsDir(t, 1700300000, types.StatusValidateSuccess, types.StatusValidateFail)
+	info, _ := LoadRunInfo(run4)
+	info.Cancelled = true
+	SaveRunInfo(run4, info)
+	assert.Nil(t, IngestRun(historyDir, run4))
+	runs, tests, err = utils.LoadHistory(historyDir)
+	assert.Nil(t, err)
+	assert.True(t, runs[3].Cancelled)
+	assert.Equal(t, 0, len(GetFailingTests(runs, tests, nil)))
+	assert.Contains(t, SPrintTechniqueTrends(GetTechniqueTrends(runs, tests, nil)), filepath.Base(run4)+" (cancelled)\n")
+}
+
+func TestGetHistoryDir(t *testing.T) {
+	assert.Equal(t, filepath.FromSlash("./testruns/history"), GetHistoryDir(""))
+	assert.Equal(t, filepath.FromSlash("testruns/history"), GetHistoryDir(filepath.FromSlash("./testruns/harness-results-456317467")))
+	assert.Equal(t, filepath.FromSlash("/var/results/history"), GetHistoryDir(filepath.FromSlash("/var/results/run1/")))
+
+	flagHistoryDir = "/tmp/history"
+	defer func() { flagHistoryDir = "" }()
+	assert.Equal(t, "/tmp/history", GetHistoryDir(filepath.FromSlash("/var/results/run1")))
+}
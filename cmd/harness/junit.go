@@ -0,0 +1,191 @@
+package main
+
+/*
+ * junit.xml in results dir, for CI systems.  One testsuite per technique,
+ * and one testcase per test run.  Validated, and tests that ran without
+ * telemetry validation, pass.  Tests that were skipped, refused by safety
+ * policy, cancelled or missing prereqs are skipped.  Anything else is a
+ * failure, with match string, missing expected events and the end of
+ * runner-stdout.txt in the message.
+ */
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+)
+
+const kJUnitFileName = "junit.xml"
+const kJUnitStdoutLines = 20
+const kJUnitStdoutBytes = 4096
+
+type JUnitTestSuites struct {
+	XMLName  xml.Name          `xml:"testsuites"`
+	Name     string            `xml:"name,attr"`
+	Tests    int               `xml:"tests,attr"`
+	Failures int               `xml:"failures,attr"`
+	Skipped  int               `xml:"skipped,attr"`
+	Time     float64           `xml:"time,attr"`
+	Suites   []*JUnitTestSuite `xml:"testsuite"`
+}
+
+type JUnitTestSuite struct {
+	Name     string           `xml:"name,attr"` // technique
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     float64          `xml:"time,attr"`
+	Cases    []*JUnitTestCase `xml:"testcase"`
+}
+
+type JUnitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *JUnitMessage `xml:"failure,omitempty"`
+	Skipped   *JUnitMessage `xml:"skipped,omitempty"`
+}
+
+type JUnitMessage struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Text    string `xml:",chardata"`
+}
+
+// JUnitResult returns "pass", "failure" or "skipped" for status
+func JUnitResult(status types.TestStatus) string {
+	switch status {
+	case types.StatusValidateSuccess, types.StatusTestSuccess:
+		return "pass"
+	case types.StatusSkipped, types.StatusUnsafe, types.StatusCancelled, types.StatusPreReqFail:
+		return "skipped"
+	}
+	return "failure"
+}
+
+// e.g. "File WRITE path=/etc/ufw/ufw.conf"
+func DescribeExpectedEvent(exp *types.ExpectedEvent) string {
+	parts := []string{exp.EventType}
+	if len(exp.SubType) > 0 {
+		parts = append(parts, exp.SubType)
+	}
+	for _, fc := range exp.FieldChecks {
+		parts = append(parts, fc.FieldName+fc.Op+fc.Value)
+	}
+	if exp.IsMaybe {
+		parts = append(parts, "(maybe)")
+	}
+	return strings.Join(parts, " ")
+}
+
+// last lines of runner-stdout.txt of test, limited in size
+func GetRunnerStdoutExcerpt(testRun *SingleTestRun) string {
+	data, err := os.ReadFile(filepath.FromSlash(testRun.resultsDir + "/runner-stdout.txt"))
+	if err != nil {
+		return ""
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) > kJUnitStdoutLines {
+		lines = lines[len(lines)-kJUnitStdoutLines:]
+	}
+	s := strings.Join(lines, "\n")
+	if len(s) > kJUnitStdoutBytes {
+		s = s[len(s)-kJUnitStdoutBytes:]
+	}
+	return s
+}
+
+func GetJUnitTestCase(testRun *SingleTestRun) *JUnitTestCase {
+	criteria := testRun.criteria
+	tc := &JUnitTestCase{ClassName: criteria.Technique}
+	tc.Name = fmt.Sprintf("[%d] %s", criteria.TestIndex, criteria.TestName)
+	if testRun.iteration > 0 {
+		tc.Name += fmt.Sprintf(" #%d", testRun.iteration)
+	}
+	tc.Time = testRun.runnerSeconds
+	if tc.Time == 0 && testRun.EndTime > testRun.StartTime {
+		tc.Time = float64(testRun.EndTime-testRun.StartTime) / 1e9 // run_summary times are nanoseconds
+	}
+
+	switch JUnitResult(testRun.status) {
+	case "skipped":
+		msg := testRun.status.String()
+		if testRun.status == types.StatusUnsafe {
+			msg += ": " + testRun.unsafeRule
+		}
+		tc.Skipped = &JUnitMessage{Message: msg}
+	case "failure":
+		msg := testRun.status.String()
+		text := "status: " + testRun.status.String() + "\n"
+		if len(testRun.matchString) > 0 {
+			msg += " " + testRun.matchString
+			text += "match string: " + testRun.matchString + "\n"
+		}
+		missing := []string{}
+		if IsValidatedStatus(testRun.status) {
+			for _, exp := range criteria.ExpectedEvents {
+				if len(exp.Matches) == 0 {
+					missing = append(missing, DescribeExpectedEvent(exp))
+				}
+			}
+		}
+		if len(missing) > 0 {
+			msg += fmt.Sprintf(", %d expected events missing", len(missing))
+			text += "missing expected events:\n  " + strings.Join(missing, "\n  ") + "\n"
+		}
+		if stdout := GetRunnerStdoutExcerpt(testRun); len(stdout) > 0 {
+			text += "runner-stdout.txt:\n" + stdout + "\n"
+		}
+		tc.Failure = &JUnitMessage{Message: msg, Type: testRun.status.String(), Text: text}
+	}
+	return tc
+}
+
+// GetJUnitReport groups test runs by technique, in run order
+func GetJUnitReport(tests []*SingleTestRun) *JUnitTestSuites {
+	report := &JUnitTestSuites{Name: "atomic-harness"}
+	suites := map[string]*JUnitTestSuite{}
+
+	for _, testRun := range tests {
+		technique := testRun.criteria.Technique
+		suite, ok := suites[technique]
+		if !ok {
+			suite = &JUnitTestSuite{Name: technique}
+			suites[technique] = suite
+			report.Suites = append(report.Suites, suite)
+		}
+		tc := GetJUnitTestCase(testRun)
+		suite.Cases = append(suite.Cases, tc)
+		suite.Tests += 1
+		suite.Time += tc.Time
+		if tc.Failure != nil {
+			suite.Failures += 1
+		} else if tc.Skipped != nil {
+			suite.Skipped += 1
+		}
+	}
+	for _, suite := range report.Suites {
+		report.Tests += suite.Tests
+		report.Failures += suite.Failures
+		report.Skipped += suite.Skipped
+		report.Time += suite.Time
+	}
+	return report
+}
+
+func WriteJUnitReport(tests []*SingleTestRun) {
+	data, err := xml.MarshalIndent(GetJUnitReport(tests), "", "  ")
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		return
+	}
+	outPath := filepath.FromSlash(flagResultsPath + "/" + kJUnitFileName)
+	err = os.WriteFile(outPath, append([]byte(xml.Header), append(data, '\n')...), 0644)
+	if err != nil {
+		fmt.Println("ERROR: unable to write file", outPath, err)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+)
+
+func TestJUnitReport(t *testing.T) {
+	dir := t.TempDir()
+	prevResultsPath := flagResultsPath
+	flagResultsPath = dir
+	defer func() { flagResultsPath = prevResultsPath }()
+
+	mkrun := func(technique string, index uint, status types.TestStatus) *SingleTestRun {
+		rec := &types.AtomicTestCriteria{}
+		rec.Technique = technique
+		rec.TestIndex = index
+		rec.TestName = "test " + technique
+		resultsDir := filepath.Join(dir, fmt.Sprintf("%s_%d", technique, index))
+		os.Mkdir(resultsDir, 0755)
+		return &SingleTestRun{criteria: rec, status: status, resultsDir: resultsDir, runnerSeconds: 1.5}
+	}
+
+	validated := mkrun("T1070.004", 1, types.StatusValidateSuccess)
+	partial := mkrun("T1070.004", 2, types.StatusValidatePartial)
+	partial.matchString = "P<F>"
+	partial.criteria.ExpectedEvents = []*types.ExpectedEvent{
+		{EventType: "Process", Matches: []*types.SimpleEvent{{}}},
+		{EventType: "File", SubType: "DELETE", FieldChecks: []types.FieldCriteria{{FieldName: "path", Op: "~=", Value: "/tmp/victim"}}},
+	}
+	lines := []string{}
+	for i := 0; i < 30; i++ {
+		lines = append(lines, fmt.Sprintf("line %d", i))
+	}
+	lines[29] = "rm: cannot remove '/tmp/victim'"
+	os.WriteFile(filepath.Join(partial.resultsDir, "runner-stdout.txt"), []byte(strings.Join(lines, "\n")+"\n"), 0644)
+	unsafe := mkrun("T1485", 1, types.StatusUnsafe)
+	unsafe.unsafeRule = "deny,rm -rf /"
+	timeout := mkrun("T1485", 2, types.StatusTestTimeout)
+
+	WriteJUnitReport([]*SingleTestRun{validated, partial, unsafe, timeout})
+
+	data, err := os.ReadFile(filepath.Join(dir, kJUnitFileName))
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(data), xml.Header))
+
+	report := &JUnitTestSuites{}
+	assert.Nil(t, xml.Unmarshal(data, report))
+	assert.Equal(t, 4, report.Tests)
+	assert.Equal(t, 2, report.Failures)
+	assert.Equal(t, 1, report.Skipped)
+	assert.Equal(t, 6.0, report.Time)
+	assert.Equal(t, 2, len(report.Suites))
+
+	suite := report.Suites[0]
+	assert.Equal(t, "T1070.004", suite.Name)
+	assert.Equal(t, 1, suite.Failures)
+	assert.Nil(t, suite.Cases[0].Failure)
+	assert.Nil(t, suite.Cases[0].Skipped)
+
+	failure := suite.Cases[1].Failure
+	assert.NotNil(t, failure)
+	assert.Equal(t, "[2] test T1070.004", suite.Cases[1].Name)
+	assert.Equal(t, "T1070.004", suite.Cases[1].ClassName)
+	assert.Equal(t, "Partial P<F>, 1 expected events missing", failure.Message)
+	assert.Contains(t, failure.Text, "File DELETE path~=/tmp/victim")
+	assert.NotContains(t, failure.Text, "Process")
+	assert.Contains(t, failure.Text, "rm: cannot remove '/tmp/victim'")
+	assert.NotContains(t, failure.Text, "line 9\n") // only last lines of stdout
+	assert.Contains(t, failure.Text, "line 10\n")
+
+	suite = report.Suites[1]
+	assert.Equal(t, "Unsafe: deny,rm -rf /", suite.Cases[0].Skipped.Message)
+	assert.Equal(t, "Timeout", suite.Cases[1].Failure.Type)
+}
@@ -17,6 +17,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -29,11 +30,24 @@ type SingleTestRun struct {
 	exitCode    int
 	status      types.TestStatus
 	matchString string // output from telemetry tool shows which expected event types matched
+	isCleanedUp bool   // runner reported cleanup stage succeeded
+	iteration   int    // with --repeat, 1-based
+	unsafeRule  string // safety policy rule that refused the test
+	isDirty     bool   // runner found residue after cleanup, see run_summary.json
+
+	namespaces map[string]string // with --isolate, ids of namespaces test ran in
+
+	runnerSeconds float64                 // wall time of runner, see metrics.go
+	eventCounts   map[string]*EventCounts // tool suffix -> expected events matched, missed
 
 	criteria *types.AtomicTestCriteria
 
-	resultsDir string
-	workingDir string
+	resultsDir   string
+	workingDir   string
+	telemetryDir string // location of telemetry files, see GetTelemetryDir()
+
+	fetchStartTime int64 // unix seconds, range for per-test telemetry fetch
+	fetchEndTime   int64
 
 	StartTime int64 // timestamps returned by goartrun for test
 	EndTime   int64
@@ -44,6 +58,8 @@ type SingleTestRun struct {
 	TimeWorkDirCreate int64
 	TimeWorkDirDelete int64
 	HasMitreTag       bool
+
+	lineagePids map[int64]bool // shell and descendants, see IsInTestLineage()
 }
 
 type TelemTool struct {
@@ -63,13 +79,24 @@ var flagResultsPath string
 var flagGoArtRunnerPath string
 var flagTelemetryToolPath string
 var flagTechniquesFilePath string
+var flagTactics string
 var flagServerConfigsCsvPath string
 var flagRegularRunUser string
 var flagRetryFailed string
 var flagRevalidate string
+var flagResume string
 var flagClearTelemetryCache bool
 var flagFilterByGoartrunShell bool
 var flagFilterFileEventsTmp bool
+var flagNumJobs int
+var flagFetchPerTest bool
+var flagTimeoutSeconds int
+var flagStageTimeoutSeconds int
+var flagPauseSeconds int
+var flagTelemetryWaitSeconds int
+var flagTelemetryPollSeconds int
+var flagPrereqCacheDir string
+var flagIsolate bool
 
 var gTestSpecs []*types.TestSpec = []*types.TestSpec{}
 var gRecs []*types.AtomicTestCriteria = []*types.AtomicTestCriteria{} // our detection rules
@@ -80,11 +107,13 @@ var gServerConfigs = map[string]string{}
 var gTechniquesMissingTests = []string{}
 var gMitreTechniqueNames = map[string]string{} // loaded from data/linux_techniques.csv
 var gFlagNoRun = false
-var gKeepRunning = true
+var gKeepRunning atomic.Bool // false after Ctrl-C, set by RunSignalHandler() while tests run
 var gAtomicTests = map[string][]*types.TestSpec{} // tid -> tests
 var gTelemTools = []*TelemTool{}
 
 func init() {
+	gKeepRunning.Store(true)
+
 	flag.StringVar(&flagCriteriaPath, "criteriapath", "", "path to folder containing CSV files used to validate telemetry")
 	flag.StringVar(&flagAtomicsPath, "atomicspath", "", "path to local atomics folder")
 	flag.StringVar(&flagResultsPath, "resultspath", "", "path to folder holding results. Will be generated relative to current dir if empty")
@@ -92,6 +121,7 @@ func init() {
 	flag.StringVar(&flagGoArtRunnerPath, "goartpath", "", "path to runner binary")
 	flag.StringVar(&flagTelemetryToolPath, "telemetrytoolpath", "", "path to telemetry tool binary")
 	flag.StringVar(&flagTechniquesFilePath, "runlist", "", "path to file containing list of techniques to run. CSV or newline-delimited text")
+	flag.StringVar(&flagTactics, "tactic", "", "comma-delimited list of tactics to run all tests of. Id (TA0003) or name (persistence)")
 	flag.StringVar(&flagServerConfigsCsvPath, "serverscsv", "", "path to CSV file containing list of servers referenced in detection rules")
 	flag.StringVar(&flagRegularRunUser, "username", "", "Optional username for running unpriviledged tests")
 
@@ -100,9 +130,19 @@ func init() {
 	flag.BoolVar(&gFlagNoRun, "norun", false, "exit without running any tests")
 	flag.StringVar(&flagRetryFailed, "retryfailed", "", "path to previous resultsdir, re-run tests not Validated or Skipped")
 	flag.StringVar(&flagRevalidate, "revalidate", "", "path to previous resultsdir, re-run validation")
+	flag.StringVar(&flagResume, "resume", "", "path to resultsdir of interrupted run. Runs tests not completed in same resultsdir, then fetches telemetry for entire run")
 	flag.BoolVar(&flagClearTelemetryCache, "telemetryclear", false, "if true, will call telemetry tool to clear cache")
 	flag.BoolVar(&flagFilterByGoartrunShell, "filtergoartsh", true, "if true, do not validate events before/after goartrun test shell")
+	flag.IntVar(&flagNumJobs, "jobs", 1, "number of tests to run in parallel. Tests with CFG,exclusive criteria always run alone. When > 1, telemetry is attributed to tests using process lineage")
+	flag.IntVar(&flagTimeoutSeconds, "timeout", 30, "default seconds before goartrun kills test stage of a test. Criteria can override with CFG,timeout,N")
+	flag.IntVar(&flagStageTimeoutSeconds, "stagetimeout", 15, "default seconds before goartrun kills prereq or cleanup stage of a test. Criteria can override with CFG,stagetimeout,N")
+	flag.IntVar(&flagPauseSeconds, "pause", 3, "default seconds to sleep in-between tests. Criteria can override with CFG,pause,N")
+	flag.BoolVar(&flagFetchPerTest, "fetchpertest", false, "if true, fetch and validate telemetry after each test, polling the telemetry tool until all expected events are found or telemetrywait seconds pass")
+	flag.IntVar(&flagTelemetryWaitSeconds, "telemetrywait", kWaitTelemetrySeconds, "with fetchpertest, max seconds to wait for telemetry of a test")
+	flag.IntVar(&flagTelemetryPollSeconds, "telemetrypoll", 5, "with fetchpertest, seconds in-between telemetry fetches")
 	flag.BoolVar(&flagFilterFileEventsTmp, "filtergoartdir", true, "if true, do not validate events before/after create and delete of goartrun working dir. Working dir is in /tmp, so if that is not in the file monitoring paths of endpoint agent, set this to false.")
+	flag.BoolVar(&flagIsolate, "isolate", false, "linux: runner runs each test in new mount, pid, uts, network namespaces on an overlay of the root filesystem, so writes are discarded. Requires root")
+	flag.StringVar(&flagPrereqCacheDir, "prereqcache", "", "dir populated by atrutil --prereqcache. Runner serves cached urls of get_prereq commands from it, for offline hosts")
 }
 
 /*
@@ -113,6 +153,8 @@ T1027.001#1
 T1027.002#2
 
 "T1027.002,Binary packed by UPX, with modified headers (linux)""
+
+TA0009 or collection   (all tests of tactic)
 */
 func ParseTestSpecs(techniques []string) bool {
 	if len(techniques) == 0 {
@@ -120,6 +162,13 @@ func ParseTestSpecs(techniques []string) bool {
 	}
 
 	for _, str := range techniques {
+		if tactic := FindTactic(str); tactic != nil {
+			if 0 == AddTestsForTactic(tactic) {
+				fmt.Println("no tests found for tactic", tactic.Id, tactic.ShortName)
+			}
+			continue
+		}
+
 		if len(str) < 4 || str[0] != 'T' {
 			fmt.Println("ERROR unknown test spec format:", str)
 			return false
@@ -269,11 +318,15 @@ func LoadCriteriaFiles(dirPath string, atomicMap *map[string][]*types.TestSpec)
 			fmt.Println("Loading " + f.Name())
 		}
 
+		numRecs := len(gRecs)
 		err := LoadFile(filepath.FromSlash(dirPath+"/"+f.Name()), atomicMap)
 		if err != nil {
 			fmt.Println("ERROR:", err)
 			return false
 		}
+		for _, rec := range gRecs[numRecs:] {
+			WarnIfRevoked(rec.Technique, f.Name())
+		}
 	}
 
 	return true
@@ -547,9 +600,11 @@ func FetchTelemetry(resultsDir string, startTime, endTime int64) {
 		}
 
 		fmt.Println("launching ", cmd.String())
+		fetchStart := time.Now()
 		output, err := cmd.CombinedOutput()
 
 		exitCode := cmd.ProcessState.ExitCode()
+		RecordTelemetryFetch(tool, time.Since(fetchStart), exitCode)
 		status := types.TestStatus(exitCode)
 
 		//look for StateValidateSuccess, etc.
@@ -584,12 +639,31 @@ func UpdateTimestampsFromRunSummary(testRun *SingleTestRun) {
 		return
 	}
 
+	gStateMutex.Lock()
+	defer gStateMutex.Unlock()
+
 	testRun.StartTime = runSpec.StartTime
 	testRun.EndTime = runSpec.EndTime
+	testRun.isCleanedUp = runSpec.IsCleanedUp
+	testRun.unsafeRule = runSpec.UnsafeRule
+	testRun.isDirty = runSpec.IsDirty
+	testRun.namespaces = runSpec.Namespaces
 }
 
 // echo runSpecJson | ./bin/goart --config -
 
+func SetRunnerExitStatus(testRun *SingleTestRun, cmd *exec.Cmd) {
+	gStateMutex.Lock()
+	testRun.exitCode = cmd.ProcessState.ExitCode()
+	testRun.status = types.TestStatus(testRun.exitCode)
+	if testRun.exitCode < 0 && false == gKeepRunning.Load() {
+		// killed by signal, see RunSignalHandler()
+		testRun.status = types.StatusCancelled
+	}
+	gStateMutex.Unlock()
+	fmt.Printf("runner exited with code %d %s\n", testRun.exitCode, testRun.status)
+}
+
 func GoArtRunTestWin(testRun *SingleTestRun, runSpecJson string) {
 
 	runSpecJson = filepath.FromSlash(runSpecJson)
@@ -601,9 +675,9 @@ func GoArtRunTestWin(testRun *SingleTestRun, runSpecJson string) {
 
 	// launch shell
 
-	output, err := cmd.CombinedOutput()
+	output, err := RunRunner(cmd)
 	if err != nil {
-		fmt.Errorf("  runner error: %w", err)
+		fmt.Println("  runner error:", err)
 	} else {
 		fmt.Println("  runner finished without error")
 	}
@@ -616,9 +690,7 @@ func GoArtRunTestWin(testRun *SingleTestRun, runSpecJson string) {
 		fmt.Println("ERROR: unable to write file", outPath, err)
 	}
 
-	testRun.exitCode = cmd.ProcessState.ExitCode()
-	testRun.status = types.TestStatus(testRun.exitCode)
-	fmt.Printf("runner exited with code %d %s\n", testRun.exitCode, testRun.status)
+	SetRunnerExitStatus(testRun, cmd)
 }
 
 func GoArtRunTest(testRun *SingleTestRun, runSpecJson string) {
@@ -630,7 +702,7 @@ func GoArtRunTest(testRun *SingleTestRun, runSpecJson string) {
 
 	dest, err := cmd.StdinPipe()
 	if err != nil {
-		fmt.Errorf("executing runner: %w", err)
+		fmt.Println("executing runner:", err)
 		return
 	}
 	_, err = io.WriteString(dest, runSpecJson)
@@ -640,9 +712,9 @@ func GoArtRunTest(testRun *SingleTestRun, runSpecJson string) {
 
 	// launch shell
 
-	output, err := cmd.CombinedOutput()
+	output, err := RunRunner(cmd)
 	if err != nil {
-		fmt.Errorf("  runner error: %w", err)
+		fmt.Println("  runner error:", err)
 	} else {
 		fmt.Println("  runner finished without error")
 	}
@@ -655,9 +727,7 @@ func GoArtRunTest(testRun *SingleTestRun, runSpecJson string) {
 		fmt.Println("ERROR: unable to write file", outPath, err)
 	}
 
-	testRun.exitCode = cmd.ProcessState.ExitCode()
-	testRun.status = types.TestStatus(testRun.exitCode)
-	fmt.Printf("runner exited with code %d %s\n", testRun.exitCode, testRun.status)
+	SetRunnerExitStatus(testRun, cmd)
 }
 
 /**
@@ -720,7 +790,11 @@ ResultsDir string
 Inputs     map[string]string
 */
 func BuildRunSpec(spec *types.AtomicTestCriteria, atomicTempDir string, resultsDir string) string {
-	obj := types.RunSpec{}
+	return WriteRunSpec(NewRunSpec(spec, atomicTempDir, resultsDir), resultsDir)
+}
+
+func NewRunSpec(spec *types.AtomicTestCriteria, atomicTempDir string, resultsDir string) *types.RunSpec {
+	obj := &types.RunSpec{}
 	obj.Technique = spec.Technique
 	obj.TestGuid = spec.TestGuid
 	obj.TestIndex = int(spec.TestIndex - 1)
@@ -729,7 +803,33 @@ func BuildRunSpec(spec *types.AtomicTestCriteria, atomicTempDir string, resultsD
 	obj.ResultsDir, _ = filepath.Abs(filepath.FromSlash(resultsDir))
 	obj.Inputs = spec.Args
 	obj.Username = flagRegularRunUser
+	obj.TimeoutSeconds = flagTimeoutSeconds
+	if spec.TimeoutSeconds > 0 {
+		obj.TimeoutSeconds = spec.TimeoutSeconds
+	}
+	obj.StageTimeoutSeconds = flagStageTimeoutSeconds
+	if spec.StageTimeoutSeconds > 0 {
+		obj.StageTimeoutSeconds = spec.StageTimeoutSeconds
+	}
+	obj.Unsafe = flagUnsafe
+	if len(flagSafetyPolicyPath) > 0 {
+		obj.SafetyPolicyPath, _ = filepath.Abs(filepath.FromSlash(flagSafetyPolicyPath))
+	}
+	obj.SkipResidueCheck = flagSkipResidueCheck
+	obj.ResiduePaths = GetCriteriaPaths(spec)
+	obj.ResidueFilesOnly = IsParallelRun()
+	obj.Isolate = flagIsolate
+	if len(flagPrereqCacheDir) > 0 {
+		obj.PrereqCacheDir, _ = filepath.Abs(filepath.FromSlash(flagPrereqCacheDir))
+	}
+	return obj
+}
 
+/*
+ * WriteRunSpec saves runspec.json in resultsDir
+ * @return json for goartrun stdin, or on windows, path to file
+ */
+func WriteRunSpec(obj *types.RunSpec, resultsDir string) string {
 	os.Mkdir(obj.ResultsDir, 0777)
 
 	j, err := json.MarshalIndent(obj, "", "  ")
@@ -782,7 +882,7 @@ func SaveState(tests []*SingleTestRun) {
 
 	progress := []types.TestProgress{}
 	for _, t := range tests {
-		obj := types.TestProgress{t.criteria.Technique, fmt.Sprintf("%d", t.criteria.TestIndex), t.criteria.TestName, t.criteria.TestGuid, t.state, t.exitCode, t.status}
+		obj := types.TestProgress{Technique: t.criteria.Technique, TestIndex: fmt.Sprintf("%d", t.criteria.TestIndex), TestName: t.criteria.TestName, TestGuid: t.criteria.TestGuid, State: t.state, ExitCode: t.exitCode, Status: t.status, IsCleanedUp: t.isCleanedUp, Iteration: t.iteration, UnsafeRule: t.unsafeRule, IsDirty: t.isDirty, Namespaces: t.namespaces}
 		progress = append(progress, obj)
 	}
 	j, err := json.MarshalIndent(progress, "", "  ")
@@ -808,6 +908,8 @@ func SaveState(tests []*SingleTestRun) {
 		fmt.Println("ERROR: unable to write file", outPath, err)
 	}
 
+	WriteMetrics(tests)
+
 }
 
 func SPrintState(tests []*SingleTestRun, byCategory bool) string {
@@ -817,6 +919,11 @@ func SPrintState(tests []*SingleTestRun, byCategory bool) string {
 	numSkipped := 0
 	numRunErrors := 0
 	numMissingDeps := 0
+	numTimeouts := 0
+	numCancelled := 0
+	numNotCleanedUp := 0
+	numUnsafe := 0
+	numDirty := 0
 
 	s := ""
 	for _, tid := range gTechniquesMissingTests {
@@ -837,12 +944,37 @@ func SPrintState(tests []*SingleTestRun, byCategory bool) string {
 			numMissingDeps += 1
 		case types.StatusSkipped:
 			numSkipped += 1
+		case types.StatusTestTimeout:
+			numTimeouts += 1
+		case types.StatusCancelled:
+			numCancelled += 1
+			if false == t.isCleanedUp {
+				numNotCleanedUp += 1
+			}
+		case types.StatusUnsafe:
+			numUnsafe += 1
 		default:
 			numRunErrors += 1
 		}
 
+		matchString := t.matchString
+		if t.status == types.StatusCancelled {
+			matchString = "cleaned"
+			if false == t.isCleanedUp {
+				matchString = "NOT-CLEANED"
+			}
+		} else if t.status == types.StatusUnsafe {
+			matchString = t.unsafeRule
+		}
+
+		dirty := ""
+		if t.isDirty {
+			dirty = " dirty"
+			numDirty += 1
+		}
+
 		strState := fmt.Sprintf("%s%s", t.state, t.status)
-		line := fmt.Sprintf("-%9s %2d %s %-12s %-16s \"%s\"\n", t.criteria.Technique, t.criteria.TestIndex, t.state, t.status, t.matchString, t.criteria.TestName)
+		line := fmt.Sprintf("-%9s %2d %s %-12s %-16s \"%s\"%s\n", t.criteria.Technique, t.criteria.TestIndex, t.state, t.status, matchString, t.criteria.TestName, dirty)
 		a, ok := byState[strState]
 		if !ok {
 			a = []string{}
@@ -857,8 +989,22 @@ func SPrintState(tests []*SingleTestRun, byCategory bool) string {
 		}
 	}
 
-	s += fmt.Sprintf("=== Validated:%d Partial:%d NoTelemetry:%d Skipped:%d RunErrors:%d MissingDeps:%d NoTests:%d\n",
-		numValidated, numPartial, numValidateFail, numSkipped, numRunErrors, numMissingDeps, len(gTechniquesMissingTests))
+	if byCategory {
+		s += SPrintTacticSummary(tests)
+	}
+	if IsRepeatRun() {
+		s += SPrintFlakySummary(tests)
+	}
+
+	s += fmt.Sprintf("=== Validated:%d Partial:%d NoTelemetry:%d Skipped:%d RunErrors:%d Timeouts:%d Cancelled:%d Unsafe:%d MissingDeps:%d NoTests:%d\n",
+		numValidated, numPartial, numValidateFail, numSkipped, numRunErrors, numTimeouts, numCancelled, numUnsafe, numMissingDeps, len(gTechniquesMissingTests))
+	if numNotCleanedUp > 0 {
+		s += fmt.Sprintf("!!! %d cancelled tests were NOT cleaned up\n", numNotCleanedUp)
+	}
+	if numDirty > 0 {
+		s += fmt.Sprintf("!!! %d tests were dirty after cleanup, see residue in run_summary.json\n", numDirty)
+	}
+	s += SPrintGate()
 
 	return s
 }
@@ -979,6 +1125,10 @@ func LoadFile(filename string, atomicMap *map[string][]*types.TestSpec) error {
 				cur.Infos = append(cur.Infos, row[1])
 			case "!!!":
 				cur.Warnings = append(cur.Warnings, row[1])
+			case "CFG":
+				if err := utils.ApplyConfigRow(cur, row); err != nil {
+					fmt.Println("ERROR:", cur.Id(), err)
+				}
 			default:
 				fmt.Println("ENTRY", row[0])
 			}
@@ -1010,6 +1160,7 @@ func LoadTechniquesList(filename string) error {
 		if len(tid) == 0 || tid[0] != 'T' {
 			continue
 		}
+		WarnIfRevoked(tid, filename)
 
 		num := AddTestsForTechniqueUsingAtomicsIndex(tid)
 		if num == 0 {
@@ -1026,137 +1177,154 @@ func LoadTechniquesList(filename string) error {
 func RunTests() {
 	numTestsRun := 0
 	testRuns := []*SingleTestRun{}
+	pool := NewTestRunPool(flagNumJobs, &testRuns)
+	if IsParallelRun() && !flagSkipResidueCheck {
+		fmt.Println("WARNING: with --jobs > 1, residue check is only of files of each test. Crontabs, systemd units, users and listening sockets are not checked")
+	}
 
-	startTime := time.Now().Unix()
-
-	for _, spec := range gTestSpecs {
-
-		for _, rec := range spec.Criteria {
-
-			resultsDir := filepath.FromSlash(flagResultsPath + "/" + rec.Technique + "_" + fmt.Sprintf("%d", rec.TestIndex) + "_" + rec.TestGuid)
-			err := os.MkdirAll(resultsDir, 0777)
-			if err != nil {
-				fmt.Println("unable to make results dir", err)
-				os.Exit(1)
-			}
+	runInfo := NewRunInfo(time.Now().Unix())
+	if len(runInfo.Host) == 0 {
+		SetRunInfoHost(runInfo)
+	}
+	SaveRunInfo(flagResultsPath, runInfo)
+	startTime := runInfo.StartTime
 
-			testRun := &SingleTestRun{}
-			testRun.criteria = rec
-			testRun.resultsDir = resultsDir
-			testRun.state = types.StateCriteriaLoaded
-			testRuns = append(testRuns, testRun)
+	for _, item := range GetTestIterations() {
+		rec := item.criteria
 
-			SaveState(testRuns)
+		resultsDir := GetTestResultsDir(rec, item.iteration)
+		err := os.MkdirAll(resultsDir, 0777)
+		if err != nil {
+			fmt.Println("unable to make results dir", err)
+			os.Exit(1)
+		}
 
-			if ShouldBeSkipped(rec) {
-				fmt.Println("Test Warning - skipping", testRun.criteria.Technique, testRun.criteria.TestName)
-				fmt.Println("   " + testRun.criteria.Warnings[0])
-				MarkAsSkipped(testRun)
-				SaveState(testRuns)
-				continue
-			}
+		testRun := &SingleTestRun{}
+		testRun.criteria = rec
+		testRun.resultsDir = resultsDir
+		testRun.state = types.StateCriteriaLoaded
+		testRun.iteration = item.iteration
 
-			workingDir, err := os.MkdirTemp("", "artwork-"+spec.Technique+"_"+fmt.Sprintf("%d", testRun.criteria.TestIndex)+"-")
-			if err != nil {
-				fmt.Println("unable to make working dir", err)
-				os.Exit(1)
+		if len(flagResume) > 0 && ResumeTestRun(testRun) {
+			pool.Add(testRun)
+			if testRun.state == types.StateRunnerFinished {
+				numTestsRun += 1 // needs validation
 			}
+			continue
+		}
 
-			testRun.workingDir = workingDir
-
-			// load atomic to get default args
-			utils.LoadAtomicDefaultArgs(rec, filepath.FromSlash(flagAtomicsPath), gVerbose)
-
-			// some test Args and field checks need variable substitutions
-
-			if false == SubstituteSysInfoArgs(rec) || false == SubstituteVarsInCriteria(testRun.criteria) {
-				MarkAsSkipped(testRun)
-				SaveState(testRuns)
-				continue
+		if ShouldBeSkipped(rec) {
+			fmt.Println("Test Warning - skipping", testRun.criteria.Technique, testRun.criteria.TestName)
+			fmt.Println("   " + testRun.criteria.Warnings[0])
+			MarkAsSkipped(testRun)
+			if gFlagNoRun {
+				AddToPlan(testRun, testRun.criteria.Warnings[0])
 			}
+			pool.Add(testRun)
+			continue
+		}
 
-			runConfig := BuildRunSpec(rec, workingDir, resultsDir)
-			if runConfig == "" {
-				fmt.Println("empty runconfig!, skipping", rec)
-				continue
-			}
+		testRun.fetchStartTime = time.Now().Unix() - 1
 
-			if runtime.GOOS == "windows" {
-				os.Chmod(workingDir, 0600)
-				os.Chmod(resultsDir, 0600)
-			} else {
-				os.Chmod(workingDir, 0777) // runner cleans up workingDir
-				os.Chmod(resultsDir, 0777)
-			}
+		workingDir, err := os.MkdirTemp("", "artwork-"+rec.Technique+"_"+fmt.Sprintf("%d", testRun.criteria.TestIndex)+"-")
+		if err != nil {
+			fmt.Println("unable to make working dir", err)
+			os.Exit(1)
+		}
 
-			if !gFlagNoRun {
-				testRun.state = types.StateRunnerLaunched
-				SaveState(testRuns)
+		testRun.workingDir = workingDir
 
-				if runtime.GOOS == "windows" {
-					GoArtRunTestWin(testRun, runConfig)
-				} else {
-					GoArtRunTest(testRun, runConfig)
-				}
-				testRun.state = types.StateRunnerFinished
+		// load atomic to get default args
+		utils.LoadAtomicDefaultArgs(rec, filepath.FromSlash(flagAtomicsPath), gVerbose)
 
-				UpdateTimestampsFromRunSummary(testRun)
+		// some test Args and field checks need variable substitutions
 
-				SaveState(testRuns)
+		if false == SubstituteSysInfoArgs(rec) || false == SubstituteVarsInCriteria(testRun.criteria) {
+			MarkAsSkipped(testRun)
+			if gFlagNoRun {
+				AddToPlan(testRun, "unable to substitute variables in args or criteria")
 			}
-			numTestsRun += 1
+			FinishTestRun(testRun)
+			pool.Add(testRun)
+			continue
+		}
 
-			// fix permissions after run
-			if runtime.GOOS != "windows" {
-				os.Chmod(resultsDir, 0755)
+		runSpec := NewRunSpec(rec, workingDir, resultsDir)
+		runConfig := WriteRunSpec(runSpec, resultsDir)
+		if runConfig == "" {
+			fmt.Println("empty runconfig!, skipping", rec)
+			if gFlagNoRun {
+				AddToPlan(testRun, "unable to build runspec")
 			}
+			FinishTestRun(testRun)
+			pool.Add(testRun)
+			continue
+		}
 
-			// runner will try to clean up, but may not be able to with lowered privs
-			err = os.RemoveAll(workingDir)
-			if err != nil {
-				fmt.Println("Failed to delete working dir", workingDir, err)
+		if violation := CheckTestSafety(testRun); violation != nil {
+			MarkAsUnsafe(testRun, violation)
+			if gFlagNoRun {
+				AddToPlan(testRun, "unsafe: "+violation.String())
 			}
+			FinishTestRun(testRun)
+			pool.Add(testRun)
+			continue
+		}
 
-			if false == gKeepRunning {
-				break
-			}
+		if runtime.GOOS == "windows" {
+			os.Chmod(workingDir, 0600)
+			os.Chmod(resultsDir, 0600)
+		} else {
+			os.Chmod(workingDir, 0777) // runner cleans up workingDir
+			os.Chmod(resultsDir, 0777)
+		}
 
-			// sleep a few seconds in-between tests
-			// want to avoid confusing telemetry of one test with the other
-			// TODO: careful with netflows, they are batched. telemetry tool filter by process?
+		pool.Add(testRun)
 
-			if !gFlagNoRun {
-				time.Sleep(3 * time.Second)
-			}
+		if !gFlagNoRun {
+			pool.Run(testRun, runSpec, runConfig)
+		} else {
+			AddToPlan(testRun, "")
+			FinishTestRun(testRun)
 		}
-		if false == gKeepRunning {
+		numTestsRun += 1
+
+		if false == gKeepRunning.Load() {
 			break
 		}
 	}
+	pool.Wait()
 	endTime := time.Now().Unix()
 
+	runInfo.EndTime = endTime
+	runInfo.Cancelled = false == gKeepRunning.Load()
+	SaveRunInfo(flagResultsPath, runInfo)
+
 	// fix ownership of results dirs
-	username := os.Getenv("SUDO_USER")
-	if username == "" {
-		username = os.Getenv("USER")
-	}
-	if username != "" && username != "root" && runtime.GOOS != "windows" {
-		cmd := exec.Command("chown", "-R", username+":"+username, flagResultsPath)
-		_, err := cmd.CombinedOutput()
-		if err != nil {
-			fmt.Println("failed to chown resultsdir", err)
-		}
-	}
+	ChownToUser(flagResultsPath)
 
 	if runtime.GOOS != "windows" {
-		username = os.Getenv("USERNAME")
 		os.Chmod(flagResultsPath, 0755)
 	}
 
+	if false == gFlagNoRun && false == gKeepRunning.Load() {
+		// record cancelled tests
+		for _, testRun := range testRuns {
+			WriteTestRunStatusFile(testRun)
+		}
+		SaveState(testRuns)
+	}
+
 	// now get telemetry
-	if false == gFlagNoRun && true == gKeepRunning {
+	if false == gFlagNoRun && true == gKeepRunning.Load() {
 		if 0 == numTestsRun {
 			fmt.Println("no tests were run, exiting without looking for telemetry")
+		} else if flagFetchPerTest {
+			// telemetry was fetched and validated as each test finished
+			for _, testRun := range testRuns {
+				WriteTestRunStatusFile(testRun)
+			}
+			SaveState(testRuns)
 		} else {
 			FetchTelemetry(flagResultsPath, startTime, endTime)
 
@@ -1177,22 +1345,53 @@ func RunTests() {
 		}
 	}
 
+	if gFlagNoRun {
+		WritePlan()
+	}
+
+	if IsRepeatRun() {
+		WriteRepeatSummary(testRuns)
+	}
+	if false == gFlagNoRun {
+		if gGatePolicy != nil {
+			CheckGate(testRuns)
+			SaveState(testRuns) // status.txt with gate result
+		}
+		WriteJUnitReport(testRuns)
+		if err := WriteReports(flagResultsPath); err != nil {
+			fmt.Println("ERROR: unable to write reports", err)
+		}
+		AddRunToHistory(flagResultsPath)
+	}
+
 	fmt.Println("Done. Output in", flagResultsPath)
 	fmt.Println(SPrintState(testRuns, true))
 }
 
+/*
+ * First signal stops launching tests, and asks running goartrun
+ * processes to cancel, which skips the rest of the test but still runs
+ * cleanup.  A second signal kills the runners without cleanup.
+ */
 func RunSignalHandler() {
 	c := make(chan os.Signal, 2)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
 	// Block until a signal is received.
-	// Unfortunately, this does not prevent runner CMD from getting
-	// interrupted and closing without waiting for script to exit
 
 	s := <-c
 	fmt.Println("*** Received SIGINT:", s, " ***")
-	fmt.Println(" skipping the rest of tests and telemetry")
-	gKeepRunning = false
+	fmt.Println(" skipping the rest of tests and telemetry. running tests will be cancelled and cleaned up")
+	fmt.Println(" interrupt again to kill runners without cleanup")
+	gKeepRunning.Store(false)
+	SignalRunners(false)
+
+	s = <-c
+	fmt.Println("*** Received", s, "again, killing runners ***")
+	SignalRunners(true)
+
+	// a third will terminate the harness
+	signal.Stop(c)
 }
 
 /*
@@ -1293,11 +1492,35 @@ func Revalidate(prevResultsDir string) {
 		WriteTestRunStatusFile(testRun)
 		SaveState(testRuns)
 	}
+	if gGatePolicy != nil {
+		CheckGate(testRuns)
+		SaveState(testRuns) // status.txt with gate result
+	}
+	WriteJUnitReport(testRuns)
+	if err := WriteReports(flagResultsPath); err != nil {
+		fmt.Println("ERROR: unable to write reports", err)
+	}
+	AddRunToHistory(flagResultsPath)
 
 	fmt.Println("Done. Output in", flagResultsPath)
 	fmt.Println(SPrintState(testRuns, true))
 }
 
+// ChownToUser gives path to user that ran harness with sudo
+func ChownToUser(path string) {
+	username := os.Getenv("SUDO_USER")
+	if username == "" {
+		username = os.Getenv("USER")
+	}
+	if username != "" && username != "root" && runtime.GOOS != "windows" {
+		cmd := exec.Command("chown", "-R", username+":"+username, path)
+		_, err := cmd.CombinedOutput()
+		if err != nil {
+			fmt.Println("failed to chown", path, err)
+		}
+	}
+}
+
 func GetToolNameAndSuffixFromPath(path string) (string, string) {
 	retval := ""
 	_, name := filepath.Split(path)
@@ -1333,9 +1556,55 @@ func PrepTelemTools(arg string) []*TelemTool {
 
 func main() {
 
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		flag.CommandLine.Parse(os.Args[2:])
+		os.Exit(RunServer())
+	}
+	if len(os.Args) > 1 && os.Args[1] == "compare" {
+		flag.CommandLine.Parse(os.Args[2:])
+		os.Exit(RunCompare(flag.Args()))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "history" {
+		flag.CommandLine.Parse(os.Args[2:])
+		os.Exit(RunHistory(flag.Args()))
+	}
+
 	flag.Parse()
 	flagTechniques := flag.Args()
 
+	if len(flagConfigPath) > 0 {
+		tests, err := ApplyHarnessConfig(flag.CommandLine, flagConfigPath, flagConfigProfile)
+		if err != nil {
+			fmt.Println("ERROR loading config", err)
+			os.Exit(1)
+		}
+		if len(flagTechniques) == 0 {
+			flagTechniques = tests
+		}
+	} else if len(flagConfigProfile) > 0 {
+		fmt.Println("ERROR: --profile requires --config")
+		os.Exit(1)
+	}
+
+	if err := CheckRepeatFlags(); err != nil {
+		fmt.Println("ERROR:", err)
+		os.Exit(1)
+	}
+
+	if len(flagReport) > 0 {
+		if err := WriteReports(flagReport); err != nil {
+			fmt.Println("ERROR: unable to write reports", err)
+			os.Exit(1)
+		}
+		fmt.Println("Wrote", filepath.Join(flagReport, kReportFileName), "and", kNavigatorLayerFileName)
+		return
+	}
+
+	if err := CheckGateFlags(); err != nil {
+		fmt.Println("ERROR:", err)
+		os.Exit(1)
+	}
+
 	FillInToolPathDefaults()
 
 	err := GetSysInfo(gSysInfo)
@@ -1349,6 +1618,14 @@ func main() {
 		fmt.Println(gSysInfo)
 	}
 
+	if len(flagResume) > 0 {
+		flagResultsPath = flagResume
+		if flagFetchPerTest {
+			fmt.Println("--fetchpertest is ignored with --resume, telemetry is fetched for entire run")
+			flagFetchPerTest = false
+		}
+	}
+
 	if "" == flagResultsPath {
 
 		var err error
@@ -1367,6 +1644,15 @@ func main() {
 
 	}
 
+	// keep config of original run when resuming
+
+	if len(flagRevalidate) == 0 {
+		_, err := os.Stat(filepath.FromSlash(flagResultsPath + "/harness_config.yaml"))
+		if len(flagResume) == 0 || err != nil {
+			WriteEffectiveConfig(flag.CommandLine, flagResultsPath, flagTechniques)
+		}
+	}
+
 	gTelemTools = PrepTelemTools(flagTelemetryToolPath)
 
 	err = utils.LoadAtomicsIndexCsv(filepath.FromSlash(flagAtomicsPath), &gAtomicTests)
@@ -1375,11 +1661,16 @@ func main() {
 		os.Exit(1)
 	}
 
-	// TODO: update for each platform
 	// Since there isn't full ATR test coverage, get list of ALL techniques
 	// for the platform.
 
-	utils.LoadMitreTechniqueCsv(filepath.FromSlash("./data/linux_techniques.csv"), &gMitreTechniqueNames)
+	if false == LoadMitreData() {
+		os.Exit(1)
+	}
+
+	if false == LoadSafetyPolicy() {
+		os.Exit(1)
+	}
 
 	// Criteria files contain the expected telemetry details
 
@@ -1409,12 +1700,25 @@ func main() {
 		LoadSpecsForRevalidate(flagRevalidate, &gTestSpecs)
 	}
 
+	if len(flagResume) > 0 && false == LoadSpecsForResume(flagResume) {
+		fmt.Println("unable to resume run in", flagResume)
+		os.Exit(2)
+	}
+
 	// parse list of wild-carded techniques user wants to execute
 
 	if false == ParseTestSpecs(flagTechniques) {
 		//return
 	}
 
+	if len(flagTactics) > 0 && false == AddTestsForTactics(flagTactics) {
+		os.Exit(1)
+	}
+
+	for _, spec := range gTestSpecs {
+		WarnIfRevoked(spec.Technique, "test specs")
+	}
+
 	if len(gTestSpecs) == 0 {
 		fmt.Println("No test specs specified. exiting")
 		return
@@ -1437,16 +1741,57 @@ func main() {
 
 	if len(flagRevalidate) > 0 {
 		Revalidate(flagRevalidate)
+		if IsGateFailed() {
+			os.Exit(kGateExitCode)
+		}
 		return
 	}
 
+	// resumed run keeps selection of original run
+
+	if len(flagResume) == 0 {
+		filters, err := LoadTestFilters()
+		if err != nil {
+			fmt.Println("ERROR:", err)
+			os.Exit(1)
+		}
+		ApplyTestFilters(filters)
+		if flagListNoCriteria {
+			PrintTestsWithoutCriteria()
+			return
+		}
+		PrintResolvedTests()
+	}
+
 	if gFlagNoRun {
-		fmt.Println("--norun specified. exiting without running tests")
+		fmt.Println("--norun specified. writing execution plan without running tests")
 	} else {
 		go RunSignalHandler()
+	}
 
+	if len(flagRemote) > 0 {
+		if flagPreflight {
+			fmt.Println("ERROR: --preflight is not supported with --remote")
+			os.Exit(1)
+		}
+		if !gFlagNoRun && false == PrepareRemote() {
+			os.Exit(1)
+		}
+	}
+
+	if flagPreflight {
+		RunPreflight()
+		if false == gKeepRunning.Load() {
+			return
+		}
+	}
+
+	if !gFlagNoRun {
 		CallTelemetryPrepare(flagClearTelemetryCache)
 	}
 	RunTests()
 
+	if IsGateFailed() {
+		os.Exit(kGateExitCode)
+	}
 }
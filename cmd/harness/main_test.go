@@ -1,11 +1,26 @@
 package main
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+	utils "github.com/secureworks/atomic-harness/pkg/utils"
 )
 
+// newTestRun returns a run of a test, with criteria of only the test ids and name "test"
+func newTestRun(technique string, index uint, guid string, status types.TestStatus) *SingleTestRun {
+	rec := &types.AtomicTestCriteria{}
+	rec.Technique = technique
+	rec.TestIndex = index
+	rec.TestGuid = guid
+	rec.TestName = "test"
+	return &SingleTestRun{criteria: rec, status: status}
+}
+
 func TestTelemTools(t *testing.T) {
 	tools := []*TelemTool{}
 
@@ -14,5 +29,44 @@ func TestTelemTools(t *testing.T) {
 	assert.Equal(t, "telemtool", tools[0].Name)
 	assert.Equal(t, "", tools[0].Suffix)
 	assert.Equal(t, "telemtool_e2e.exe", tools[1].Name)
-	assert.Equal(t, "e2e", tools[1].Suffix)
+	assert.Equal(t, "_e2e", tools[1].Suffix)
+}
+
+func TestCriteriaConfigRows(t *testing.T) {
+	rec := utils.AtomicTestCriteriaNew("T1560.001", "linux", "1", "Compress Data for Exfiltration")
+
+	assert.Nil(t, utils.ApplyConfigRow(rec, []string{"CFG", "timeout", "120"}))
+	assert.Nil(t, utils.ApplyConfigRow(rec, []string{"CFG", "exclusive"}))
+	assert.NotNil(t, utils.ApplyConfigRow(rec, []string{"CFG", "stagetimeout", "abc"}))
+	assert.NotNil(t, utils.ApplyConfigRow(rec, []string{"CFG", "nosuchthing", "1"}))
+	assert.Equal(t, 120, rec.TimeoutSeconds)
+	assert.Equal(t, 0, rec.StageTimeoutSeconds)
+	assert.True(t, rec.Exclusive)
+
+	flagPauseSeconds = 3
+	assert.Equal(t, 3, GetPauseSeconds(rec))
+	assert.Nil(t, utils.ApplyConfigRow(rec, []string{"CFG", "pause", "0"}))
+	assert.Equal(t, 0, GetPauseSeconds(rec))
+}
+
+func TestIsolateNamespaces(t *testing.T) {
+	dir := t.TempDir()
+	rec := utils.AtomicTestCriteriaNew("T1070.004", "linux", "1", "Delete a single file")
+
+	flagIsolate = true
+	defer func() { flagIsolate = false }()
+	assert.True(t, NewRunSpec(rec, dir, dir).Isolate)
+
+	os.WriteFile(filepath.Join(dir, "run_summary.json"), []byte(`{"Namespaces":{"mnt":"4026532205","net":"4026532208"}}`), 0644)
+	testRun := &SingleTestRun{criteria: rec, resultsDir: dir, state: types.StateDone, status: types.StatusTestSuccess}
+	UpdateTimestampsFromRunSummary(testRun)
+	assert.Equal(t, map[string]string{"mnt": "4026532205", "net": "4026532208"}, testRun.namespaces)
+
+	prevResultsPath := flagResultsPath
+	flagResultsPath = dir
+	defer func() { flagResultsPath = prevResultsPath }()
+	SaveState([]*SingleTestRun{testRun})
+	data, err := os.ReadFile(filepath.Join(dir, "status.json"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), `"net": "4026532208"`)
 }
@@ -0,0 +1,232 @@
+package main
+
+/*
+ * Prometheus metrics of a run, in text exposition format.  metrics.prom is
+ * written to results dir along with status.json, and to --metricsfile for
+ * the node_exporter textfile collector.  In serve mode, /metrics has the
+ * metrics of the current or last run.
+ *
+ *   atomic_harness_tests{technique,status}                           gauge
+ *   atomic_harness_expected_events{technique,tool_suffix,
+ *                                  event_type,result}                gauge
+ *   atomic_harness_runner_duration_seconds{technique,test,iteration} gauge
+ *   atomic_harness_telemetry_fetch_duration_seconds{tool_suffix}     summary
+ *   atomic_harness_telemetry_fetches_total{tool_suffix,exit_code}    counter
+ *   atomic_harness_telemetry_tool_exit_code{tool_suffix}             gauge, of last fetch
+ *
+ * iteration label is only present with --repeat.
+ */
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+)
+
+const kMetricsFileName = "metrics.prom"
+const kCorrelationEventType = "C" // as in match_string
+
+var flagMetricsFile string
+
+// expected events of a test, for one telemetry tool
+type EventCounts struct {
+	Matched map[string]int // simple schema type, e.g. "P", -> count
+	Missed  map[string]int
+}
+
+type fetchMetrics struct {
+	count        int
+	seconds      float64
+	lastExitCode int
+	exitCodes    map[int]int
+}
+
+var gFetchMetrics = map[string]*fetchMetrics{} // tool suffix ->
+var gFetchMetricsMutex sync.Mutex
+
+func init() {
+	flag.StringVar(&flagMetricsFile, "metricsfile", "", "also write prometheus metrics to file, e.g. for node_exporter textfile collector. Written as run progresses")
+}
+
+// RecordTelemetryFetch adds a fetch by telemetry tool to metrics
+func RecordTelemetryFetch(tool *TelemTool, duration time.Duration, exitCode int) {
+	gFetchMetricsMutex.Lock()
+	defer gFetchMetricsMutex.Unlock()
+
+	m, ok := gFetchMetrics[tool.Suffix]
+	if !ok {
+		m = &fetchMetrics{exitCodes: map[int]int{}}
+		gFetchMetrics[tool.Suffix] = m
+	}
+	m.count += 1
+	m.seconds += duration.Seconds()
+	m.lastExitCode = exitCode
+	m.exitCodes[exitCode] += 1
+}
+
+// GetEventCounts returns expected events of criteria, by simple schema type, matched or missed
+func GetEventCounts(criteria *types.MitreTestCriteria) *EventCounts {
+	counts := &EventCounts{Matched: map[string]int{}, Missed: map[string]int{}}
+	for _, exp := range criteria.ExpectedEvents {
+		if len(exp.Matches) == 0 {
+			counts.Missed[GetTelemChar(exp)] += 1
+		} else {
+			counts.Matched[GetTelemChar(exp)] += 1
+		}
+	}
+	for _, exp := range criteria.ExpectedCorrelations {
+		if exp.IsMet {
+			counts.Matched[kCorrelationEventType] += 1
+		} else {
+			counts.Missed[kCorrelationEventType] += 1
+		}
+	}
+	return counts
+}
+
+// escapes label value for exposition format
+func promLabelValue(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return strings.ReplaceAll(s, "\n", `\n`)
+}
+
+// returns {a="1",b="2"} for name,value pairs
+func promLabels(pairs ...string) string {
+	parts := []string{}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, pairs[i]+`="`+promLabelValue(pairs[i+1])+`"`)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func promHeader(sb *strings.Builder, name string, metricType string, help string) {
+	fmt.Fprintf(sb, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+// writes samples of map sorted by labels
+func promSamples(sb *strings.Builder, name string, samples map[string]float64) {
+	keys := []string{}
+	for k := range samples {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(sb, "%s%s %v\n", name, k, samples[k])
+	}
+}
+
+/*
+ * SPrintMetrics returns metrics of tests in prometheus text format.
+ * Caller holds gStateMutex, or tests are not running.
+ */
+func SPrintMetrics(tests []*SingleTestRun) string {
+	sb := &strings.Builder{}
+
+	byStatus := map[string]float64{}
+	events := map[string]float64{}
+	durations := map[string]float64{}
+
+	for _, testRun := range tests {
+		technique := testRun.criteria.Technique
+		byStatus[promLabels("technique", technique, "status", testRun.status.String())] += 1
+
+		for suffix, counts := range testRun.eventCounts {
+			for eventType, n := range counts.Matched {
+				events[promLabels("technique", technique, "tool_suffix", suffix, "event_type", eventType, "result", "matched")] += float64(n)
+			}
+			for eventType, n := range counts.Missed {
+				events[promLabels("technique", technique, "tool_suffix", suffix, "event_type", eventType, "result", "missed")] += float64(n)
+			}
+		}
+
+		if testRun.runnerSeconds > 0 {
+			labels := []string{"technique", technique, "test", fmt.Sprint(testRun.criteria.TestIndex)}
+			if testRun.iteration > 0 {
+				labels = append(labels, "iteration", fmt.Sprint(testRun.iteration))
+			}
+			durations[promLabels(labels...)] = testRun.runnerSeconds
+		}
+	}
+
+	promHeader(sb, "atomic_harness_tests", "gauge", "Tests of run by technique and status.")
+	promSamples(sb, "atomic_harness_tests", byStatus)
+
+	promHeader(sb, "atomic_harness_expected_events", "gauge", "Expected events of validated tests by simple schema type, matched or missed.")
+	promSamples(sb, "atomic_harness_expected_events", events)
+
+	promHeader(sb, "atomic_harness_runner_duration_seconds", "gauge", "Wall time of runner for test.")
+	promSamples(sb, "atomic_harness_runner_duration_seconds", durations)
+
+	fetchSum := map[string]float64{}
+	fetchCount := map[string]float64{}
+	fetches := map[string]float64{}
+	exitCodes := map[string]float64{}
+
+	gFetchMetricsMutex.Lock()
+	for suffix, m := range gFetchMetrics {
+		labels := promLabels("tool_suffix", suffix)
+		fetchSum[labels] = m.seconds
+		fetchCount[labels] = float64(m.count)
+		exitCodes[labels] = float64(m.lastExitCode)
+		for code, n := range m.exitCodes {
+			fetches[promLabels("tool_suffix", suffix, "exit_code", fmt.Sprint(code))] = float64(n)
+		}
+	}
+	gFetchMetricsMutex.Unlock()
+
+	promHeader(sb, "atomic_harness_telemetry_fetch_duration_seconds", "summary", "Time spent in telemetry tool fetch.")
+	promSamples(sb, "atomic_harness_telemetry_fetch_duration_seconds_sum", fetchSum)
+	promSamples(sb, "atomic_harness_telemetry_fetch_duration_seconds_count", fetchCount)
+
+	promHeader(sb, "atomic_harness_telemetry_fetches_total", "counter", "Telemetry tool fetches by exit code.")
+	promSamples(sb, "atomic_harness_telemetry_fetches_total", fetches)
+
+	promHeader(sb, "atomic_harness_telemetry_tool_exit_code", "gauge", "Exit code of last telemetry tool fetch.")
+	promSamples(sb, "atomic_harness_telemetry_tool_exit_code", exitCodes)
+
+	return sb.String()
+}
+
+/*
+ * WriteMetrics writes metrics.prom to results dir, and --metricsfile.
+ * The file is renamed into place, so a collector never reads a partial file.
+ */
+func WriteMetrics(tests []*SingleTestRun) {
+	data := []byte(SPrintMetrics(tests))
+
+	paths := []string{filepath.FromSlash(flagResultsPath + "/" + kMetricsFileName)}
+	if len(flagMetricsFile) > 0 {
+		paths = append(paths, filepath.FromSlash(flagMetricsFile))
+	}
+	for _, outPath := range paths {
+		if err := WriteFileAtomic(outPath, data); err != nil {
+			fmt.Println("ERROR: unable to write file", outPath, err)
+		}
+	}
+}
+
+// writes to temp file in same dir, then renames it to path
+func WriteFileAtomic(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+	os.Chmod(f.Name(), 0644)
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+)
+
+func TestGetEventCounts(t *testing.T) {
+	criteria := &types.MitreTestCriteria{}
+	criteria.ExpectedEvents = []*types.ExpectedEvent{
+		{EventType: "Process", Matches: []*types.SimpleEvent{{}}},
+		{EventType: "Process"},
+		{EventType: "File", SubType: "read", Matches: []*types.SimpleEvent{{}}},
+	}
+	criteria.ExpectedCorrelations = []*types.CorrelationRow{{IsMet: false}}
+
+	counts := GetEventCounts(criteria)
+	assert.Equal(t, 1, counts.Matched["P"])
+	assert.Equal(t, 1, counts.Missed["P"])
+	assert.Equal(t, 1, counts.Matched["f"])
+	assert.Equal(t, 1, counts.Missed[kCorrelationEventType])
+}
+
+func TestWriteMetrics(t *testing.T) {
+	dir := t.TempDir()
+	prevResultsPath, prevMetricsFile, prevFetchMetrics := flagResultsPath, flagMetricsFile, gFetchMetrics
+	flagResultsPath = dir
+	flagMetricsFile = filepath.Join(dir, "textfile", "harness.prom")
+	gFetchMetrics = map[string]*fetchMetrics{}
+	defer func() {
+		flagResultsPath, flagMetricsFile, gFetchMetrics = prevResultsPath, prevMetricsFile, prevFetchMetrics
+	}()
+	os.Mkdir(filepath.Dir(flagMetricsFile), 0755)
+
+	tests := []*SingleTestRun{
+		{status: types.StatusValidatePartial, runnerSeconds: 2.5, criteria: &types.AtomicTestCriteria{MitreTestCriteria: types.MitreTestCriteria{Technique: "T1070.004", TestIndex: 1}},
+			eventCounts: map[string]*EventCounts{"_e2e": {Matched: map[string]int{"P": 2}, Missed: map[string]int{"F": 1}}}},
+		{status: types.StatusSkipped, criteria: &types.AtomicTestCriteria{MitreTestCriteria: types.MitreTestCriteria{Technique: "T1059.004", TestIndex: 2}}},
+	}
+	tool := &TelemTool{Name: "telemtool_e2e", Suffix: "_e2e"}
+	RecordTelemetryFetch(tool, 1500*time.Millisecond, 0)
+	RecordTelemetryFetch(tool, 500*time.Millisecond, 3)
+
+	WriteMetrics(tests)
+
+	data, err := os.ReadFile(filepath.Join(dir, kMetricsFileName))
+	assert.Nil(t, err)
+	s := string(data)
+	assert.Contains(t, s, "# TYPE atomic_harness_tests gauge\n")
+	assert.Contains(t, s, `atomic_harness_tests{technique="T1070.004",status="`+types.StatusValidatePartial.String()+`"} 1`)
+	assert.Contains(t, s, `atomic_harness_tests{technique="T1059.004",status="`+types.StatusSkipped.String()+`"} 1`)
+	assert.Contains(t, s, `atomic_harness_expected_events{technique="T1070.004",tool_suffix="_e2e",event_type="P",result="matched"} 2`)
+	assert.Contains(t, s, `atomic_harness_expected_events{technique="T1070.004",tool_suffix="_e2e",event_type="F",result="missed"} 1`)
+	assert.Contains(t, s, `atomic_harness_runner_duration_seconds{technique="T1070.004",test="1"} 2.5`)
+	assert.NotContains(t, s, `atomic_harness_runner_duration_seconds{technique="T1059.004"`)
+	assert.Contains(t, s, `atomic_harness_telemetry_fetch_duration_seconds_sum{tool_suffix="_e2e"} 2`)
+	assert.Contains(t, s, `atomic_harness_telemetry_fetch_duration_seconds_count{tool_suffix="_e2e"} 2`)
+	assert.Contains(t, s, `atomic_harness_telemetry_fetches_total{tool_suffix="_e2e",exit_code="3"} 1`)
+	assert.Contains(t, s, `atomic_harness_telemetry_tool_exit_code{tool_suffix="_e2e"} 3`)
+
+	textfile, err := os.ReadFile(flagMetricsFile)
+	assert.Nil(t, err)
+	assert.Equal(t, s, string(textfile))
+	entries, _ := os.ReadDir(filepath.Dir(flagMetricsFile))
+	assert.Equal(t, 1, len(entries)) // no temp files left
+}
+
+func TestServeMetrics(t *testing.T) {
+	dir := t.TempDir()
+	server, err := NewHarnessServer(dir, "/bin/false", nil, "")
+	assert.Nil(t, err)
+	for _, id := range []string{"run-20261001-100000-1", "run-20261002-100000-1"} {
+		runDir := filepath.Join(dir, id)
+		os.Mkdir(runDir, 0755)
+		os.WriteFile(filepath.Join(runDir, kMetricsFileName), []byte("atomic_harness_tests{technique=\"T1070.004\",status=\"x\"} 1\n# run "+id+"\n"), 0644)
+		sr := &serveRun{run: types.ServeRun{Id: id, State: types.ServeRunDone}, dir: runDir, done: make(chan struct{})}
+		server.runs[id] = sr
+	}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/metrics")
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	data, _ := io.ReadAll(resp.Body)
+	s := string(data)
+	assert.Contains(t, s, `atomic_harness_serve_runs{state="done"} 2`)
+	assert.Contains(t, s, `atomic_harness_serve_metrics_run{id="run-20261002-100000-1"} 1`)
+	assert.Contains(t, s, "# run run-20261002-100000-1")
+	assert.False(t, strings.Contains(s, "# run run-20261001-100000-1"))
+}
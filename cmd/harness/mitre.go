@@ -0,0 +1,100 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+	utils "github.com/secureworks/atomic-harness/pkg/utils"
+)
+
+const kDefaultAttackBundlePath = "./data/enterprise-attack.json"
+const kLinuxTechniquesCsvPath = "./data/linux_techniques.csv"
+
+var flagAttackBundlePath string
+
+var gMitreTechniques = map[string]*types.MitreTechnique{} // from STIX bundle, empty if not loaded
+var gWarnedTechniques = map[string]bool{}
+
+func init() {
+	flag.StringVar(&flagAttackBundlePath, "attackbundle", "", "path to ATT&CK STIX bundle (enterprise-attack.json) for technique names and tactics. Default is "+kDefaultAttackBundlePath+" if present, else "+kLinuxTechniquesCsvPath)
+}
+
+/*
+ * LoadMitreData loads technique names and tactics for the platform from
+ * STIX bundle, or if not available, from linux_techniques.csv
+ * @return false if --attackbundle specified and could not be loaded
+ */
+func LoadMitreData() bool {
+	path := flagAttackBundlePath
+	if len(path) == 0 {
+		if _, err := os.Stat(filepath.FromSlash(kDefaultAttackBundlePath)); err == nil {
+			path = kDefaultAttackBundlePath
+		}
+	}
+
+	platform := utils.GetPlatformName()
+
+	if len(path) > 0 {
+		data, err := utils.LoadMitreStixBundle(path, platform)
+		if err != nil {
+			fmt.Println("ERROR: unable to load ATT&CK bundle", err)
+			if len(flagAttackBundlePath) > 0 {
+				return false
+			}
+		} else {
+			gMitreTechniques = data.Techniques
+			gMitreTactics = data.Tactics
+			for tid, technique := range data.Techniques {
+				gMitreTechniqueNames[tid] = technique.Name
+			}
+			return true
+		}
+	}
+
+	if platform != "linux" {
+		fmt.Println("WARN: technique names and tactics are for linux. Use --attackbundle with enterprise-attack.json for", platform)
+	}
+
+	utils.LoadMitreTechniqueCsv(filepath.FromSlash(kLinuxTechniquesCsvPath), &gMitreTechniqueNames)
+	tactics, err := utils.LoadMitreTacticCsv(filepath.FromSlash(kLinuxTechniquesCsvPath))
+	if err != nil {
+		if gVerbose {
+			fmt.Println("unable to load tactics", err)
+		}
+	} else {
+		gMitreTactics = tactics
+	}
+	return true
+}
+
+/*
+ * WarnIfRevoked prints a warning, once per technique, if the technique
+ * is revoked or deprecated in the STIX bundle.
+ * @param where - name of file or list referencing technique
+ * @return replacement technique id, if revoked and known
+ */
+func WarnIfRevoked(tid string, where string) string {
+	technique, ok := gMitreTechniques[tid]
+	if !ok {
+		return ""
+	}
+	if technique.IsRevoked {
+		if !gWarnedTechniques[tid] {
+			if len(technique.RevokedBy) > 0 {
+				fmt.Printf("WARN: %s in %s is revoked. Replaced by %s \"%s\"\n", tid, where, technique.RevokedBy, gMitreTechniqueNames[technique.RevokedBy])
+			} else {
+				fmt.Printf("WARN: %s in %s is revoked\n", tid, where)
+			}
+		}
+		gWarnedTechniques[tid] = true
+		return technique.RevokedBy
+	}
+	if technique.IsDeprecated && !gWarnedTechniques[tid] {
+		fmt.Printf("WARN: %s in %s is deprecated\n", tid, where)
+		gWarnedTechniques[tid] = true
+	}
+	return ""
+}
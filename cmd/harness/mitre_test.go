@@ -0,0 +1,76 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+	utils "github.com/secureworks/atomic-harness/pkg/utils"
+)
+
+const kTestStixBundle = `{
+  "type": "bundle",
+  "objects": [
+    {"type": "x-mitre-matrix", "id": "x-mitre-matrix--1", "tactic_refs": ["x-mitre-tactic--evasion", "x-mitre-tactic--persist"]},
+    {"type": "x-mitre-tactic", "id": "x-mitre-tactic--persist", "name": "Persistence", "x_mitre_shortname": "persistence",
+     "external_references": [{"source_name": "mitre-attack", "external_id": "TA0003"}]},
+    {"type": "x-mitre-tactic", "id": "x-mitre-tactic--evasion", "name": "Defense Evasion", "x_mitre_shortname": "defense-evasion",
+     "external_references": [{"source_name": "mitre-attack", "external_id": "TA0005"}]},
+    {"type": "attack-pattern", "id": "attack-pattern--old", "name": "Old Cron", "revoked": true,
+     "external_references": [{"source_name": "mitre-attack", "external_id": "T1168"}],
+     "kill_chain_phases": [{"kill_chain_name": "mitre-attack", "phase_name": "persistence"}], "x_mitre_platforms": ["Linux"]},
+    {"type": "attack-pattern", "id": "attack-pattern--cron", "name": "Cron",
+     "external_references": [{"source_name": "mitre-attack", "external_id": "T1053.003"}],
+     "kill_chain_phases": [{"kill_chain_name": "mitre-attack", "phase_name": "persistence"}], "x_mitre_platforms": ["Linux", "macOS"]},
+    {"type": "attack-pattern", "id": "attack-pattern--rc", "name": "RC Scripts",
+     "external_references": [{"source_name": "mitre-attack", "external_id": "T1037.004"}],
+     "kill_chain_phases": [{"kill_chain_name": "mitre-attack", "phase_name": "persistence"}], "x_mitre_platforms": ["Linux", "macOS"]},
+    {"type": "attack-pattern", "id": "attack-pattern--reg", "name": "Modify Registry",
+     "external_references": [{"source_name": "mitre-attack", "external_id": "T1112"}],
+     "kill_chain_phases": [{"kill_chain_name": "mitre-attack", "phase_name": "defense-evasion"}], "x_mitre_platforms": ["Windows"]},
+    {"type": "attack-pattern", "id": "attack-pattern--dep", "name": "Old Thing", "x_mitre_deprecated": true,
+     "external_references": [{"source_name": "mitre-attack", "external_id": "T1108"}],
+     "kill_chain_phases": [{"kill_chain_name": "mitre-attack", "phase_name": "defense-evasion"}], "x_mitre_platforms": ["Linux"]},
+    {"type": "relationship", "id": "relationship--1", "relationship_type": "revoked-by",
+     "source_ref": "attack-pattern--old", "target_ref": "attack-pattern--cron"}
+  ]
+}`
+
+func TestLoadStixBundle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "enterprise-attack.json")
+	os.WriteFile(path, []byte(kTestStixBundle), 0644)
+
+	data, err := utils.LoadMitreStixBundle(path, "linux")
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(data.Techniques))
+	assert.Equal(t, "T1053.003", data.Techniques["T1168"].RevokedBy)
+	assert.Equal(t, []string{"Linux", "macOS"}, data.Techniques["T1053.003"].Platforms)
+	assert.Equal(t, 2, len(data.Tactics))
+	assert.Equal(t, "TA0005", data.Tactics[0].Id)
+	assert.Equal(t, 0, len(data.Tactics[0].Techniques)) // windows-only and deprecated
+	assert.Equal(t, []string{"T1037.004", "T1053.003"}, data.Tactics[1].Techniques) // sorted
+
+	data, _ = utils.LoadMitreStixBundle(path, "windows")
+	assert.Equal(t, []string{"T1112"}, data.Tactics[0].Techniques)
+
+	flagAttackBundlePath = path
+	defer func() {
+		flagAttackBundlePath = ""
+		gMitreTechniques = map[string]*types.MitreTechnique{}
+		gMitreTechniqueNames = map[string]string{}
+	}()
+	assert.True(t, LoadMitreData())
+	assert.Equal(t, "Cron", gMitreTechniqueNames["T1053.003"])
+	assert.Equal(t, "persistence", FindTactic("TA0003").ShortName)
+
+	assert.Equal(t, "T1053.003", WarnIfRevoked("T1168", "test.csv"))
+	assert.Equal(t, "", WarnIfRevoked("T1108", "test.csv"))
+	assert.True(t, gWarnedTechniques["T1108"])
+	assert.Equal(t, "", WarnIfRevoked("T1053.003", "test.csv"))
+
+	flagAttackBundlePath = filepath.Join(t.TempDir(), "missing.json")
+	assert.False(t, LoadMitreData())
+}
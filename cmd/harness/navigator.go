@@ -0,0 +1,79 @@
+package main
+
+/*
+ * navigator_layer.json: ATT&CK Navigator layer of validation coverage of a
+ * run.  Score of a technique is the average score of its tests that were
+ * validated: Validated=100, Partial=50, NoTelemetry=0.  Tests with other
+ * status, e.g. Skipped or Timeout, don't count, and a technique with none
+ * is not colored.  Comment lists status and match string of each test.
+ */
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+	utils "github.com/secureworks/atomic-harness/pkg/utils"
+)
+
+const kNavigatorLayerFileName = "navigator_layer.json"
+
+// GetStatusScore returns score of test for layer, or false if it doesn't count
+func GetStatusScore(status types.TestStatus) (int, bool) {
+	switch status {
+	case types.StatusValidateSuccess:
+		return 100, true
+	case types.StatusValidatePartial:
+		return 50, true
+	case types.StatusValidateFail:
+		return 0, true
+	}
+	return 0, false
+}
+
+func GetNavigatorLayer(report *Report) *types.NavigatorLayer {
+	name := "atomic-harness " + filepath.Base(report.ResultsDir)
+	layer := utils.NewNavigatorLayer(name, "Telemetry validation coverage. Validated=100, Partial=50, NoTelemetry=0", "")
+	layer.LegendItems = []types.NavigatorLegendItem{{Label: "NoTelemetry", Color: "#ff6666"}, {Label: "Partial", Color: "#ffe766"}, {Label: "Validated", Color: "#8ec843"}}
+
+	techniques := []string{}
+	byTechnique := map[string][]*ReportTest{}
+	for _, test := range report.Tests {
+		tid := test.Progress.Technique
+		if _, ok := byTechnique[tid]; !ok {
+			techniques = append(techniques, tid)
+		}
+		byTechnique[tid] = append(byTechnique[tid], test)
+	}
+
+	for _, tid := range techniques {
+		total, num := 0, 0
+		lines := []string{}
+		for _, test := range byTechnique[tid] {
+			if score, ok := GetStatusScore(test.Progress.Status); ok {
+				total += score
+				num += 1
+			}
+			line := fmt.Sprintf("[%s] %s", test.Progress.TestIndex, test.Progress.TestName)
+			if test.Progress.Iteration > 0 {
+				line += fmt.Sprintf(" #%d", test.Progress.Iteration)
+			}
+			line += ": " + test.Progress.Status.String()
+			if len(test.MatchString) > 0 {
+				line += " " + test.MatchString
+			}
+			lines = append(lines, line)
+		}
+		score := -1
+		if num > 0 {
+			score = total / num
+		}
+		utils.AddNavigatorTechnique(layer, tid, score, strings.Join(lines, "\n"))
+	}
+	return layer
+}
+
+func WriteNavigatorLayer(report *Report) error {
+	return utils.SaveNavigatorLayer(filepath.Join(report.ResultsDir, kNavigatorLayerFileName), GetNavigatorLayer(report))
+}
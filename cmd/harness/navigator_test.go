@@ -0,0 +1,47 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+)
+
+func TestNavigatorLayer(t *testing.T) {
+	report := &Report{ResultsDir: t.TempDir()}
+	mktest := func(technique string, index string, status types.TestStatus, matchString string) *ReportTest {
+		return &ReportTest{Progress: types.TestProgress{Technique: technique, TestIndex: index, TestName: "test " + index, Status: status}, MatchString: matchString}
+	}
+	report.Tests = []*ReportTest{
+		mktest("T1070.004", "1", types.StatusValidateSuccess, "PF"),
+		mktest("T1070.004", "2", types.StatusValidatePartial, "P<F>"),
+		mktest("T1070.004", "3", types.StatusTestTimeout, ""),
+		mktest("T1059.004", "1", types.StatusValidateFail, "<P>"),
+		mktest("T1485", "1", types.StatusSkipped, ""),
+	}
+
+	assert.Nil(t, WriteNavigatorLayer(report))
+	data, err := os.ReadFile(filepath.Join(report.ResultsDir, kNavigatorLayerFileName))
+	assert.Nil(t, err)
+	layer := &types.NavigatorLayer{}
+	assert.Nil(t, json.Unmarshal(data, layer))
+	assert.Equal(t, "enterprise-attack", layer.Domain)
+
+	byId := map[string]*types.NavigatorTechnique{}
+	for _, obj := range layer.Techniques {
+		byId[obj.TechniqueId] = obj
+	}
+	assert.Equal(t, 5, len(byId)) // with parents T1070, T1059
+
+	assert.Equal(t, 75, *byId["T1070.004"].Score)
+	assert.Equal(t, "[1] test 1: Validated PF\n[2] test 2: Partial P<F>\n[3] test 3: Timeout", byId["T1070.004"].Comment)
+	assert.Equal(t, 0, *byId["T1059.004"].Score)
+	assert.Nil(t, byId["T1485"].Score)
+	assert.Nil(t, byId["T1070"].Score)
+	assert.True(t, byId["T1070"].ShowSubtechniques)
+	assert.Equal(t, "T1059", layer.Techniques[0].TechniqueId) // sorted
+}
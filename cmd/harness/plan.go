@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+	utils "github.com/secureworks/atomic-harness/pkg/utils"
+)
+
+var gPlan = []*types.PlanEntry{} // with --norun, see AddToPlan()
+
+/*
+ * BuildPlanEntry resolves the atomic test of testRun and interpolates
+ * the commands of each stage with its args, the same as goartrun.
+ * Criteria args should already have defaults and substitutions.
+ */
+func BuildPlanEntry(testRun *SingleTestRun, skipReason string) *types.PlanEntry {
+	rec := testRun.criteria
+
+	entry := &types.PlanEntry{Id: rec.Id(), Technique: rec.Technique, TestIndex: rec.TestIndex, TestName: rec.TestName, TestGuid: rec.TestGuid}
+	entry.Iteration = testRun.iteration
+	entry.Args = rec.Args
+	entry.Criteria = rec
+	entry.SkipReason = skipReason
+
+	test := GetAtomicTest(rec.Technique, fmt.Sprintf("%d", rec.TestIndex), rec.TestGuid, rec.TestName)
+	if test == nil || test.Executor == nil {
+		if len(entry.SkipReason) == 0 {
+			entry.SkipReason = "atomic test not found"
+		}
+		return entry
+	}
+	entry.Executor = test.Executor.Name
+	entry.ElevationRequired = test.Executor.ElevationRequired
+
+	if len(entry.SkipReason) == 0 && !utils.StringInList(utils.GetPlatformName(), test.SupportedPlatforms) {
+		entry.SkipReason = "test does not support platform " + utils.GetPlatformName()
+	}
+	if len(entry.SkipReason) == 0 {
+		for name := range test.InputArugments {
+			if len(rec.Args[name]) == 0 {
+				entry.SkipReason = fmt.Sprintf("argument [%s] is required but not set and has no default", name)
+				break
+			}
+		}
+	}
+
+	base, _ := filepath.Abs(filepath.FromSlash(flagAtomicsPath))
+	entry.Stages = utils.GetInterpolatedStages(test, base, rec.Args)
+	return entry
+}
+
+func AddToPlan(testRun *SingleTestRun, skipReason string) {
+	gPlan = append(gPlan, BuildPlanEntry(testRun, skipReason))
+}
+
+// SPrintPlan formats plan for review
+func SPrintPlan(plan []*types.PlanEntry) string {
+	s := ""
+	numSkipped := 0
+	for _, entry := range plan {
+		s += fmt.Sprintf("=== %s [%d] \"%s\"", entry.Id, entry.TestIndex, entry.TestName)
+		if entry.Iteration > 0 {
+			s += fmt.Sprintf(" iteration %d", entry.Iteration)
+		}
+		s += "\n"
+		if len(entry.SkipReason) > 0 {
+			s += "SKIP: " + entry.SkipReason + "\n"
+			numSkipped += 1
+		}
+		s += fmt.Sprintf("executor: %s elevation_required: %v\n", entry.Executor, entry.ElevationRequired)
+
+		if len(entry.Args) > 0 {
+			s += "args:\n"
+			names := []string{}
+			for name := range entry.Args {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				s += fmt.Sprintf("  %s: %s\n", name, entry.Args[name])
+			}
+		}
+
+		for _, stage := range entry.Stages {
+			s += fmt.Sprintf("%s (%s):\n", stage.Stage, stage.Executor)
+			for _, line := range strings.Split(stage.Command, "\n") {
+				s += "  " + line + "\n"
+			}
+		}
+
+		if entry.Criteria != nil && len(entry.Criteria.ExpectedEvents) > 0 {
+			s += "expected:\n"
+			for _, exp := range entry.Criteria.ExpectedEvents {
+				s += "  " + exp.EventType
+				if len(exp.SubType) > 0 {
+					s += " " + exp.SubType
+				}
+				for _, check := range exp.FieldChecks {
+					s += fmt.Sprintf(" %s%s%s", check.FieldName, check.Op, check.Value)
+				}
+				if exp.IsMaybe {
+					s += " (maybe)"
+				}
+				s += "\n"
+			}
+		}
+		s += "\n"
+	}
+	s += fmt.Sprintf("=== Plan: %d tests, %d to run, %d skipped\n", len(plan), len(plan)-numSkipped, numSkipped)
+	return s
+}
+
+// WritePlan saves plan.json and plan.txt in results dir
+func WritePlan() {
+	j, err := json.MarshalIndent(gPlan, "", "  ")
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		return
+	}
+	outPath := filepath.FromSlash(flagResultsPath + "/plan.json")
+	err = os.WriteFile(outPath, j, 0644)
+	if err != nil {
+		fmt.Println("ERROR: unable to write file", outPath, err)
+	}
+
+	outPath = filepath.FromSlash(flagResultsPath + "/plan.txt")
+	err = os.WriteFile(outPath, []byte(SPrintPlan(gPlan)), 0644)
+	if err != nil {
+		fmt.Println("ERROR: unable to write file", outPath, err)
+	}
+	fmt.Println("Execution plan written to", outPath)
+}
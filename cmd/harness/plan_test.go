@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+	utils "github.com/secureworks/atomic-harness/pkg/utils"
+)
+
+const kTestPlanAtomicYaml = `
+attack_technique: T1070.004
+display_name: File Deletion
+atomic_tests:
+- name: Delete a single file
+  auto_generated_guid: 562d737f-2fc6-4b09-8c2a-7f8ff0828480
+  supported_platforms: [linux, macos]
+  input_arguments:
+    file_to_delete:
+      description: Path of file to delete
+      type: path
+      default: /tmp/victim-files/a
+    script:
+      description: helper script
+      type: path
+      default: PathToAtomicsFolder/T1070.004/src/helper.sh
+  dependencies:
+  - description: file must exist
+    prereq_command: "test -f #{file_to_delete}"
+    get_prereq_command: "touch #{file_to_delete}"
+  executor:
+    name: sh
+    command: |
+      rm -f #{file_to_delete}
+      sh #{script}
+    cleanup_command: rm -rf /tmp/victim-files
+`
+
+func TestExecutionPlan(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "T1070.004"), 0755)
+	os.WriteFile(filepath.Join(dir, "T1070.004", "T1070.004.yaml"), []byte(kTestPlanAtomicYaml), 0644)
+	flagAtomicsPath = dir
+	flagResultsPath = dir
+	gAtomicYamls = map[string]*types.Atomic{}
+	gPlan = []*types.PlanEntry{}
+
+	rec := &types.AtomicTestCriteria{}
+	rec.Technique = "T1070.004"
+	rec.TestIndex = 1
+	rec.Args = map[string]string{"file_to_delete": "/tmp/other"}
+	rec.ExpectedEvents = []*types.ExpectedEvent{{EventType: "File", SubType: "DELETE", FieldChecks: []types.FieldCriteria{{FieldName: "path", Op: "=", Value: "/tmp/other"}}}}
+	utils.LoadAtomicDefaultArgs(rec, dir, false)
+
+	entry := BuildPlanEntry(&SingleTestRun{criteria: rec}, "")
+	if utils.GetPlatformName() == "windows" {
+		assert.Contains(t, entry.SkipReason, "platform")
+	} else {
+		assert.Equal(t, "", entry.SkipReason)
+	}
+	assert.Equal(t, "sh", entry.Executor)
+	assert.Equal(t, 4, len(entry.Stages))
+	assert.Equal(t, "checkPrereq0", entry.Stages[0].Stage)
+	assert.Equal(t, "test -f /tmp/other", entry.Stages[0].Command)
+	assert.Equal(t, "rm -f /tmp/other\nsh "+filepath.Join(dir, "T1070.004/src/helper.sh"), entry.Stages[2].Command)
+	assert.Equal(t, "cleanup", entry.Stages[3].Stage)
+
+	gPlan = append(gPlan, entry)
+	AddToPlan(&SingleTestRun{criteria: rec, iteration: 2}, "criteria warning")
+	WritePlan()
+
+	data, err := os.ReadFile(filepath.Join(dir, "plan.txt"))
+	assert.Nil(t, err)
+	assert.Contains(t, string(data), "SKIP: criteria warning")
+	assert.Contains(t, string(data), "  File DELETE path=/tmp/other\n")
+	assert.Contains(t, string(data), "=== Plan: 2 tests, 1 to run, 1 skipped")
+
+	_, err = os.Stat(filepath.Join(dir, "plan.json"))
+	assert.Nil(t, err)
+}
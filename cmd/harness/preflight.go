@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+	utils "github.com/secureworks/atomic-harness/pkg/utils"
+)
+
+var flagPreflight bool
+
+var gPreflight = map[string]*types.PreflightResult{} // criteria Id -> result, see RunPreflight()
+
+// programs that can run each executor
+var executorBinaries = map[string][]string{
+	"sh":             {"sh"},
+	"bash":           {"bash"},
+	"powershell":     {"powershell", "pwsh"},
+	"command_prompt": {"cmd"},
+}
+
+func init() {
+	flag.BoolVar(&flagPreflight, "preflight", false, "before running, check prereqs (without getting them), elevation and binaries of each test, and write preflight.txt. With --norun, only the check is done")
+}
+
+/*
+ * RunPreflight checks whether each selected test can run on this host,
+ * and saves preflight.json and preflight.txt in results dir.
+ */
+func RunPreflight() []*types.PreflightResult {
+	results := []*types.PreflightResult{}
+	for _, spec := range gTestSpecs {
+		for _, rec := range spec.Criteria {
+			if false == gKeepRunning.Load() {
+				return results
+			}
+			if _, ok := gPreflight[rec.Id()]; ok {
+				continue
+			}
+			result := PreflightTest(rec)
+			gPreflight[rec.Id()] = result
+			results = append(results, result)
+		}
+	}
+	WritePreflight(results)
+	fmt.Print(SPrintPreflight(results))
+	return results
+}
+
+/*
+ * PreflightTest checks platform, elevation, args, binaries used in test
+ * and cleanup commands, and safety policy.  If those pass, goartrun is
+ * run with checkprereq stage, which runs prereq_command of dependencies,
+ * but not get_prereq_command.
+ */
+func PreflightTest(rec *types.AtomicTestCriteria) *types.PreflightResult {
+	result := &types.PreflightResult{Id: rec.Id(), Technique: rec.Technique, TestIndex: rec.TestIndex, TestName: rec.TestName, TestGuid: rec.TestGuid}
+	defer func() { result.IsRunnable = len(result.Reasons) == 0 }()
+
+	if ShouldBeSkipped(rec) {
+		result.Reasons = append(result.Reasons, "criteria warning: "+rec.Warnings[0])
+	}
+
+	test := GetAtomicTest(rec.Technique, fmt.Sprintf("%d", rec.TestIndex), rec.TestGuid, rec.TestName)
+	if test == nil || test.Executor == nil {
+		result.Reasons = append(result.Reasons, "atomic test not found")
+		return result
+	}
+	result.Executor = test.Executor.Name
+	result.ElevationRequired = test.Executor.ElevationRequired
+
+	if !utils.StringInList(utils.GetPlatformName(), test.SupportedPlatforms) {
+		result.Reasons = append(result.Reasons, "test does not support platform "+utils.GetPlatformName())
+		return result
+	}
+	if test.Executor.ElevationRequired && !IsElevated() {
+		result.Reasons = append(result.Reasons, "elevation required, harness is not running as root or administrator")
+	}
+	if !IsExecutorAvailable(test.Executor.Name) {
+		result.Reasons = append(result.Reasons, "executor not found: "+test.Executor.Name)
+		return result
+	}
+
+	utils.LoadAtomicDefaultArgs(rec, filepath.FromSlash(flagAtomicsPath), gVerbose)
+	if false == SubstituteSysInfoArgs(rec) {
+		result.Reasons = append(result.Reasons, "unable to substitute variables in args")
+		return result
+	}
+	for name := range test.InputArugments {
+		if len(rec.Args[name]) == 0 {
+			result.Reasons = append(result.Reasons, fmt.Sprintf("argument [%s] is required but not set and has no default", name))
+		}
+	}
+
+	base, _ := filepath.Abs(filepath.FromSlash(flagAtomicsPath))
+	if (test.Executor.Name == "sh" || test.Executor.Name == "bash") && runtime.GOOS != "windows" {
+		for _, stage := range utils.GetInterpolatedStages(test, base, rec.Args) {
+			if stage.Stage != "test" && stage.Stage != "cleanup" {
+				continue
+			}
+			for _, name := range utils.GetCommandNames(stage.Command) {
+				if !IsBinaryAvailable(name) && !utils.StringInList(name, result.MissingBinaries) {
+					result.MissingBinaries = append(result.MissingBinaries, name)
+				}
+			}
+		}
+		if len(result.MissingBinaries) > 0 {
+			result.Reasons = append(result.Reasons, "missing binaries: "+strings.Join(result.MissingBinaries, ", "))
+		}
+	}
+
+	if violation := CheckTestSafety(&SingleTestRun{criteria: rec}); violation != nil {
+		result.Reasons = append(result.Reasons, "unsafe: "+violation.String())
+		return result // don't run prereq check commands
+	}
+
+	if len(test.Dependencies) > 0 {
+		RunPreflightPrereqs(rec, result)
+	}
+	return result
+}
+
+// RunPreflightPrereqs runs goartrun checkprereq stage, in preflight subdir of results
+func RunPreflightPrereqs(rec *types.AtomicTestCriteria, result *types.PreflightResult) {
+	resultsDir := filepath.FromSlash(flagResultsPath + "/preflight/" + filepath.Base(GetTestResultsDir(rec, 0)))
+	err := os.MkdirAll(resultsDir, 0777)
+	if err != nil {
+		fmt.Println("unable to make results dir", err)
+		os.Exit(1)
+	}
+	workingDir, err := os.MkdirTemp("", "artwork-"+rec.Technique+"_"+fmt.Sprintf("%d", rec.TestIndex)+"-")
+	if err != nil {
+		fmt.Println("unable to make working dir", err)
+		os.Exit(1)
+	}
+	if runtime.GOOS != "windows" {
+		os.Chmod(workingDir, 0777) // runner cleans up workingDir
+		os.Chmod(resultsDir, 0777)
+	}
+
+	testRun := &SingleTestRun{criteria: rec, resultsDir: resultsDir, workingDir: workingDir}
+
+	runSpec := NewRunSpec(rec, workingDir, resultsDir)
+	runSpec.Stage = "checkprereq"
+	runConfig := WriteRunSpec(runSpec, resultsDir)
+
+	if runtime.GOOS == "windows" {
+		GoArtRunTestWin(testRun, runConfig)
+	} else {
+		GoArtRunTest(testRun, runConfig)
+	}
+	FinishTestRun(testRun)
+
+	summary := &types.AtomicTest{}
+	data, err := os.ReadFile(filepath.FromSlash(resultsDir + "/run_summary.json"))
+	if err == nil {
+		err = json.Unmarshal(data, summary)
+	}
+	if err != nil || (testRun.status != types.StatusTestSuccess && testRun.status != types.StatusPreReqFail) {
+		result.Reasons = append(result.Reasons, fmt.Sprintf("prereq check failed: runner status %s, see %s", testRun.status, resultsDir))
+		return
+	}
+
+	result.Prereqs = summary.PrereqResults
+	for _, prereq := range summary.PrereqResults {
+		if !prereq.IsMet {
+			result.Reasons = append(result.Reasons, "prereq not met: "+prereq.Description)
+		}
+	}
+}
+
+func IsExecutorAvailable(name string) bool {
+	for _, binary := range executorBinaries[name] {
+		if IsBinaryAvailable(binary) {
+			return true
+		}
+	}
+	return false
+}
+
+// true if name is in PATH, or if it is an absolute path that exists
+func IsBinaryAvailable(name string) bool {
+	if strings.ContainsAny(name, `/\`) {
+		if !filepath.IsAbs(name) {
+			return true // relative to working dir, can't tell
+		}
+		_, err := os.Stat(name)
+		return err == nil
+	}
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+// SPrintPreflight formats runnable / not-runnable matrix
+func SPrintPreflight(results []*types.PreflightResult) string {
+	s := ""
+	numRunnable := 0
+	for _, result := range results {
+		runnable := "NO"
+		if result.IsRunnable {
+			runnable = "RUNNABLE"
+			numRunnable += 1
+		}
+		executor := result.Executor
+		if result.ElevationRequired {
+			executor += ",elev"
+		}
+		s += fmt.Sprintf("  %-8s %9s %2d %-8s %-14s \"%s\"\n", runnable, result.Technique, result.TestIndex, ShortGuid(result.TestGuid), executor, result.TestName)
+		for _, reason := range result.Reasons {
+			s += "           " + reason + "\n"
+		}
+	}
+	return fmt.Sprintf("=== Preflight: %d tests, %d runnable, %d not runnable\n", len(results), numRunnable, len(results)-numRunnable) + s
+}
+
+// WritePreflight saves preflight.json and preflight.txt in results dir
+func WritePreflight(results []*types.PreflightResult) {
+	j, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		return
+	}
+	outPath := filepath.FromSlash(flagResultsPath + "/preflight.json")
+	err = os.WriteFile(outPath, j, 0644)
+	if err != nil {
+		fmt.Println("ERROR: unable to write file", outPath, err)
+	}
+
+	outPath = filepath.FromSlash(flagResultsPath + "/preflight.txt")
+	err = os.WriteFile(outPath, []byte(SPrintPreflight(results)), 0644)
+	if err != nil {
+		fmt.Println("ERROR: unable to write file", outPath, err)
+	}
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+	utils "github.com/secureworks/atomic-harness/pkg/utils"
+)
+
+const kTestPreflightAtomicYaml = `
+attack_technique: T1105
+display_name: Ingress Tool Transfer
+atomic_tests:
+- name: Download with missing tool
+  auto_generated_guid: a1921cd3-9a2d-47d5-a891-f1d0f2a7a31b
+  supported_platforms: [linux, macos]
+  input_arguments:
+    remote_file:
+      description: url
+      type: url
+      default: http://localhost/x
+  executor:
+    name: sh
+    command: |
+      if [ -x /tmp ]; then no-such-downloader-art #{remote_file} > /tmp/x; fi
+      cat <<EOF > /tmp/y
+      not-a-command
+      EOF
+      ls /tmp | grep x
+    cleanup_command: rm -f /tmp/x /tmp/y
+- name: Windows only
+  auto_generated_guid: 0d0e7a3b-4b57-4a3c-9c19-7ee8b9a6c7b1
+  supported_platforms: [windows]
+  executor:
+    name: powershell
+    command: Get-Process
+`
+
+func TestGetCommandNames(t *testing.T) {
+	cmd := "# comment\nsudo FOO=1 ls -la | grep x && echo hi > /tmp/y\nfor f in a b; do cat $f; done\n$BIN -x\ncurl \\\n  http://x | sh"
+	assert.Equal(t, []string{"ls", "grep", "cat", "curl", "sh"}, utils.GetCommandNames(cmd))
+}
+
+func TestPreflightTest(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("sh executor")
+	}
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "T1105"), 0755)
+	os.WriteFile(filepath.Join(dir, "T1105", "T1105.yaml"), []byte(kTestPreflightAtomicYaml), 0644)
+	flagAtomicsPath = dir
+	gAtomicYamls = map[string]*types.Atomic{}
+
+	rec := &types.AtomicTestCriteria{}
+	rec.Technique = "T1105"
+	rec.TestIndex = 1
+	rec.Args = map[string]string{}
+
+	result := PreflightTest(rec)
+	assert.False(t, result.IsRunnable)
+	assert.Equal(t, "sh", result.Executor)
+	assert.Equal(t, []string{"no-such-downloader-art"}, result.MissingBinaries)
+	assert.Equal(t, []string{"missing binaries: no-such-downloader-art"}, result.Reasons)
+
+	rec2 := &types.AtomicTestCriteria{}
+	rec2.Technique = "T1105"
+	rec2.TestIndex = 2
+	result2 := PreflightTest(rec2)
+	assert.False(t, result2.IsRunnable)
+	assert.Contains(t, result2.Reasons[0], "does not support platform")
+
+	s := SPrintPreflight([]*types.PreflightResult{result, result2, {Technique: "T1070", TestIndex: 1, IsRunnable: true}})
+	assert.Contains(t, s, "=== Preflight: 3 tests, 1 runnable, 2 not runnable\n")
+	assert.Contains(t, s, "           missing binaries: no-such-downloader-art\n")
+	assert.Contains(t, s, "  RUNNABLE     T1070")
+}
@@ -0,0 +1,42 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// run goartrun in its own process group, so a Ctrl-C in the terminal
+// reaches only the harness, which then decides how to stop the runner
+func SetRunnerProcAttrs(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// ask runner to cancel the test, it will still run cleanup stage
+func TerminateRunner(cmd *exec.Cmd) error {
+	return cmd.Process.Signal(syscall.SIGTERM)
+}
+
+/*
+ * KillRunner sends the runner a second SIGTERM, on which it kills the
+ * process groups of its scripts and exits without cleanup.  If it is
+ * still running after kKillRunnerGrace, its process group is killed.
+ */
+func KillRunner(cmd *exec.Cmd) error {
+	pid := cmd.Process.Pid
+	time.AfterFunc(kKillRunnerGrace, func() {
+		if IsRunnerRunning(cmd) {
+			syscall.Kill(-pid, syscall.SIGKILL)
+		}
+	})
+	return cmd.Process.Signal(syscall.SIGTERM)
+}
+
+// true if running as root
+func IsElevated() bool {
+	return os.Geteuid() == 0
+}
@@ -0,0 +1,31 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"os/exec"
+	"strconv"
+)
+
+func SetRunnerProcAttrs(cmd *exec.Cmd) {
+}
+
+// runner shares our console, and already received the Ctrl-C
+func TerminateRunner(cmd *exec.Cmd) error {
+	return nil
+}
+
+// kill runner and its scripts. Process.Kill only gets the runner
+func KillRunner(cmd *exec.Cmd) error {
+	err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(cmd.Process.Pid)).Run()
+	if err != nil {
+		return cmd.Process.Kill()
+	}
+	return nil
+}
+
+// true if running as administrator. net session requires it
+func IsElevated() bool {
+	return exec.Command("net", "session").Run() == nil
+}
@@ -0,0 +1,319 @@
+package main
+
+/*
+ * Remote execution: goartrun is run on another host over ssh, while
+ * telemetry fetch and validation run here.  The goartrun binary, atomics
+ * of each technique, and the RunSpec are copied to the remote host, and
+ * its results dir is copied back.  Files are streamed as tar over ssh,
+ * so only ssh is needed here, and sh and tar on the remote host.
+ */
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+)
+
+var flagRemote string
+var flagRemoteDir string
+var flagRemoteSshOpts string
+var flagRemoteGoArtPath string
+var flagRemoteSudo bool
+
+var gSshPath = "ssh"
+
+var gRemoteMutex sync.Mutex
+var gRemoteAtomics = map[string]bool{} // techniques copied to remote host
+
+func init() {
+	flag.StringVar(&flagRemote, "remote", "", "[user@]host to run tests on over ssh. Telemetry is fetched and validated locally")
+	flag.StringVar(&flagRemoteDir, "remotedir", "/tmp/atomic-harness", "with --remote, dir on remote host for runner, atomics and results")
+	flag.StringVar(&flagRemoteSshOpts, "sshopts", "", "with --remote, extra ssh options, e.g. \"-p 2222 -i ~/.ssh/lab_key\"")
+	flag.StringVar(&flagRemoteGoArtPath, "remotegoartpath", "", "with --remote, runner binary to copy to remote host, if different OS or arch. Default is goartpath")
+	flag.BoolVar(&flagRemoteSudo, "remotesudo", false, "with --remote, run runner with sudo -n, if ssh user is not root")
+}
+
+// single-quote s for remote sh
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// SshCommand returns command to run remoteCmd on remote host
+func SshCommand(remoteCmd string) *exec.Cmd {
+	args := strings.Fields(flagRemoteSshOpts)
+	args = append(args, "-o", "BatchMode=yes", flagRemote, remoteCmd)
+	return exec.Command(gSshPath, args...)
+}
+
+func remoteSudo() string {
+	if flagRemoteSudo {
+		return "sudo -n "
+	}
+	return ""
+}
+
+// RunSsh runs remoteCmd with stdin, and returns its stdout. Error includes stderr
+func RunSsh(remoteCmd string, stdin io.Reader) ([]byte, error) {
+	cmd := SshCommand(remoteCmd)
+	cmd.Stdin = stdin
+	output, err := cmd.Output()
+	if err != nil {
+		stderr := ""
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			stderr = strings.TrimSpace(string(exitErr.Stderr))
+		}
+		return output, fmt.Errorf("ssh %s %s: %v %s", flagRemote, remoteCmd, err, stderr)
+	}
+	return output, nil
+}
+
+/*
+ * PrepareRemote checks ssh access and copies runner binary, safety policy
+ * and prereq cache to remote dir.
+ */
+func PrepareRemote() bool {
+	output, err := RunSsh("uname -sm", nil)
+	if err != nil {
+		fmt.Println("ERROR: unable to reach remote host", err)
+		return false
+	}
+	fmt.Println("Remote host", flagRemote, strings.TrimSpace(string(output)))
+
+	goartPath := flagRemoteGoArtPath
+	if len(goartPath) == 0 {
+		goartPath = flagGoArtRunnerPath
+	}
+	uploads := map[string]string{filepath.FromSlash(goartPath): "bin/goartrun"}
+	if len(flagSafetyPolicyPath) > 0 {
+		uploads[filepath.FromSlash(flagSafetyPolicyPath)] = "safety_policy.csv"
+	}
+	if len(flagPrereqCacheDir) > 0 {
+		uploads[filepath.FromSlash(flagPrereqCacheDir)] = "prereq-cache"
+	}
+	for localPath, name := range uploads {
+		if err = UploadToRemote(localPath, path.Join(flagRemoteDir, name)); err != nil {
+			fmt.Println("ERROR: unable to copy", localPath, "to remote host", err)
+			return false
+		}
+	}
+	return true
+}
+
+// UploadToRemote copies local file or dir to remotePath, replacing it
+func UploadToRemote(localPath string, remotePath string) error {
+	var buf bytes.Buffer
+	if err := WriteTar(&buf, localPath, path.Base(remotePath)); err != nil {
+		return err
+	}
+	dir := path.Dir(remotePath)
+	_, err := RunSsh(fmt.Sprintf("mkdir -p %s && rm -rf %s && tar -xf - -C %s", ShellQuote(dir), ShellQuote(remotePath), ShellQuote(dir)), &buf)
+	return err
+}
+
+// WriteTar writes localPath, and files under it if dir, to w as name
+func WriteTar(w io.Writer, localPath string, name string) error {
+	tw := tar.NewWriter(w)
+	err := filepath.WalkDir(localPath, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() && !info.IsDir() {
+			return nil // skip symlinks, devices
+		}
+		rel, _ := filepath.Rel(localPath, p)
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		hdr.Name = path.Join(name, filepath.ToSlash(rel))
+		if info.IsDir() {
+			hdr.Name += "/"
+		}
+		if err = tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
+
+// ExtractTar writes files from tar stream r under destDir
+func ExtractTar(r io.Reader, destDir string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := path.Clean(hdr.Name)
+		if name == "." || path.IsAbs(name) || strings.HasPrefix(name, "../") || name == ".." {
+			continue
+		}
+		dest := filepath.Join(destDir, filepath.FromSlash(name))
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(dest, 0755)
+		case tar.TypeReg:
+			err = os.MkdirAll(filepath.Dir(dest), 0755)
+			if err == nil {
+				var f *os.File
+				f, err = os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+				if err == nil {
+					_, err = io.Copy(f, tr)
+					f.Close()
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// copies atomics folder of technique to remote host, once per run
+func UploadRemoteAtomics(technique string) error {
+	gRemoteMutex.Lock()
+	defer gRemoteMutex.Unlock()
+	if gRemoteAtomics[technique] {
+		return nil
+	}
+	err := UploadToRemote(filepath.Join(filepath.FromSlash(flagAtomicsPath), technique), path.Join(flagRemoteDir, "atomics", technique))
+	if err == nil {
+		gRemoteAtomics[technique] = true
+	}
+	return err
+}
+
+/*
+ * GetRemoteRunSpec returns copy of runSpec with paths on remote host.
+ * Working dir keeps its name in /tmp, since validation looks for
+ * /tmp/artwork-* in command lines.
+ */
+func GetRemoteRunSpec(runSpec *types.RunSpec) *types.RunSpec {
+	remote := *runSpec
+	remote.AtomicsDir = path.Join(flagRemoteDir, "atomics")
+	remote.TempDir = path.Join("/tmp", filepath.Base(runSpec.TempDir))
+	remote.ResultsDir = path.Join(flagRemoteDir, "results", filepath.Base(runSpec.ResultsDir))
+	if len(runSpec.SafetyPolicyPath) > 0 {
+		remote.SafetyPolicyPath = path.Join(flagRemoteDir, "safety_policy.csv")
+	}
+	if len(runSpec.PrereqCacheDir) > 0 {
+		remote.PrereqCacheDir = path.Join(flagRemoteDir, "prereq-cache")
+	}
+	return &remote
+}
+
+/*
+ * GetRemoteKillCommand returns sh command that sends the remote runner a
+ * second SIGTERM, on which it kills its scripts, then after kKillRunnerGrace
+ * kills its process group, and the process groups of scripts that are
+ * left in its ssh session.  pidPath is quoted path of pid file of runner,
+ * which is the session leader.
+ */
+func GetRemoteKillCommand(pidPath string) string {
+	script := fmt.Sprintf("P=$(cat %s) || exit 1; kill -TERM $P; sleep %d; kill -KILL -- -$P; pkill -KILL -s $P; true",
+		pidPath, int(kKillRunnerGrace.Seconds()))
+	return remoteSudo() + "sh -c " + ShellQuote(script)
+}
+
+/*
+ * GoArtRunTestRemote runs test on remote host, and copies its results dir
+ * back, as GoArtRunTest does locally.  Cancel is forwarded by sending
+ * SIGTERM to the remote runner, and kill by killing its session, see
+ * SignalRunners().
+ */
+func GoArtRunTestRemote(testRun *SingleTestRun, runSpec *types.RunSpec) {
+	fmt.Printf("Running test %s [%d] %s \"%s\" on %s\n", testRun.criteria.Technique, testRun.criteria.TestIndex, testRun.criteria.TestGuid, testRun.criteria.TestName, flagRemote)
+
+	if err := UploadRemoteAtomics(testRun.criteria.Technique); err != nil {
+		fmt.Println("ERROR: unable to copy atomics to remote host", err)
+		SetTestRunStatus(testRun, types.StatusRunnerFailure)
+		return
+	}
+	remote := GetRemoteRunSpec(runSpec)
+	data, _ := json.Marshal(remote)
+
+	dirs := ShellQuote(remote.TempDir) + " " + ShellQuote(remote.ResultsDir)
+	pidPath := ShellQuote(remote.ResultsDir + ".pid")
+	runnerPath := ShellQuote(path.Join(flagRemoteDir, "bin", "goartrun"))
+	cmd := SshCommand(fmt.Sprintf("mkdir -p -m 777 %s && echo $$ > %s && exec %s%s --config -", dirs, pidPath, remoteSudo(), runnerPath))
+	cmd.Stdin = bytes.NewReader(data)
+
+	gRunnersMutex.Lock()
+	gRemoteCancels[cmd] = func() {
+		RunSsh(fmt.Sprintf("%skill -TERM $(cat %s)", remoteSudo(), pidPath), nil)
+	}
+	gRemoteKills[cmd] = func() {
+		RunSsh(GetRemoteKillCommand(pidPath), nil)
+	}
+	gRunnersMutex.Unlock()
+
+	output, err := RunRunner(cmd)
+	if err != nil {
+		fmt.Println("  runner error:", err)
+	} else {
+		fmt.Println("  runner finished without error")
+	}
+
+	gRunnersMutex.Lock()
+	delete(gRemoteCancels, cmd)
+	delete(gRemoteKills, cmd)
+	gRunnersMutex.Unlock()
+
+	outPath := filepath.FromSlash(testRun.resultsDir + "/runner-stdout.txt")
+	err = os.WriteFile(outPath, output, 0644)
+	if err != nil {
+		fmt.Println("ERROR: unable to write file", outPath, err)
+	}
+
+	SetRunnerExitStatus(testRun, cmd)
+	if testRun.exitCode == 255 {
+		SetTestRunStatus(testRun, types.StatusRunnerFailure) // ssh failed
+	}
+
+	// copy back results, and remove remote dirs
+
+	results, err := RunSsh("tar -cf - -C "+ShellQuote(remote.ResultsDir)+" .", nil)
+	if err == nil {
+		err = ExtractTar(bytes.NewReader(results), testRun.resultsDir)
+	}
+	if err != nil {
+		fmt.Println("ERROR: unable to copy results from remote host", err)
+	}
+	_, err = RunSsh(fmt.Sprintf("%srm -rf %s %s", remoteSudo(), dirs, pidPath), nil)
+	if err != nil {
+		fmt.Println("WARNING: unable to remove remote dirs", err)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+)
+
+// runs the remote command locally, ignoring ssh options and host
+const kFakeSsh = `#!/bin/sh
+for a; do last="$a"; done
+exec sh -c "$last"
+`
+
+// writes run_summary.json to ResultsDir of RunSpec on stdin
+const kFakeRemoteRunner = `#!/bin/sh
+dir=$(sed -n 's/.*"ResultsDir":"\([^"]*\)".*/\1/p')
+echo '{"StartTime":1,"EndTime":2,"IsCleanedUp":true}' > "$dir/run_summary.json"
+echo ran remote
+exit 9
+`
+
+func TestShellQuote(t *testing.T) {
+	assert.Equal(t, `'/tmp/a b'`, ShellQuote("/tmp/a b"))
+	assert.Equal(t, `'it'\''s'`, ShellQuote("it's"))
+}
+
+func TestRemoteKillCommand(t *testing.T) {
+	defer func() { flagRemoteSudo = false }()
+	flagRemoteSudo = true
+	assert.Equal(t, `sudo -n sh -c 'P=$(cat '\''/tmp/r/T1_1.pid'\'') || exit 1; kill -TERM $P; sleep 2; kill -KILL -- -$P; pkill -KILL -s $P; true'`,
+		GetRemoteKillCommand(ShellQuote("/tmp/r/T1_1.pid")))
+}
+
+func TestGoArtRunTestRemote(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake ssh is sh script")
+	}
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "ssh"), []byte(kFakeSsh), 0755)
+	os.WriteFile(filepath.Join(dir, "goartrun"), []byte(kFakeRemoteRunner), 0755)
+	os.MkdirAll(filepath.Join(dir, "atomics", "T1070.004", "src"), 0755)
+	os.WriteFile(filepath.Join(dir, "atomics", "T1070.004", "T1070.004.yaml"), []byte("attack_technique: T1070.004\n"), 0644)
+
+	prevSsh, prevAtomics, prevGoArt := gSshPath, flagAtomicsPath, flagGoArtRunnerPath
+	defer func() {
+		gSshPath, flagAtomicsPath, flagGoArtRunnerPath = prevSsh, prevAtomics, prevGoArt
+		flagRemote, flagRemoteDir = "", "/tmp/atomic-harness"
+		gRemoteAtomics = map[string]bool{}
+	}()
+	gSshPath = filepath.Join(dir, "ssh")
+	flagAtomicsPath = filepath.Join(dir, "atomics")
+	flagGoArtRunnerPath = filepath.Join(dir, "goartrun")
+	flagRemote = "lab@vm1"
+	flagRemoteDir = filepath.Join(dir, "remote")
+
+	assert.True(t, PrepareRemote())
+	info, err := os.Stat(filepath.Join(dir, "remote", "bin", "goartrun"))
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+	rec := &types.AtomicTestCriteria{}
+	rec.Technique = "T1070.004"
+	rec.TestIndex = 1
+	resultsDir := filepath.Join(dir, "results", "T1070.004_1")
+	os.MkdirAll(resultsDir, 0755)
+	runSpec := &types.RunSpec{Technique: "T1070.004", AtomicsDir: flagAtomicsPath, TempDir: filepath.Join(dir, "artwork-T1070.004_1-123"), ResultsDir: resultsDir}
+
+	remote := GetRemoteRunSpec(runSpec)
+	assert.Equal(t, filepath.Join(dir, "remote", "atomics"), remote.AtomicsDir)
+	assert.Equal(t, "/tmp/artwork-T1070.004_1-123", remote.TempDir)
+	assert.Equal(t, filepath.Join(dir, "remote", "results", "T1070.004_1"), remote.ResultsDir)
+
+	testRun := &SingleTestRun{criteria: rec, resultsDir: resultsDir}
+	GoArtRunTestRemote(testRun, runSpec)
+	assert.Equal(t, types.StatusTestSuccess, testRun.status)
+
+	_, err = os.Stat(filepath.Join(dir, "remote", "atomics", "T1070.004", "T1070.004.yaml"))
+	assert.Nil(t, err)
+	stdout, _ := os.ReadFile(filepath.Join(resultsDir, "runner-stdout.txt"))
+	assert.Equal(t, "ran remote\n", string(stdout))
+
+	UpdateTimestampsFromRunSummary(testRun)
+	assert.Equal(t, int64(2), testRun.EndTime)
+	assert.True(t, testRun.isCleanedUp)
+
+	_, err = os.Stat(remote.ResultsDir)
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(remote.TempDir)
+	assert.True(t, os.IsNotExist(err))
+}
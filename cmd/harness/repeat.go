@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+)
+
+const kRepeatConsecutive = "consecutive"
+const kRepeatInterleaved = "interleaved"
+
+var flagRepeat int
+var flagRepeatOrder string
+
+func init() {
+	flag.IntVar(&flagRepeat, "repeat", 1, "run each selected test N times, to find tests with flaky telemetry. See repeat_summary.json in results")
+	flag.StringVar(&flagRepeatOrder, "repeatorder", kRepeatConsecutive, "with --repeat, "+kRepeatConsecutive+" runs each test N times in a row, "+kRepeatInterleaved+" runs the list of tests N times")
+}
+
+// a test to run, and which iteration of it
+type TestIteration struct {
+	criteria  *types.AtomicTestCriteria
+	iteration int // 1-based with --repeat, 0 otherwise
+}
+
+func IsRepeatRun() bool {
+	return flagRepeat > 1
+}
+
+// CheckRepeatFlags returns error if --repeat combined with unsupported flags
+func CheckRepeatFlags() error {
+	if flagRepeatOrder != kRepeatConsecutive && flagRepeatOrder != kRepeatInterleaved {
+		return fmt.Errorf("--repeatorder should be %s or %s", kRepeatConsecutive, kRepeatInterleaved)
+	}
+	if IsRepeatRun() && (len(flagResume) > 0 || len(flagRevalidate) > 0) {
+		return fmt.Errorf("--repeat is not supported with --resume or --revalidate")
+	}
+	return nil
+}
+
+/*
+ * GetTestIterations returns the criteria of gTestSpecs in run order.
+ * With --repeat, each iteration has its own copy of the criteria, since
+ * validation results are stored in them.
+ */
+func GetTestIterations() []TestIteration {
+	ret := []TestIteration{}
+	if !IsRepeatRun() {
+		for _, spec := range gTestSpecs {
+			for _, rec := range spec.Criteria {
+				ret = append(ret, TestIteration{rec, 0})
+			}
+		}
+		return ret
+	}
+
+	if flagRepeatOrder == kRepeatInterleaved {
+		for i := 1; i <= flagRepeat; i++ {
+			for _, spec := range gTestSpecs {
+				for _, rec := range spec.Criteria {
+					ret = append(ret, TestIteration{CopyCriteria(rec), i})
+				}
+			}
+		}
+		return ret
+	}
+
+	for _, spec := range gTestSpecs {
+		for _, rec := range spec.Criteria {
+			for i := 1; i <= flagRepeat; i++ {
+				ret = append(ret, TestIteration{CopyCriteria(rec), i})
+			}
+		}
+	}
+	return ret
+}
+
+// deep copy, without validation results
+func CopyCriteria(src *types.AtomicTestCriteria) *types.AtomicTestCriteria {
+	dest := *src
+
+	dest.Args = map[string]string{}
+	for k, v := range src.Args {
+		dest.Args[k] = v
+	}
+
+	dest.ExpectedEvents = []*types.ExpectedEvent{}
+	for _, exp := range src.ExpectedEvents {
+		obj := *exp
+		obj.FieldChecks = append([]types.FieldCriteria{}, exp.FieldChecks...)
+		obj.Matches = nil
+		obj.RawMatches = nil
+		obj.NearMisses = nil
+		dest.ExpectedEvents = append(dest.ExpectedEvents, &obj)
+	}
+
+	dest.MitreTestCriteria.ExpectedCorrelations = []*types.CorrelationRow{}
+	for _, corr := range src.MitreTestCriteria.ExpectedCorrelations {
+		obj := *corr
+		obj.EventIndexes = append([]string{}, corr.EventIndexes...)
+		obj.IsMet = false
+		dest.MitreTestCriteria.ExpectedCorrelations = append(dest.MitreTestCriteria.ExpectedCorrelations, &obj)
+	}
+
+	dest.ExpectedCorrelations = []types.CorrelationRow{}
+	for _, corr := range src.ExpectedCorrelations {
+		corr.EventIndexes = append([]string{}, corr.EventIndexes...)
+		corr.IsMet = false
+		dest.ExpectedCorrelations = append(dest.ExpectedCorrelations, corr)
+	}
+	return &dest
+}
+
+func GetTestResultsDir(rec *types.AtomicTestCriteria, iteration int) string {
+	name := rec.Technique + "_" + fmt.Sprintf("%d", rec.TestIndex) + "_" + rec.TestGuid
+	if iteration > 0 {
+		name += fmt.Sprintf("_r%d", iteration)
+	}
+	return filepath.FromSlash(flagResultsPath + "/" + name)
+}
+
+// true if telemetry was validated for the test run
+func IsValidatedStatus(status types.TestStatus) bool {
+	return status == types.StatusValidateSuccess || status == types.StatusValidatePartial || status == types.StatusValidateFail
+}
+
+/*
+ * GetRepeatSummaries groups test runs by criteria, in run order, and
+ * computes how often each expected event was found.  A test is flaky
+ * if the status of its iterations differ.  Skipped and cancelled
+ * iterations are not considered.
+ */
+func GetRepeatSummaries(tests []*SingleTestRun) []*types.RepeatSummary {
+	ret := []*types.RepeatSummary{}
+	byId := map[string]*types.RepeatSummary{}
+	runsById := map[string][]*SingleTestRun{}
+
+	for _, t := range tests {
+		id := t.criteria.Id()
+		summary, ok := byId[id]
+		if !ok {
+			summary = &types.RepeatSummary{Id: id, TestName: t.criteria.TestName}
+			byId[id] = summary
+			ret = append(ret, summary)
+		}
+		summary.Iterations = append(summary.Iterations, types.RepeatIteration{Iteration: t.iteration,
+			Status: t.status, StatusName: t.status.String(), MatchString: t.matchString})
+		runsById[id] = append(runsById[id], t)
+	}
+
+	for _, summary := range ret {
+		runs := runsById[summary.Id]
+		first := runs[0].criteria
+
+		statuses := map[types.TestStatus]bool{}
+		for _, t := range runs {
+			if t.status != types.StatusSkipped && t.status != types.StatusCancelled {
+				statuses[t.status] = true
+			}
+		}
+		summary.IsFlaky = len(statuses) > 1
+
+		for i, exp := range first.ExpectedEvents {
+			rate := types.EventHitRate{Id: exp.Id, EventType: exp.EventType}
+			for _, t := range runs {
+				if !IsValidatedStatus(t.status) || i >= len(t.criteria.ExpectedEvents) {
+					continue
+				}
+				rate.Total += 1
+				if len(t.criteria.ExpectedEvents[i].Matches) > 0 {
+					rate.Hits += 1
+				}
+			}
+			summary.EventRates = append(summary.EventRates, CalcHitRate(rate))
+		}
+		for i := range first.ExpectedCorrelations {
+			rate := types.EventHitRate{Id: fmt.Sprintf("%d", i), EventType: "Correlation"}
+			for _, t := range runs {
+				if !IsValidatedStatus(t.status) || i >= len(t.criteria.ExpectedCorrelations) {
+					continue
+				}
+				rate.Total += 1
+				if t.criteria.ExpectedCorrelations[i].IsMet {
+					rate.Hits += 1
+				}
+			}
+			summary.EventRates = append(summary.EventRates, CalcHitRate(rate))
+		}
+	}
+	return ret
+}
+
+func CalcHitRate(rate types.EventHitRate) types.EventHitRate {
+	if rate.Total > 0 {
+		rate.Rate = float64(rate.Hits) / float64(rate.Total)
+	}
+	return rate
+}
+
+func WriteRepeatSummary(tests []*SingleTestRun) {
+	j, err := json.MarshalIndent(GetRepeatSummaries(tests), "", "  ")
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		return
+	}
+	outPath := filepath.FromSlash(flagResultsPath + "/repeat_summary.json")
+	err = os.WriteFile(outPath, j, 0644)
+	if err != nil {
+		fmt.Println("ERROR: unable to write file", outPath, err)
+	}
+}
+
+// SPrintFlakySummary lists tests whose iterations had different status
+func SPrintFlakySummary(tests []*SingleTestRun) string {
+	s := ""
+	numFlaky := 0
+	for _, summary := range GetRepeatSummaries(tests) {
+		if !summary.IsFlaky {
+			continue
+		}
+		numFlaky += 1
+		counts := map[string]int{}
+		names := []string{}
+		for _, iter := range summary.Iterations {
+			if _, ok := counts[iter.StatusName]; !ok {
+				names = append(names, iter.StatusName)
+			}
+			counts[iter.StatusName] += 1
+		}
+		s += fmt.Sprintf("  FLAKY %s ", summary.Id)
+		for _, name := range names {
+			s += fmt.Sprintf(" %s:%d", name, counts[name])
+		}
+		for _, rate := range summary.EventRates {
+			if rate.Total > 0 && rate.Hits < rate.Total {
+				s += fmt.Sprintf(" %s#%s:%d/%d", rate.EventType, rate.Id, rate.Hits, rate.Total)
+			}
+		}
+		s += "\n"
+	}
+	return fmt.Sprintf("=== Repeat:%d Flaky:%d\n", flagRepeat, numFlaky) + s
+}
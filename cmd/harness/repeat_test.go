@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+)
+
+func TestRepeatIterations(t *testing.T) {
+	mkrec := func(tid string) *types.AtomicTestCriteria {
+		rec := &types.AtomicTestCriteria{}
+		rec.Technique = tid
+		rec.TestIndex = 1
+		rec.ExpectedEvents = []*types.ExpectedEvent{{Id: "0", EventType: "Process"}, {Id: "1", EventType: "File"}}
+		rec.ExpectedCorrelations = []types.CorrelationRow{{Id: "0", Type: "Process"}}
+		return rec
+	}
+	gTestSpecs = []*types.TestSpec{
+		{Technique: "T1005", Criteria: []*types.AtomicTestCriteria{mkrec("T1005")}},
+		{Technique: "T1070.004", Criteria: []*types.AtomicTestCriteria{mkrec("T1070.004")}},
+	}
+	flagRepeat = 3
+	defer func() {
+		flagRepeat = 1
+		flagRepeatOrder = kRepeatConsecutive
+	}()
+
+	items := GetTestIterations()
+	assert.Equal(t, 6, len(items))
+	assert.Equal(t, "T1005", items[2].criteria.Technique)
+	assert.Equal(t, 3, items[2].iteration)
+
+	flagRepeatOrder = kRepeatInterleaved
+	items = GetTestIterations()
+	assert.Equal(t, "T1070.004", items[1].criteria.Technique)
+	assert.Equal(t, 1, items[1].iteration)
+	assert.Equal(t, "T1005", items[2].criteria.Technique)
+	assert.Equal(t, 2, items[2].iteration)
+
+	// copies do not share validation results
+	items[0].criteria.ExpectedEvents[0].Matches = []*types.SimpleEvent{{}}
+	items[0].criteria.ExpectedCorrelations[0].IsMet = true
+	assert.Nil(t, items[2].criteria.ExpectedEvents[0].Matches)
+	assert.Nil(t, gTestSpecs[0].Criteria[0].ExpectedEvents[0].Matches)
+	assert.False(t, items[2].criteria.ExpectedCorrelations[0].IsMet)
+
+	// T1005: found process all 3 times, file once
+	runs := []*SingleTestRun{}
+	for i, status := range []types.TestStatus{types.StatusValidateSuccess, types.StatusValidatePartial, types.StatusValidatePartial} {
+		testRun := &SingleTestRun{criteria: CopyCriteria(gTestSpecs[0].Criteria[0]), iteration: i + 1, status: status}
+		testRun.criteria.ExpectedEvents[0].Matches = []*types.SimpleEvent{{}}
+		if i == 0 {
+			testRun.criteria.ExpectedEvents[1].Matches = []*types.SimpleEvent{{}}
+		}
+		runs = append(runs, testRun)
+	}
+	// T1070.004: same each time, one iteration skipped
+	for i, status := range []types.TestStatus{types.StatusValidateFail, types.StatusSkipped, types.StatusValidateFail} {
+		runs = append(runs, &SingleTestRun{criteria: CopyCriteria(gTestSpecs[1].Criteria[0]), iteration: i + 1, status: status})
+	}
+
+	summaries := GetRepeatSummaries(runs)
+	assert.Equal(t, 2, len(summaries))
+	assert.True(t, summaries[0].IsFlaky)
+	assert.Equal(t, 3, len(summaries[0].Iterations))
+	assert.Equal(t, types.EventHitRate{Id: "0", EventType: "Process", Hits: 3, Total: 3, Rate: 1.0}, summaries[0].EventRates[0])
+	assert.Equal(t, 1, summaries[0].EventRates[1].Hits)
+	assert.Equal(t, "Correlation", summaries[0].EventRates[2].EventType)
+	assert.False(t, summaries[1].IsFlaky)
+	assert.Equal(t, 2, summaries[1].EventRates[0].Total)
+
+	s := SPrintFlakySummary(runs)
+	assert.Contains(t, s, "=== Repeat:3 Flaky:1")
+	assert.Contains(t, s, "Validated:1 Partial:2 File#1:1/3 Correlation#0:0/3")
+}
@@ -0,0 +1,242 @@
+package main
+
+/*
+ * report.html: self-contained HTML report of a results dir, with no
+ * external assets, so it can be attached to tickets.  A sortable table of
+ * all tests, and per test the expected events with matched raw events, near
+ * misses of events not found, the interpolated commands and runner stdout.
+ * Written at end of a run, along with navigator_layer.json, or for an
+ * existing results dir with --report.
+ */
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+	utils "github.com/secureworks/atomic-harness/pkg/utils"
+)
+
+const kReportFileName = "report.html"
+const kReportStdoutBytes = 64 * 1024
+
+var flagReport string
+
+func init() {
+	flag.StringVar(&flagReport, "report", "", "path to previous resultsdir, write its report.html and navigator_layer.json and exit")
+}
+
+type ReportToolResult struct {
+	Suffix      string
+	MatchString string
+	Summary     ExtractState
+}
+
+type ReportTest struct {
+	Anchor      string
+	Progress    types.TestProgress
+	Result      string // pass, failure, skipped, see JUnitResult()
+	Dir         string // name of test results dir
+	MatchString string
+	Tools       []*ReportToolResult
+	Stages      []types.PlanStage
+	Stdout      string
+}
+
+type Report struct {
+	ResultsDir string
+	Generated  string
+	Counts     map[string]int // Result -> num tests
+	Tests      []*ReportTest
+}
+
+// name of test results dir, see GetTestResultsDir()
+func GetReportTestDirName(progress *types.TestProgress) string {
+	name := progress.Technique + "_" + progress.TestIndex + "_" + progress.TestGuid
+	if progress.Iteration > 0 {
+		name += fmt.Sprintf("_r%d", progress.Iteration)
+	}
+	return name
+}
+
+// last maxBytes of file, or empty if not found
+func readFileTail(path string, maxBytes int) string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	if len(data) > maxBytes {
+		return "...\n" + string(data[len(data)-maxBytes:])
+	}
+	return string(data)
+}
+
+// LoadReport loads status.json of resultsDir and files of each test
+func LoadReport(resultsDir string) (*Report, error) {
+	data, err := os.ReadFile(filepath.Join(resultsDir, "status.json"))
+	if err != nil {
+		return nil, err
+	}
+	progress := []types.TestProgress{}
+	if err = json.Unmarshal(data, &progress); err != nil {
+		return nil, fmt.Errorf("invalid status.json: %v", err)
+	}
+
+	report := &Report{ResultsDir: resultsDir, Generated: time.Now().Format(time.RFC1123), Counts: map[string]int{}}
+	for i, p := range progress {
+		test := &ReportTest{Anchor: fmt.Sprintf("test-%d", i+1), Progress: p, Result: JUnitResult(p.Status)}
+		test.Dir = GetReportTestDirName(&p)
+		testDir := filepath.Join(resultsDir, test.Dir)
+		report.Counts[test.Result] += 1
+
+		matchString, _ := os.ReadFile(filepath.Join(testDir, "match_string.txt"))
+		test.MatchString = string(matchString)
+
+		paths, _ := filepath.Glob(filepath.Join(testDir, "validate_summary*.json"))
+		for _, path := range paths {
+			tool := &ReportToolResult{}
+			tool.Suffix = strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), "validate_summary"), ".json")
+			data, err := os.ReadFile(path)
+			if err != nil || json.Unmarshal(data, &tool.Summary) != nil {
+				fmt.Println("WARNING: unable to load", path, err)
+				continue
+			}
+			matchString, _ := os.ReadFile(filepath.Join(testDir, "match_string"+tool.Suffix+".txt"))
+			tool.MatchString = string(matchString)
+			test.Tools = append(test.Tools, tool)
+		}
+
+		atomicTest := &types.AtomicTest{}
+		data, err = os.ReadFile(filepath.Join(testDir, "run_summary.json"))
+		if err == nil && json.Unmarshal(data, atomicTest) == nil && atomicTest.Executor != nil {
+			test.Stages = utils.GetInterpolatedStages(atomicTest, atomicTest.BaseDir, atomicTest.ArgsUsed)
+		}
+
+		test.Stdout = readFileTail(filepath.Join(testDir, "runner-stdout.txt"), kReportStdoutBytes)
+		report.Tests = append(report.Tests, test)
+	}
+	return report, nil
+}
+
+// indents raw telemetry event if it is json
+func prettyJson(raw string) string {
+	var obj interface{}
+	if json.Unmarshal([]byte(raw), &obj) != nil {
+		return raw
+	}
+	data, err := json.MarshalIndent(obj, "", "  ")
+	if err != nil {
+		return raw
+	}
+	return string(data)
+}
+
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"describe":  DescribeExpectedEvent,
+	"telemChar": GetTelemChar,
+	"pretty":    prettyJson,
+}).Parse(kReportTemplate))
+
+// WriteReports writes report.html and navigator_layer.json in resultsDir
+func WriteReports(resultsDir string) error {
+	report, err := LoadReport(resultsDir)
+	if err != nil {
+		return err
+	}
+	if err = WriteHtmlReport(report); err != nil {
+		return err
+	}
+	return WriteNavigatorLayer(report)
+}
+
+func WriteHtmlReport(report *Report) error {
+	sb := &strings.Builder{}
+	if err := reportTemplate.Execute(sb, report); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(report.ResultsDir, kReportFileName), []byte(sb.String()), 0644)
+}
+
+const kReportTemplate = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>atomic-harness report {{.ResultsDir}}</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; margin: 1em 2em; }
+table { border-collapse: collapse; margin: 0.5em 0; }
+th, td { border: 1px solid #ccc; padding: 3px 8px; text-align: left; vertical-align: top; }
+#tests th { background: #eee; cursor: pointer; user-select: none; }
+tr.pass td.status { background: #d4f7d4; }
+tr.failure td.status { background: #f7d4d4; }
+tr.skipped td.status { background: #eee; }
+pre { background: #f6f6f6; padding: 6px; overflow-x: auto; max-height: 30em; margin: 2px 0; }
+.missing { color: #b00; font-weight: bold; }
+.found { color: #070; font-weight: bold; }
+section { border-top: 2px solid #999; margin-top: 2em; }
+code { font-size: 13px; }
+</style>
+</head>
+<body>
+<h1>atomic-harness report</h1>
+<p>{{.ResultsDir}}<br>generated {{.Generated}}<br>
+{{len .Tests}} tests: {{index .Counts "pass"}} passed, {{index .Counts "failure"}} failed, {{index .Counts "skipped"}} skipped</p>
+
+<table id="tests">
+<thead><tr><th>Technique</th><th>#</th><th>Iteration</th><th>Name</th><th>Status</th><th>Match</th></tr></thead>
+<tbody>
+{{range .Tests}}<tr class="{{.Result}}"><td>{{.Progress.Technique}}</td><td>{{.Progress.TestIndex}}</td><td>{{if .Progress.Iteration}}{{.Progress.Iteration}}{{end}}</td>
+<td><a href="#{{.Anchor}}">{{.Progress.TestName}}</a></td><td class="status">{{.Progress.Status}}</td><td><code>{{.MatchString}}</code></td></tr>
+{{end}}</tbody>
+</table>
+
+{{range .Tests}}
+<section id="{{.Anchor}}">
+<h2>{{.Progress.Technique}} [{{.Progress.TestIndex}}] {{.Progress.TestName}}{{if .Progress.Iteration}} #{{.Progress.Iteration}}{{end}}</h2>
+<p>Status <b>{{.Progress.Status}}</b>, runner exit code {{.Progress.ExitCode}}{{if .Progress.UnsafeRule}}, refused by safety rule <code>{{.Progress.UnsafeRule}}</code>{{end}}{{if .Progress.IsDirty}}, residue found after cleanup{{end}}<br>
+<code>{{.Dir}}</code> {{.Progress.TestGuid}}</p>
+{{range .Tools}}
+<h3>Expected events{{if .Suffix}} ({{.Suffix}}){{end}} <code>{{.MatchString}}</code></h3>
+<table>
+{{range .Summary.TestData.ExpectedEvents}}<tr><td><code>{{telemChar .}}</code></td><td>{{describe .}}</td>
+<td>{{if .Matches}}<span class="found">{{len .Matches}} matched</span>{{if lt (len .RawMatches) (len .Matches)}}, first {{len .RawMatches}} shown{{end}}
+{{range .RawMatches}}<details><summary>matched event</summary><pre>{{pretty .}}</pre></details>{{end}}
+{{else}}<span class="missing">not found</span>
+{{range .NearMisses}}<details><summary>near miss, {{.NumChecksMet}} field checks met</summary><pre>{{pretty .Raw}}</pre></details>{{end}}
+{{end}}</td></tr>
+{{end}}{{range .Summary.TestData.ExpectedCorrelations}}<tr><td><code>C</code></td><td>{{.Type}} {{.SubType}} {{.EventIndexes}}</td>
+<td>{{if .IsMet}}<span class="found">met</span>{{else}}<span class="missing">not met</span>{{end}}</td></tr>
+{{end}}</table>
+{{end}}
+{{if .Stages}}<details><summary>Commands</summary>
+{{range .Stages}}{{if .Command}}<p>{{.Stage}} ({{.Executor}})</p><pre>{{.Command}}</pre>{{end}}{{end}}
+</details>{{end}}
+{{if .Stdout}}<details><summary>Runner stdout</summary><pre>{{.Stdout}}</pre></details>{{end}}
+</section>
+{{end}}
+
+<script>
+document.querySelectorAll("#tests th").forEach(function(th, col) {
+  th.addEventListener("click", function() {
+    var tbody = th.closest("table").tBodies[0];
+    var asc = th.dataset.order !== "asc";
+    th.closest("tr").querySelectorAll("th").forEach(function(h) { delete h.dataset.order; });
+    th.dataset.order = asc ? "asc" : "desc";
+    var rows = Array.prototype.slice.call(tbody.rows);
+    rows.sort(function(a, b) {
+      var r = a.cells[col].textContent.localeCompare(b.cells[col].textContent, undefined, {numeric: true});
+      return asc ? r : -r;
+    });
+    rows.forEach(function(row) { tbody.appendChild(row); });
+  });
+});
+</script>
+</body>
+</html>
+`
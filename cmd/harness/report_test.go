@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+)
+
+func TestWriteHtmlReport(t *testing.T) {
+	dir := t.TempDir()
+	progress := []types.TestProgress{
+		{Technique: "T1070.004", TestIndex: "2", TestName: "Delete <dir>", TestGuid: "abcd", State: types.StateDone, Status: types.StatusValidatePartial},
+		{Technique: "T1485", TestIndex: "1", TestName: "Overwrite", TestGuid: "ef01", State: types.StateDone, Status: types.StatusUnsafe, UnsafeRule: "deny,dd"},
+	}
+	data, _ := json.Marshal(progress)
+	os.WriteFile(filepath.Join(dir, "status.json"), data, 0644)
+
+	testDir := filepath.Join(dir, "T1070.004_2_abcd")
+	os.Mkdir(testDir, 0755)
+	os.WriteFile(filepath.Join(testDir, "match_string.txt"), []byte("P<F>"), 0644)
+	os.WriteFile(filepath.Join(testDir, "runner-stdout.txt"), []byte("rm: cannot remove\n"), 0644)
+
+	summary := ExtractState{}
+	summary.TestData.ExpectedEvents = []*types.ExpectedEvent{
+		{EventType: "Process", FieldChecks: []types.FieldCriteria{{FieldName: "cmdline", Op: "~=", Value: "rm -rf"}},
+			Matches: []*types.SimpleEvent{{}}, RawMatches: []string{`{"cmdline":"rm -rf /tmp/victim"}`}},
+		{EventType: "File", SubType: "DELETE", FieldChecks: []types.FieldCriteria{{FieldName: "path", Op: "=", Value: "/tmp/victim"}},
+			NearMisses: []*types.NearMiss{{NumChecksMet: 1, Raw: `{"path":"/tmp/victim2"}`}}},
+	}
+	data, _ = json.Marshal(summary)
+	os.WriteFile(filepath.Join(testDir, "validate_summary.json"), data, 0644)
+
+	atomicTest := types.AtomicTest{Name: "Delete dir", BaseDir: "/atomics", ArgsUsed: map[string]string{"dir": "/tmp/victim"}}
+	atomicTest.Executor = &types.AtomicExecutor{Name: "sh", Command: "rm -rf #{dir}", CleanupCommand: "true"}
+	data, _ = json.Marshal(atomicTest)
+	os.WriteFile(filepath.Join(testDir, "run_summary.json"), data, 0644)
+
+	assert.Nil(t, WriteReports(dir))
+	data, err := os.ReadFile(filepath.Join(dir, kReportFileName))
+	assert.Nil(t, err)
+	s := string(data)
+
+	assert.Contains(t, s, "2 tests: 0 passed, 1 failed, 1 skipped")
+	assert.Contains(t, s, `<a href="#test-1">Delete &lt;dir&gt;</a>`)
+	assert.Contains(t, s, `<code>P&lt;F&gt;</code>`)
+	assert.Contains(t, s, "<pre>rm -rf /tmp/victim</pre>") // interpolated command
+	assert.Contains(t, s, "1 matched")
+	assert.Contains(t, s, `&#34;cmdline&#34;: &#34;rm -rf /tmp/victim&#34;`)
+	assert.Contains(t, s, "near miss, 1 field checks met")
+	assert.Contains(t, s, "/tmp/victim2")
+	assert.Contains(t, s, "rm: cannot remove")
+	assert.Contains(t, s, "refused by safety rule <code>deny,dd</code>")
+	assert.False(t, strings.Contains(s, "<link") || strings.Contains(s, "src="), "no external assets")
+
+	_, err = LoadReport(t.TempDir())
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"path/filepath"
+	"strings"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+)
+
+var flagSkipResidueCheck bool
+
+func init() {
+	flag.BoolVar(&flagSkipResidueCheck, "skipresiduecheck", false, "don't have runner check for files, crontabs, systemd units, users and listening sockets left after cleanup")
+}
+
+/*
+ * GetCriteriaPaths returns absolute paths of expected event field checks,
+ * e.g. path=/etc/ufw/ufw.conf, for runner residue check.
+ */
+func GetCriteriaPaths(rec *types.AtomicTestCriteria) []string {
+	ret := []string{}
+	for _, exp := range rec.ExpectedEvents {
+		for _, check := range exp.FieldChecks {
+			if check.Op != "=" || !strings.Contains(check.FieldName, "path") {
+				continue
+			}
+			if filepath.IsAbs(check.Value) || strings.HasPrefix(check.Value, "~") {
+				ret = append(ret, check.Value)
+			}
+		}
+	}
+	return ret
+}
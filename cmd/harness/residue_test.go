@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+	utils "github.com/secureworks/atomic-harness/pkg/utils"
+)
+
+func TestResidueSnapshotDiff(t *testing.T) {
+	dir := t.TempDir()
+	victim := filepath.Join(dir, "victim")
+	workDir := filepath.Join(dir, "work")
+	os.MkdirAll(victim, 0755)
+	os.MkdirAll(workDir, 0755)
+	os.WriteFile(filepath.Join(victim, "a"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(victim, "b"), []byte("b"), 0644)
+
+	paths := utils.GetResiduePaths(map[string]string{"dir": victim, "count": "3", "url": "http://x/y"}, []string{victim, "/", "/tmp", "/usr/bin/"})
+	assert.Equal(t, []string{victim}, paths)
+
+	before := utils.TakeHostSnapshot(paths, []string{workDir}, false)
+	assert.NotNil(t, before.Items["crontab"])
+
+	os.WriteFile(filepath.Join(victim, "a"), []byte("changed"), 0644)
+	os.Remove(filepath.Join(victim, "b"))
+	os.WriteFile(filepath.Join(victim, "c"), []byte("c"), 0644)
+	os.WriteFile(filepath.Join(workDir, "ignored"), []byte("x"), 0644)
+	// working dir of another runner in parallel
+	os.MkdirAll(filepath.Join(victim, "artwork-T1053.003_1-123"), 0755)
+
+	residue := utils.DiffHostSnapshots(before, utils.TakeHostSnapshot(paths, []string{workDir}, false))
+	assert.Equal(t, []types.ResidueItem{
+		{Category: "file", Name: filepath.Join(victim, "a"), Change: "modified"},
+		{Category: "file", Name: filepath.Join(victim, "b"), Change: "removed"},
+		{Category: "file", Name: filepath.Join(victim, "c"), Change: "added"},
+	}, residue)
+
+	// parallel run checks only files
+	snap := utils.TakeHostSnapshot(paths, nil, true)
+	assert.Equal(t, 1, len(snap.Items))
+	assert.Equal(t, 3, len(snap.Items["file"]))
+}
+
+func TestParseProcNetAddr(t *testing.T) {
+	assert.Equal(t, "127.0.0.1:8080", utils.ParseProcNetAddr("0100007F:1F90"))
+	assert.Equal(t, "0.0.0.0:4444", utils.ParseProcNetAddr("00000000:115C"))
+	assert.Equal(t, "[::1]:22", utils.ParseProcNetAddr("00000000000000000000000001000000:0016"))
+	assert.Equal(t, "", utils.ParseProcNetAddr("bogus"))
+}
+
+func TestResidueSummary(t *testing.T) {
+	rec := &types.AtomicTestCriteria{}
+	rec.Technique = "T1053.003"
+	rec.TestIndex = 1
+	rec.ExpectedEvents = []*types.ExpectedEvent{{EventType: "File", FieldChecks: []types.FieldCriteria{
+		{FieldName: "path", Op: "=", Value: "/etc/cron.d/art"},
+		{FieldName: "path", Op: "~=", Value: "/tmp/art"},
+		{FieldName: "cmdline", Op: "=", Value: "/bin/sh"}}}}
+	assert.Equal(t, []string{"/etc/cron.d/art"}, GetCriteriaPaths(rec))
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "run_summary.json"), []byte(`{"IsDirty":true,"Residue":[{"category":"crontab","name":"/etc/cron.d/art","change":"added"}]}`), 0644)
+	testRun := &SingleTestRun{criteria: rec, resultsDir: dir, state: types.StateDone, status: types.StatusValidateSuccess}
+	UpdateTimestampsFromRunSummary(testRun)
+	assert.True(t, testRun.isDirty)
+
+	s := SPrintState([]*SingleTestRun{testRun}, false)
+	assert.Contains(t, s, "\"\" dirty\n")
+	assert.Contains(t, s, "!!! 1 tests were dirty after cleanup")
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+	utils "github.com/secureworks/atomic-harness/pkg/utils"
+)
+
+var gResumeProgress = map[string]types.TestProgress{} // criteria Id -> status of interrupted run
+
+func ProgressId(entry *types.TestProgress) string {
+	if len(entry.TestGuid) > 0 {
+		return entry.Technique + "#" + entry.TestGuid
+	}
+	return entry.Technique + "#" + entry.TestIndex
+}
+
+func LoadRunInfo(resultsDir string) (*types.RunInfo, error) {
+	path := filepath.FromSlash(resultsDir + "/run_info.json")
+	body, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	info := &types.RunInfo{}
+	if err = json.Unmarshal(body, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func SaveRunInfo(resultsDir string, info *types.RunInfo) {
+	j, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		return
+	}
+	outPath := filepath.FromSlash(resultsDir + "/run_info.json")
+	err = os.WriteFile(outPath, j, 0644)
+	if err != nil {
+		fmt.Println("ERROR: unable to write file", outPath, err)
+	}
+}
+
+/*
+ * NewRunInfo returns info for a new run, or when resuming, the info
+ * of the interrupted run, so telemetry covers the original time range.
+ */
+func NewRunInfo(startTime int64) *types.RunInfo {
+	if len(flagResume) > 0 {
+		info, err := LoadRunInfo(flagResultsPath)
+		if err == nil && info.StartTime > 0 {
+			return info
+		}
+		info = &types.RunInfo{}
+		info.StartTime = GetEarliestRunStartTime(flagResultsPath)
+		if 0 == info.StartTime {
+			info.StartTime = startTime
+		}
+		fmt.Println("run_info.json missing, using start time of first test run", info.StartTime)
+		return info
+	}
+
+	info := &types.RunInfo{}
+	info.StartTime = startTime
+	for _, spec := range gTestSpecs {
+		for _, rec := range spec.Criteria {
+			info.TestIds = append(info.TestIds, rec.Id())
+		}
+	}
+	return info
+}
+
+// for results dirs made before run_info.json existed
+func GetEarliestRunStartTime(resultsDir string) int64 {
+	earliest := int64(0)
+	for _, entry := range gResumeProgress {
+		testRun := &SingleTestRun{}
+		testRun.resultsDir = filepath.FromSlash(resultsDir + "/" + entry.Technique + "_" + entry.TestIndex + "_" + entry.TestGuid)
+		UpdateTimestampsFromRunSummary(testRun)
+		if testRun.StartTime == 0 {
+			continue
+		}
+		sec := testRun.StartTime/1000000000 - 1
+		if 0 == earliest || sec < earliest {
+			earliest = sec
+		}
+	}
+	return earliest
+}
+
+/*
+ * LoadSpecsForResume reads status.json of interrupted run, and adds
+ * a spec for every test selected for the run to gTestSpecs.
+ * @return false if resultsDir does not contain a previous run
+ */
+func LoadSpecsForResume(resultsDir string) bool {
+	results := []types.TestProgress{}
+
+	path := filepath.FromSlash(resultsDir + "/status.json")
+	body, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Println("Failed to load", path, err)
+		return false
+	}
+	if len(body) > 0 {
+		if err = json.Unmarshal(body, &results); err != nil {
+			fmt.Println("failed to parse", path, err)
+			return false
+		}
+	}
+	for _, entry := range results {
+		gResumeProgress[ProgressId(&entry)] = entry
+	}
+
+	info, err := LoadRunInfo(resultsDir)
+	if err == nil && len(info.TestIds) > 0 {
+		return ParseTestSpecs(info.TestIds)
+	}
+
+	// older results dir, only have tests that were started
+
+	ids := []string{}
+	for _, entry := range results {
+		ids = append(ids, ProgressId(&entry))
+	}
+	return ParseTestSpecs(ids)
+}
+
+/*
+ * ResumeTestRun restores the state of testRun from interrupted run.
+ * Tests that are Done, or whose runner finished are not run again,
+ * unless they were cancelled, or refused by safety policy and --unsafe
+ * is now given.
+ * Tests whose runner finished successfully are set up for validation.
+ * @return true if test does not need to be run
+ */
+func ResumeTestRun(testRun *SingleTestRun) bool {
+	prev, ok := gResumeProgress[testRun.criteria.Id()]
+	if !ok {
+		return false
+	}
+	if prev.State < types.StateRunnerFinished || prev.State > types.StateSkip || prev.Status == types.StatusCancelled ||
+		(prev.Status == types.StatusUnsafe && flagUnsafe) {
+		if gVerbose {
+			fmt.Println("resume: re-running", testRun.criteria.Id(), prev.State, prev.Status)
+		}
+		return false
+	}
+
+	testRun.state = prev.State
+	testRun.status = prev.Status
+	testRun.exitCode = prev.ExitCode
+	testRun.isCleanedUp = prev.IsCleanedUp
+	testRun.unsafeRule = prev.UnsafeRule
+	testRun.isDirty = prev.IsDirty
+	testRun.namespaces = prev.Namespaces
+
+	matchString, _ := os.ReadFile(filepath.FromSlash(testRun.resultsDir + "/match_string.txt"))
+	testRun.matchString = string(matchString)
+
+	if prev.State == types.StateDone || prev.State == types.StateSkip || prev.Status != types.StatusTestSuccess {
+		return true
+	}
+
+	// runner finished, but telemetry was not validated
+
+	runConfig := &types.RunSpec{}
+	path := filepath.FromSlash(testRun.resultsDir + "/runspec.json")
+	body, err := os.ReadFile(path)
+	if err == nil {
+		err = json.Unmarshal(body, runConfig)
+	}
+	if err != nil {
+		fmt.Println("resume: unable to load", path, err, "re-running test")
+		return false
+	}
+	testRun.workingDir = runConfig.TempDir
+	testRun.state = types.StateRunnerFinished
+	UpdateTimestampsFromRunSummary(testRun)
+
+	utils.LoadAtomicDefaultArgs(testRun.criteria, filepath.FromSlash(flagAtomicsPath), gVerbose)
+
+	if false == SubstituteSysInfoArgs(testRun.criteria) || false == SubstituteVarsInCriteria(testRun.criteria) {
+		MarkAsSkipped(testRun)
+	}
+	return true
+}
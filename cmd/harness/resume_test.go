@@ -0,0 +1,66 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+)
+
+func TestResumeSpecs(t *testing.T) {
+	dir := t.TempDir()
+	gTestSpecs = []*types.TestSpec{}
+	gResumeProgress = map[string]types.TestProgress{}
+
+	status := `[
+  {"Technique":"T1053.003","TestIndex":"1","TestName":"Cron","TestGuid":"435057fb","State":5,"ExitCode":9,"Status":13},
+  {"Technique":"T1053.003","TestIndex":"2","TestName":"Cron 2","TestGuid":"b7d42afa","State":3,"ExitCode":7,"Status":7},
+  {"Technique":"T1560.002","TestIndex":"3","TestName":"Zip","TestGuid":"","State":2,"ExitCode":0,"Status":0},
+  {"Technique":"T1070.004","TestIndex":"1","TestName":"Rm","TestGuid":"","State":5,"ExitCode":16,"Status":16,"IsCleanedUp":true}
+]`
+	os.WriteFile(filepath.Join(dir, "status.json"), []byte(status), 0644)
+
+	info := &types.RunInfo{StartTime: 1700000000, TestIds: []string{"T1053.003#435057fb", "T1053.003#b7d42afa", "T1560.002#3", "T1070.004#2", "T1070.004#1"}}
+	SaveRunInfo(dir, info)
+
+	assert.True(t, LoadSpecsForResume(dir))
+	assert.Equal(t, 5, len(gTestSpecs))
+	assert.Equal(t, "435057fb", gTestSpecs[0].TestGuid)
+	assert.Equal(t, "3", gTestSpecs[2].TestIndex)
+
+	mkrun := func(tid string, index uint, guid string) *SingleTestRun {
+		testRun := &SingleTestRun{}
+		testRun.criteria = &types.AtomicTestCriteria{}
+		testRun.criteria.Technique = tid
+		testRun.criteria.TestIndex = index
+		testRun.criteria.TestGuid = guid
+		testRun.resultsDir = filepath.Join(dir, "none")
+		return testRun
+	}
+
+	// done
+	testRun := mkrun("T1053.003", 1, "435057fb")
+	assert.True(t, ResumeTestRun(testRun))
+	assert.Equal(t, types.StatusValidateSuccess, testRun.status)
+
+	// runner finished with prereq failure, not re-run
+	testRun = mkrun("T1053.003", 2, "b7d42afa")
+	assert.True(t, ResumeTestRun(testRun))
+	assert.Equal(t, types.StatusPreReqFail, testRun.status)
+
+	// interrupted while running
+	assert.False(t, ResumeTestRun(mkrun("T1560.002", 3, "")))
+
+	// cancelled
+	assert.False(t, ResumeTestRun(mkrun("T1070.004", 1, "")))
+
+	// never started
+	assert.False(t, ResumeTestRun(mkrun("T1070.004", 2, "")))
+
+	loaded, err := LoadRunInfo(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1700000000), loaded.StartTime)
+}
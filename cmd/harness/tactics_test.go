@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+	utils "github.com/secureworks/atomic-harness/pkg/utils"
+)
+
+func TestTacticSelection(t *testing.T) {
+	var err error
+	gMitreTactics, err = utils.LoadMitreTacticCsv("../../data/linux_techniques.csv")
+	assert.Nil(t, err)
+	assert.Equal(t, "TA0009", gMitreTactics[0].Id)
+	assert.Equal(t, "collection", gMitreTactics[0].ShortName)
+	assert.True(t, utils.StringInList("T1005", gMitreTactics[0].Techniques))
+
+	assert.Equal(t, "TA0005", FindTactic("defense-evasion").Id)
+	assert.Equal(t, "TA0005", FindTactic("ta0005").Id)
+	assert.Equal(t, "TA0005", FindTactic("Defense Evasion").Id)
+	assert.Nil(t, FindTactic("T1005"))
+
+	gAtomicTests = map[string][]*types.TestSpec{
+		"T1005":     {{Technique: "T1005", TestIndex: "1", TestGuid: "aaaaaaaa", Tactics: []string{"collection"}}},
+		"T1053.003": {{Technique: "T1053.003", TestIndex: "1", TestGuid: "435057fb", Tactics: []string{"persistence", "execution"}}},
+		"T1070.004": {{Technique: "T1070.004", TestIndex: "2", TestGuid: "bbbbbbbb", Tactics: []string{"defense-evasion"}}},
+	}
+	gTestSpecs = []*types.TestSpec{}
+
+	assert.True(t, ParseTestSpecs([]string{"TA0009", "T1070.004#2"}))
+	assert.True(t, AddTestsForTactics("persistence,execution"))
+	assert.Equal(t, 3, len(gTestSpecs))
+	assert.False(t, AddTestsForTactics("no-such-tactic"))
+
+	mkrun := func(tid string, index uint, status types.TestStatus) *SingleTestRun {
+		testRun := &SingleTestRun{status: status}
+		testRun.criteria = &types.AtomicTestCriteria{}
+		testRun.criteria.Technique = tid
+		testRun.criteria.TestIndex = index
+		return testRun
+	}
+	runs := []*SingleTestRun{
+		mkrun("T1005", 1, types.StatusValidateSuccess),
+		mkrun("T1053.003", 1, types.StatusValidatePartial),
+	}
+	s := SPrintTacticSummary(runs)
+	assert.Contains(t, s, "TA0009 collection           Tests:1 Validated:1")
+	assert.Contains(t, s, "TA0003 persistence          Tests:1 Validated:0 Partial:1")
+	assert.Contains(t, s, "TA0002 execution            Tests:1 Validated:0 Partial:1")
+	assert.NotContains(t, s, "impact")
+}
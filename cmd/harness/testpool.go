@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sync"
+	"time"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+)
+
+// guards SingleTestRun state,status fields and the list of test runs
+// while runners are executing in parallel
+var gStateMutex sync.Mutex
+
+/*
+ * TestRunPool launches goartrun for up to numJobs tests at a time.
+ * Each test has its own goartrun process, working dir and results dir.
+ * Tests with criteria 'CFG,exclusive' are run only after all in-flight
+ * tests have finished, and nothing else is started until they finish.
+ */
+type TestRunPool struct {
+	numJobs     int
+	slots       chan struct{}
+	wg          sync.WaitGroup
+	telemetryWg sync.WaitGroup // per-test telemetry polling, see fetchpertest
+	testRuns    *[]*SingleTestRun
+}
+
+// goartrun processes currently running, see SignalRunners()
+var gRunners = map[*exec.Cmd]bool{}
+var gRemoteCancels = map[*exec.Cmd]func(){} // with --remote, signals runner on remote host
+var gRemoteKills = map[*exec.Cmd]func(){}   // with --remote, kills runner and its scripts on remote host
+var gRunnersMutex sync.Mutex
+
+// time a killed runner has to kill its scripts, before it is killed
+const kKillRunnerGrace = 2 * time.Second
+
+// serializes telemetry tool fetches and validation, which uses gValidateState
+var gValidateMutex sync.Mutex
+
+func NewTestRunPool(numJobs int, testRuns *[]*SingleTestRun) *TestRunPool {
+	if numJobs < 1 {
+		numJobs = 1
+	}
+	pool := &TestRunPool{}
+	pool.numJobs = numJobs
+	pool.slots = make(chan struct{}, numJobs)
+	pool.testRuns = testRuns
+	return pool
+}
+
+// Add appends testRun to list and saves state
+func (p *TestRunPool) Add(testRun *SingleTestRun) {
+	gStateMutex.Lock()
+	defer gStateMutex.Unlock()
+
+	*p.testRuns = append(*p.testRuns, testRun)
+	SaveState(*p.testRuns)
+}
+
+func (p *TestRunPool) SetState(testRun *SingleTestRun, state types.TestState) {
+	gStateMutex.Lock()
+	defer gStateMutex.Unlock()
+
+	testRun.state = state
+	SaveState(*p.testRuns)
+}
+
+// SetTestRunStatus sets status of a running test, which SaveState may be reading
+func SetTestRunStatus(testRun *SingleTestRun, status types.TestStatus) {
+	gStateMutex.Lock()
+	defer gStateMutex.Unlock()
+
+	testRun.status = status
+}
+
+/*
+ * Run will block until a slot is available, then run the test.
+ * When numJobs is 1, the test is run on the caller's goroutine.
+ * runConfig is runSpec as written by WriteRunSpec().
+ */
+func (p *TestRunPool) Run(testRun *SingleTestRun, runSpec *types.RunSpec, runConfig string) {
+	if p.numJobs == 1 {
+		p.runOne(testRun, runSpec, runConfig)
+		return
+	}
+
+	if testRun.criteria.Exclusive {
+		p.wg.Wait()
+		fmt.Println("Exclusive test, running alone:", testRun.criteria.Id())
+		p.runOne(testRun, runSpec, runConfig)
+		return
+	}
+
+	p.slots <- struct{}{}
+	p.wg.Add(1)
+	go func() {
+		defer func() {
+			<-p.slots
+			p.wg.Done()
+		}()
+		p.runOne(testRun, runSpec, runConfig)
+	}()
+}
+
+// Wait blocks until all launched tests have finished, and telemetry
+// polling is done for them
+func (p *TestRunPool) Wait() {
+	p.wg.Wait()
+	p.telemetryWg.Wait()
+}
+
+func (p *TestRunPool) runOne(testRun *SingleTestRun, runSpec *types.RunSpec, runConfig string) {
+	if false == gKeepRunning.Load() {
+		// cancelled while waiting for a slot, nothing to clean up
+		gStateMutex.Lock()
+		testRun.status = types.StatusCancelled
+		testRun.isCleanedUp = true
+		gStateMutex.Unlock()
+		p.SetState(testRun, types.StateDone)
+		FinishTestRun(testRun)
+		return
+	}
+
+	p.SetState(testRun, types.StateRunnerLaunched)
+
+	runnerStart := time.Now()
+	if len(flagRemote) > 0 {
+		GoArtRunTestRemote(testRun, runSpec)
+	} else if runtime.GOOS == "windows" {
+		GoArtRunTestWin(testRun, runConfig)
+	} else {
+		GoArtRunTest(testRun, runConfig)
+	}
+	runnerSeconds := time.Since(runnerStart).Seconds()
+	gStateMutex.Lock()
+	testRun.runnerSeconds = runnerSeconds // read by WriteMetrics in SaveState
+	gStateMutex.Unlock()
+
+	UpdateTimestampsFromRunSummary(testRun)
+
+	if testRun.status == types.StatusCancelled || testRun.status == types.StatusUnsafe {
+		p.SetState(testRun, types.StateDone)
+	} else {
+		p.SetState(testRun, types.StateRunnerFinished)
+	}
+
+	FinishTestRun(testRun)
+	testRun.fetchEndTime = time.Now().Unix() + 1
+
+	if false == gKeepRunning.Load() {
+		return
+	}
+
+	// poll telemetry in the background, so the next test can start
+
+	if flagFetchPerTest && testRun.status == types.StatusTestSuccess {
+		p.telemetryWg.Add(1)
+		go func() {
+			defer p.telemetryWg.Done()
+			p.PollTelemetry(testRun)
+		}()
+	}
+
+	// sleep a few seconds in-between tests
+	// want to avoid confusing telemetry of one test with the other
+	// TODO: careful with netflows, they are batched. telemetry tool filter by process?
+
+	time.Sleep(time.Duration(GetPauseSeconds(testRun.criteria)) * time.Second)
+}
+
+// seconds to sleep after test, from criteria CFG,pause,N or --pause
+func GetPauseSeconds(criteria *types.AtomicTestCriteria) int {
+	if criteria.PauseSeconds != nil {
+		return *criteria.PauseSeconds
+	}
+	return flagPauseSeconds
+}
+
+/*
+ * PollTelemetry fetches telemetry for the time range of a single test
+ * into its results dir, and validates it.  The fetch is repeated every
+ * telemetrypoll seconds until all expected events are found, or
+ * telemetrywait seconds have passed since the test finished.
+ */
+func (p *TestRunPool) PollTelemetry(testRun *SingleTestRun) {
+	p.SetState(testRun, types.StateWaitForTelemetry)
+
+	deadline := time.Unix(testRun.fetchEndTime, 0).Add(time.Duration(flagTelemetryWaitSeconds) * time.Second)
+	testRun.telemetryDir = testRun.resultsDir
+	numFetches := 0
+
+	for {
+		gValidateMutex.Lock()
+		FetchTelemetry(testRun.resultsDir, testRun.fetchStartTime, testRun.fetchEndTime)
+		numFetches += 1
+
+		gStateMutex.Lock()
+		ResetValidation(testRun)
+		for _, tool := range gTelemTools {
+			ValidateSimpleTelemetry(testRun, tool)
+		}
+		status := testRun.status
+		gStateMutex.Unlock()
+		gValidateMutex.Unlock()
+
+		if status == types.StatusValidateSuccess || false == gKeepRunning.Load() || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Duration(flagTelemetryPollSeconds) * time.Second)
+	}
+
+	if gVerbose {
+		fmt.Println(testRun.criteria.Id(), "telemetry fetched", numFetches, "times, status:", testRun.status)
+	}
+
+	gStateMutex.Lock()
+	WriteTestRunStatusFile(testRun)
+	gStateMutex.Unlock()
+
+	p.SetState(testRun, types.StateDone)
+}
+
+func IsParallelRun() bool {
+	return flagNumJobs > 1
+}
+
+// fix permissions and remove working dir after a run
+func FinishTestRun(testRun *SingleTestRun) {
+	if runtime.GOOS != "windows" {
+		os.Chmod(testRun.resultsDir, 0755)
+	}
+
+	// runner will try to clean up, but may not be able to with lowered privs
+	err := os.RemoveAll(testRun.workingDir)
+	if err != nil {
+		fmt.Println("Failed to delete working dir", testRun.workingDir, err)
+	}
+}
+
+/*
+ * RunRunner starts goartrun in its own process group, and waits for it
+ * to exit.  While running, it can be stopped by SignalRunners().
+ * @return combined stdout and stderr
+ */
+func RunRunner(cmd *exec.Cmd) ([]byte, error) {
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	SetRunnerProcAttrs(cmd)
+
+	gRunnersMutex.Lock()
+	err := cmd.Start()
+	if err == nil {
+		gRunners[cmd] = true
+	}
+	gRunnersMutex.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	err = cmd.Wait()
+
+	gRunnersMutex.Lock()
+	delete(gRunners, cmd)
+	gRunnersMutex.Unlock()
+
+	return output.Bytes(), err
+}
+
+// true until RunRunner's Wait for cmd returned
+func IsRunnerRunning(cmd *exec.Cmd) bool {
+	gRunnersMutex.Lock()
+	defer gRunnersMutex.Unlock()
+	return gRunners[cmd]
+}
+
+// SignalRunners asks running goartrun processes to cancel,
+// or if force is true, kills them.  Remote runners are killed
+// on the remote host before their ssh client is.
+func SignalRunners(force bool) {
+	gRunnersMutex.Lock()
+	defer gRunnersMutex.Unlock()
+
+	for cmd := range gRunners {
+		var err error
+		if kill, ok := gRemoteKills[cmd]; ok && force {
+			go func(cmd *exec.Cmd) {
+				kill()
+				if IsRunnerRunning(cmd) {
+					KillRunner(cmd)
+				}
+			}(cmd)
+		} else if force {
+			err = KillRunner(cmd)
+		} else if cancel, ok := gRemoteCancels[cmd]; ok {
+			go cancel()
+		} else {
+			err = TerminateRunner(cmd)
+		}
+		if err != nil {
+			fmt.Println("ERROR: signaling runner", cmd.Process.Pid, err)
+		}
+	}
+}
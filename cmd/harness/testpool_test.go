@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+)
+
+// writes run_summary.json to ResultsDir of RunSpec on stdin, exits with StatusTestSuccess
+const kFakePoolRunner = `#!/bin/sh
+dir=$(sed -n 's/.*"ResultsDir": *"\([^"]*\)".*/\1/p')
+echo '{"StartTime":1,"EndTime":2,"IsCleanedUp":true}' > "$dir/run_summary.json"
+sleep 0.1
+exit 9
+`
+
+// run with -race, state is read while tests run in parallel
+func TestTestRunPoolParallel(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("fake runner is sh script")
+	}
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "goartrun"), []byte(kFakePoolRunner), 0755)
+
+	prevRunner, prevResults, prevJobs, prevPause := flagGoArtRunnerPath, flagResultsPath, flagNumJobs, flagPauseSeconds
+	defer func() {
+		flagGoArtRunnerPath, flagResultsPath, flagNumJobs, flagPauseSeconds = prevRunner, prevResults, prevJobs, prevPause
+	}()
+	flagGoArtRunnerPath = filepath.Join(dir, "goartrun")
+	flagResultsPath = dir
+	flagNumJobs = 3
+	flagPauseSeconds = 0
+
+	testRuns := []*SingleTestRun{}
+	pool := NewTestRunPool(flagNumJobs, &testRuns)
+
+	done := make(chan bool)
+	stopped := make(chan bool)
+	go func() {
+		for {
+			select {
+			case <-done:
+				close(stopped)
+				return
+			default:
+			}
+			gStateMutex.Lock()
+			SaveState(testRuns)
+			gStateMutex.Unlock()
+		}
+	}()
+
+	for i := 1; i <= 6; i++ {
+		testRun := newTestRun("T1070.004", uint(i), "", types.StatusUnknown)
+		testRun.resultsDir = filepath.Join(dir, fmt.Sprintf("T1070.004_%d", i))
+		testRun.workingDir = filepath.Join(dir, fmt.Sprintf("artwork-T1070.004_%d", i))
+		os.Mkdir(testRun.workingDir, 0755)
+		runSpec := &types.RunSpec{Technique: "T1070.004", TestIndex: i, TempDir: testRun.workingDir, ResultsDir: testRun.resultsDir}
+		pool.Add(testRun)
+		pool.Run(testRun, runSpec, WriteRunSpec(runSpec, testRun.resultsDir))
+	}
+	pool.Wait()
+	close(done)
+	<-stopped
+
+	assert.Equal(t, 6, len(testRuns))
+	for _, testRun := range testRuns {
+		assert.Equal(t, types.StatusTestSuccess, testRun.status)
+		assert.Equal(t, types.StateRunnerFinished, testRun.state)
+		assert.True(t, testRun.isCleanedUp)
+		assert.Greater(t, testRun.runnerSeconds, 0.0)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
 	"regexp"
 	"runtime"
 	"strings"
@@ -20,9 +21,13 @@ type ExtractState struct {
 	TotalEvents uint64                  `json:"total_events"`
 	NumMatches  uint64                  `json:"num_matches"`
 	Coverage    float64                 `json:"coverage"`
-	MatchingTag string                  `json:"matching_tag",omitempty`
+	MatchingTag string                  `json:"matching_tag,omitempty"`
+	Namespaces  map[string]string       `json:"namespaces,omitempty"` // with --isolate
 }
 
+const kMaxNearMisses = 3
+const kMaxRawMatches = 10
+
 var (
 	gValidateState = ExtractState{}
 
@@ -57,19 +62,55 @@ func CheckMatch(haystack, op, needle string) bool {
 	return false
 }
 
-func AddMatchingEvent(testRun *SingleTestRun, exp *types.ExpectedEvent, event *types.SimpleEvent) {
+func AddMatchingEvent(testRun *SingleTestRun, exp *types.ExpectedEvent, event *types.SimpleEvent, rawEventStr string) {
 	exp.Matches = append(exp.Matches, event)
+	if len(exp.RawMatches) < kMaxRawMatches {
+		exp.RawMatches = append(exp.RawMatches, rawEventStr)
+	}
 	gValidateState.NumMatches += 1
 	UpdateCoverage()
 }
 
+/*
+ * AddNearMiss keeps event, that met numChecksMet but not all field checks
+ * of exp, if it is one of the kMaxNearMisses best.  Shown in report.html
+ * for expected events that were not found.
+ */
+func AddNearMiss(exp *types.ExpectedEvent, event *types.SimpleEvent, numChecksMet int, rawEventStr string) {
+	i := len(exp.NearMisses)
+	for i > 0 && exp.NearMisses[i-1].NumChecksMet < numChecksMet {
+		i--
+	}
+	if i >= kMaxNearMisses {
+		return
+	}
+	nearMiss := &types.NearMiss{NumChecksMet: numChecksMet, Event: event, Raw: rawEventStr}
+	exp.NearMisses = append(exp.NearMisses[:i], append([]*types.NearMiss{nearMiss}, exp.NearMisses[i:]...)...)
+	if len(exp.NearMisses) > kMaxNearMisses {
+		exp.NearMisses = exp.NearMisses[:kMaxNearMisses]
+	}
+}
+
 func CheckProcessEvent(testRun *SingleTestRun, evt *types.SimpleEvent, nativeJsonStr string) bool {
 	retval := false
 
 	// by default, filter out anything that is not in the actual ATR test
 	// by looking for goartrun 'test' shell process event
 
-	if flagFilterByGoartrunShell {
+	if IsOutsideTestNamespace(testRun, "pid", evt.ProcessFields.PidNs) {
+		if gVerbose {
+			fmt.Println("Ignoring event outside of test pid namespace", nativeJsonStr)
+		}
+		return retval
+	}
+	if flagFilterByGoartrunShell && IsParallelRun() {
+		if !IsInTestLineage(testRun, evt) {
+			if gVerbose {
+				fmt.Println("Ignoring event not descended from ATR test shell", nativeJsonStr)
+			}
+			return retval
+		}
+	} else if flagFilterByGoartrunShell {
 		if IsGoArtStage(testRun, evt.ProcessFields.Cmdline, evt.Timestamp) {
 			testRun.ShellPid = evt.ProcessFields.Pid
 			return retval
@@ -111,9 +152,10 @@ func CheckProcessEvent(testRun *SingleTestRun, evt *types.SimpleEvent, nativeJso
 			}
 		}
 		if numMatchingChecks == len(exp.FieldChecks) {
-			AddMatchingEvent(testRun, exp, evt)
+			AddMatchingEvent(testRun, exp, evt, nativeJsonStr)
 			retval = true
 		} else if numMatchingChecks > 0 {
+			AddNearMiss(exp, evt, numMatchingChecks, nativeJsonStr)
 			if gDebug {
 				fmt.Printf("ONLY %d of %d FieldChecks satisfied\n%s\n", numMatchingChecks, len(exp.FieldChecks), nativeJsonStr)
 			}
@@ -124,6 +166,9 @@ func CheckProcessEvent(testRun *SingleTestRun, evt *types.SimpleEvent, nativeJso
 
 func CheckFileEvent(testRun *SingleTestRun, evt *types.SimpleEvent, nativeJsonStr string) bool {
 	retval := false
+	if IsOtherTestsEvent(testRun, evt.FileFields.Pid) {
+		return retval
+	}
 	if flagFilterFileEventsTmp {
 		if IsGoArtWorkDirEvent(testRun, evt) {
 			return retval
@@ -199,9 +244,10 @@ func CheckFileEvent(testRun *SingleTestRun, evt *types.SimpleEvent, nativeJsonSt
 			}
 		}
 		if numMatchingChecks == len(exp.FieldChecks) {
-			AddMatchingEvent(testRun, exp, evt)
+			AddMatchingEvent(testRun, exp, evt, nativeJsonStr)
 			retval = true
 		} else if numMatchingChecks > 0 {
+			AddNearMiss(exp, evt, numMatchingChecks, nativeJsonStr)
 			if gDebug {
 				fmt.Printf("ONLY %d of %d FieldChecks satisfied.\n%s\n", numMatchingChecks, len(exp.FieldChecks), nativeJsonStr)
 			}
@@ -212,6 +258,9 @@ func CheckFileEvent(testRun *SingleTestRun, evt *types.SimpleEvent, nativeJsonSt
 
 func CheckNetflowEvent(testRun *SingleTestRun, evt *types.SimpleEvent, nativeJsonStr string) bool {
 	retval := false
+	if IsOtherTestsEvent(testRun, evt.NetflowFields.Pid) || IsOutsideTestNamespace(testRun, "net", evt.NetflowFields.NetNs) {
+		return retval
+	}
 	for _, exp := range gValidateState.TestData.ExpectedEvents {
 
 		if strings.ToUpper(exp.EventType) != "NETFLOW" {
@@ -246,14 +295,14 @@ func CheckNetflowEvent(testRun *SingleTestRun, evt *types.SimpleEvent, nativeJso
 		for _, rx := range regexes {
 			matched := rx.MatchString(evt.NetflowFields.FlowStr)
 			if matched {
-				AddMatchingEvent(testRun, exp, evt)
+				AddMatchingEvent(testRun, exp, evt, nativeJsonStr)
 				retval = true
 				break
 			}
 			if len(evt.NetflowFields.FlowStrDns) > 0 {
 				matched = rx.MatchString(evt.NetflowFields.FlowStrDns)
 				if matched {
-					AddMatchingEvent(testRun, exp, evt)
+					AddMatchingEvent(testRun, exp, evt, nativeJsonStr)
 					retval = true
 					break
 				}
@@ -291,9 +340,10 @@ func CheckETWEvent(testRun *SingleTestRun, evt *types.SimpleEvent, nativeJsonStr
 			}
 		}
 		if numMatchingChecks == len(exp.FieldChecks) {
-			AddMatchingEvent(testRun, exp, evt)
+			AddMatchingEvent(testRun, exp, evt, nativeJsonStr)
 			retval = true
 		} else if numMatchingChecks > 0 {
+			AddNearMiss(exp, evt, numMatchingChecks, nativeJsonStr)
 			if gDebug {
 				fmt.Printf("ONLY %d of %d FieldChecks satisfied\n%s\n", numMatchingChecks, len(exp.FieldChecks), nativeJsonStr)
 			}
@@ -329,9 +379,10 @@ func CheckAMSIEvent(testRun *SingleTestRun, evt *types.SimpleEvent, nativeJsonSt
 			}
 		}
 		if numMatchingChecks == len(exp.FieldChecks) {
-			AddMatchingEvent(testRun, exp, evt)
+			AddMatchingEvent(testRun, exp, evt, nativeJsonStr)
 			retval = true
 		} else if numMatchingChecks > 0 {
+			AddNearMiss(exp, evt, numMatchingChecks, nativeJsonStr)
 			if gDebug {
 				fmt.Printf("ONLY %d of %d FieldChecks satisfied\n%s\n", numMatchingChecks, len(exp.FieldChecks), nativeJsonStr)
 			}
@@ -373,9 +424,10 @@ func CheckRegEvent(testRun *SingleTestRun, evt *types.SimpleEvent, nativeJsonStr
 			}
 		}
 		if numMatchingChecks == len(exp.FieldChecks) {
-			AddMatchingEvent(testRun, exp, evt)
+			AddMatchingEvent(testRun, exp, evt, nativeJsonStr)
 			retval = true
 		} else if numMatchingChecks > 0 {
+			AddNearMiss(exp, evt, numMatchingChecks, nativeJsonStr)
 			if gDebug {
 				fmt.Printf("ONLY %d of %d FieldChecks satisfied\n%s\n", numMatchingChecks, len(exp.FieldChecks), nativeJsonStr)
 			}
@@ -417,9 +469,10 @@ func CheckApiCallEvent(testRun *SingleTestRun, evt *types.SimpleEvent, nativeJso
 			}
 		}
 		if numMatchingChecks == len(exp.FieldChecks) {
-			AddMatchingEvent(testRun, exp, evt)
+			AddMatchingEvent(testRun, exp, evt, nativeJsonStr)
 			retval = true
 		} else if numMatchingChecks > 0 {
+			AddNearMiss(exp, evt, numMatchingChecks, nativeJsonStr)
 			if gDebug {
 				fmt.Printf("ONLY %d of %d FieldChecks satisfied\n%s\n", numMatchingChecks, len(exp.FieldChecks), nativeJsonStr)
 			}
@@ -434,6 +487,7 @@ func ValidateSimpleTelemetry(testRun *SingleTestRun, tool *TelemTool) {
 	gValidateState = ExtractState{}
 	gValidateState.StartTime = uint64(testRun.StartTime)
 	gValidateState.EndTime = uint64(testRun.EndTime)
+	gValidateState.Namespaces = testRun.namespaces
 	gValidateState.TestData.Technique = testRun.criteria.Technique
 	gValidateState.TestData.TestIndex = testRun.criteria.TestIndex
 	gValidateState.TestData.TestName = testRun.criteria.TestName
@@ -441,14 +495,15 @@ func ValidateSimpleTelemetry(testRun *SingleTestRun, tool *TelemTool) {
 
 	// load simple_telemetry.json, process each event
 
-	path := testRun.resultsDir + "/../simple_telemetry" + tool.Suffix + ".json"
+	telemetryDir := GetTelemetryDir(testRun, tool)
+	path := telemetryDir + "/simple_telemetry" + tool.Suffix + ".json"
 	simpleLines, err := ReadFileLines(path)
 	if err != nil {
 		fmt.Println("ERROR: file not found", path, err)
 		return
 	}
 
-	path = testRun.resultsDir + "/../telemetry" + tool.Suffix + ".json"
+	path = telemetryDir + "/telemetry" + tool.Suffix + ".json"
 	rawJsonLines, err := ReadFileLines(path)
 	if err != nil {
 		fmt.Println("ERROR: file not found", path, err)
@@ -461,7 +516,7 @@ func ValidateSimpleTelemetry(testRun *SingleTestRun, tool *TelemTool) {
 
 	// write native telemetry matches to a file
 	outpath := testRun.resultsDir + "/matches" + tool.Suffix + ".json"
-	matchFileHandle, err := os.OpenFile(outpath, os.O_CREATE|os.O_WRONLY, 0644)
+	matchFileHandle, err := os.OpenFile(outpath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
 	if err != nil {
 		fmt.Println("ERROR: unable to create outfile", outpath, err)
 	}
@@ -522,6 +577,11 @@ func ValidateSimpleTelemetry(testRun *SingleTestRun, tool *TelemTool) {
 
 	// save results to file
 
+	if testRun.eventCounts == nil {
+		testRun.eventCounts = map[string]*EventCounts{}
+	}
+	testRun.eventCounts[tool.Suffix] = GetEventCounts(&gValidateState.TestData)
+
 	s := GetTelemTypes(&gValidateState.TestData)
 	outPath := testRun.resultsDir + "/match_string" + tool.Suffix + ".txt"
 	err = os.WriteFile(outPath, []byte(s), 0644)
@@ -553,6 +613,45 @@ func ValidateSimpleTelemetry(testRun *SingleTestRun, tool *TelemTool) {
 	}
 }
 
+/*
+ * GetTelemetryDir returns the folder containing telemetry files for
+ * the test.  Telemetry is fetched for the entire run into the parent
+ * results dir, unless it was fetched per-test.
+ */
+func GetTelemetryDir(testRun *SingleTestRun, tool *TelemTool) string {
+	if len(testRun.telemetryDir) > 0 {
+		return testRun.telemetryDir
+	}
+	_, err := os.Stat(testRun.resultsDir + "/simple_telemetry" + tool.Suffix + ".json")
+	if err == nil {
+		return testRun.resultsDir
+	}
+	return testRun.resultsDir + "/.."
+}
+
+/*
+ * ResetValidation clears matches and the side-effects of a previous
+ * validation of testRun, so it can be validated again.
+ */
+func ResetValidation(testRun *SingleTestRun) {
+	for _, exp := range testRun.criteria.ExpectedEvents {
+		exp.Matches = nil
+		exp.RawMatches = nil
+		exp.NearMisses = nil
+	}
+	for i := range testRun.criteria.ExpectedCorrelations {
+		testRun.criteria.ExpectedCorrelations[i].IsMet = false
+	}
+	testRun.TimeOfParentShell = 0
+	testRun.TimeOfNextStage = 0
+	testRun.ShellPid = 0
+	testRun.TimeWorkDirCreate = 0
+	testRun.TimeWorkDirDelete = 0
+	testRun.HasMitreTag = false
+	testRun.lineagePids = nil
+	testRun.eventCounts = nil
+}
+
 func UpdateCoverage() {
 	numFound := 0
 	numExpected := len(gValidateState.TestData.ExpectedEvents) +
@@ -591,10 +690,6 @@ func GetTelemChar(exp *types.ExpectedEvent) string {
 		return "F"
 	case "FILEMOD":
 		return "F"
-		if strings.ToUpper(exp.SubType) == "READ" {
-			return "f"
-		}
-		return "F"
 	case "AUTH":
 		return "A"
 	case "PTRACE":
@@ -636,22 +731,11 @@ func GetTelemChar(exp *types.ExpectedEvent) string {
  * Side-effects: will set testRun.TimeOfParentShell,ShellPid, TimeOfNextStage
  */
 func IsGoArtStage(testRun *SingleTestRun, cmdline string, tsNs int64) bool {
-	a := []string{}
-	i := 1
-	if utils.GetPlatformName() == "windows" {
-		i += 1 // in 2,3,4 indexes on windows
-		a = gRxGoArtStageWin.FindStringSubmatch(cmdline)
-	} else {
-		a = gRxGoArtStage.FindStringSubmatch(cmdline)
-	}
-	if len(a) < i+3 {
+	folder, technique, stageName, ok := ParseGoArtStageCmdline(cmdline)
+	if !ok {
 		return false
 	}
 
-	folder := a[i]
-	technique := a[i+1]
-	stageName := a[i+2]
-
 	if gVerbose {
 		fmt.Println("Found stage", stageName, "for", technique, "folder:", folder)
 	}
@@ -673,6 +757,82 @@ func IsGoArtStage(testRun *SingleTestRun, cmdline string, tsNs int64) bool {
 	return true
 }
 
+/**
+ * ParseGoArtStageCmdline returns the working folder name, technique
+ * and stage name of a goartrun stage script shell commandline.
+ */
+func ParseGoArtStageCmdline(cmdline string) (string, string, string, bool) {
+	a := []string{}
+	i := 1
+	if utils.GetPlatformName() == "windows" {
+		i += 1 // in 2,3,4 indexes on windows
+		a = gRxGoArtStageWin.FindStringSubmatch(cmdline)
+	} else {
+		a = gRxGoArtStage.FindStringSubmatch(cmdline)
+	}
+	if len(a) < i+3 {
+		return "", "", "", false
+	}
+	return a[i], a[i+1], a[i+2], true
+}
+
+/**
+ * IsInTestLineage is used instead of the time-window of IsGoArtStage
+ * when tests run in parallel, since the events of other tests are
+ * interleaved.  The goartrun 'test' stage shell running in this test's
+ * working dir is the root of the lineage, and any process whose parent
+ * is in the lineage is added to it.  The shell itself is not part of
+ * the test.
+ *
+ * Side-effects: will set testRun.ShellPid, TimeOfParentShell, lineagePids
+ */
+func IsInTestLineage(testRun *SingleTestRun, evt *types.SimpleEvent) bool {
+	pf := evt.ProcessFields
+
+	folder, _, stageName, ok := ParseGoArtStageCmdline(pf.Cmdline)
+	if ok {
+		if "test" == stageName && len(testRun.workingDir) > 0 && folder == filepath.Base(testRun.workingDir) {
+			testRun.ShellPid = pf.Pid
+			testRun.TimeOfParentShell = evt.Timestamp
+			testRun.lineagePids = map[int64]bool{pf.Pid: true}
+		}
+		return false
+	}
+	if testRun.lineagePids == nil {
+		return false
+	}
+	if testRun.lineagePids[pf.ParentPid] {
+		testRun.lineagePids[pf.Pid] = true
+		return true
+	}
+	return testRun.lineagePids[pf.Pid]
+}
+
+/**
+ * IsOtherTestsEvent returns true when tests run in parallel and the
+ * pid of a non-process event is known, but not in the lineage of
+ * this test.
+ */
+func IsOtherTestsEvent(testRun *SingleTestRun, pid int64) bool {
+	if !flagFilterByGoartrunShell || !IsParallelRun() || 0 == pid {
+		return false
+	}
+	return !testRun.lineagePids[pid]
+}
+
+/**
+ * IsOutsideTestNamespace returns true when the test ran with --isolate
+ * and the event has the id of another namespace of that type, e.g. a
+ * process of the host or of another test running at the same time.
+ * Events without namespace ids are not filtered.
+ */
+func IsOutsideTestNamespace(testRun *SingleTestRun, name string, id string) bool {
+	if !flagFilterByGoartrunShell || 0 == len(id) || 0 == len(testRun.namespaces[name]) {
+		return false
+	}
+	return id != testRun.namespaces[name]
+}
+
 /**
  * IsGoArtWorkDirEvent will check the file event target path,
  * if it matches create or delete, then it's the start/end of test
@@ -1,9 +1,13 @@
 package main
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
 )
 
 func TestFindGoArtStageRegex(t *testing.T) {
@@ -47,3 +51,95 @@ func TestFindGoArtStageRegex(t *testing.T) {
 	assert.Equal(t, "T1027.002", technique)
 	assert.Equal(t, "test", stageName)
 }
+
+func TestInTestLineage(t *testing.T) {
+	testRun := &SingleTestRun{}
+	testRun.workingDir = "/tmp/artwork-T1560.002_3-458617291"
+
+	mkevt := func(pid, ppid int64, cmdline string) *types.SimpleEvent {
+		evt := &types.SimpleEvent{EventType: types.SimpleSchemaProcess}
+		evt.ProcessFields = &types.SimpleProcessFields{Pid: pid, ParentPid: ppid, Cmdline: cmdline}
+		return evt
+	}
+
+	// shell of another test running in parallel
+	assert.False(t, IsInTestLineage(testRun, mkevt(90, 1, "sh /tmp/artwork-T1053.003_1-1234/goart-T1053.003-test.bash")))
+	assert.False(t, IsInTestLineage(testRun, mkevt(91, 90, "crontab -l")))
+
+	// our test shell is root of lineage, but not part of test
+	assert.False(t, IsInTestLineage(testRun, mkevt(100, 1, "sh /tmp/artwork-T1560.002_3-458617291/goart-T1560.002-test.bash")))
+	assert.Equal(t, int64(100), testRun.ShellPid)
+
+	assert.True(t, IsInTestLineage(testRun, mkevt(101, 100, "zip -r /tmp/a.zip /tmp/b")))
+	assert.True(t, IsInTestLineage(testRun, mkevt(102, 101, "zip helper")))
+	assert.False(t, IsInTestLineage(testRun, mkevt(103, 91, "sleep 1")))
+}
+
+func TestOutsideTestNamespace(t *testing.T) {
+	testRun := &SingleTestRun{}
+	assert.False(t, IsOutsideTestNamespace(testRun, "pid", "4026532207"))
+
+	testRun.namespaces = map[string]string{"pid": "4026532207", "net": "4026532208"}
+	assert.False(t, IsOutsideTestNamespace(testRun, "pid", "4026532207"))
+	assert.True(t, IsOutsideTestNamespace(testRun, "pid", "4026531836"))
+	assert.True(t, IsOutsideTestNamespace(testRun, "net", "4026531840"))
+	assert.False(t, IsOutsideTestNamespace(testRun, "net", ""))
+
+	// host process in test time window is not matched
+	prevState := gValidateState
+	defer func() { gValidateState = prevState }()
+	gValidateState = ExtractState{}
+	testRun.criteria = &types.AtomicTestCriteria{}
+	testRun.criteria.ExpectedEvents = []*types.ExpectedEvent{{EventType: "Process", FieldChecks: []types.FieldCriteria{{FieldName: "cmdline", Op: "~=", Value: "crontab"}}}}
+	testRun.TimeOfParentShell = 1
+	evt := &types.SimpleEvent{EventType: types.SimpleSchemaProcess, Timestamp: 2}
+	evt.ProcessFields = &types.SimpleProcessFields{Pid: 200, ParentPid: 1, Cmdline: "crontab -l", PidNs: "4026531836"}
+	assert.False(t, CheckProcessEvent(testRun, evt, "{}"))
+	evt.ProcessFields.PidNs = "4026532207"
+	assert.True(t, CheckProcessEvent(testRun, evt, "{}"))
+}
+
+func TestGetTelemetryDir(t *testing.T) {
+	runDir := t.TempDir()
+	testRun := &SingleTestRun{}
+	testRun.resultsDir = filepath.Join(runDir, "T1560.002_3_1234")
+	os.Mkdir(testRun.resultsDir, 0755)
+	tool := &TelemTool{Name: "telemtool_e2e", Suffix: "_e2e"}
+
+	// fetched for whole run
+	assert.Equal(t, testRun.resultsDir+"/..", GetTelemetryDir(testRun, tool))
+
+	// fetched for this test
+	os.WriteFile(filepath.Join(testRun.resultsDir, "simple_telemetry_e2e.json"), []byte{}, 0644)
+	assert.Equal(t, testRun.resultsDir, GetTelemetryDir(testRun, tool))
+
+	testRun.telemetryDir = runDir
+	assert.Equal(t, runDir, GetTelemetryDir(testRun, tool))
+}
+
+func TestAddNearMiss(t *testing.T) {
+	exp := &types.ExpectedEvent{EventType: "Process"}
+	for i, numChecksMet := range []int{1, 2, 1, 3, 2} {
+		AddNearMiss(exp, &types.SimpleEvent{}, numChecksMet, string(rune('a'+i)))
+	}
+
+	// best first, earlier events first if same number of checks met
+	assert.Equal(t, kMaxNearMisses, len(exp.NearMisses))
+	assert.Equal(t, "d", exp.NearMisses[0].Raw)
+	assert.Equal(t, "b", exp.NearMisses[1].Raw)
+	assert.Equal(t, "e", exp.NearMisses[2].Raw)
+}
+
+func TestAddMatchingEvent(t *testing.T) {
+	prevState := gValidateState
+	defer func() { gValidateState = prevState }()
+	gValidateState = ExtractState{}
+
+	exp := &types.ExpectedEvent{EventType: "Process"}
+	for i := 0; i < kMaxRawMatches+5; i++ {
+		AddMatchingEvent(&SingleTestRun{}, exp, &types.SimpleEvent{}, "{}")
+	}
+	assert.Equal(t, kMaxRawMatches+5, len(exp.Matches))
+	assert.Equal(t, kMaxRawMatches, len(exp.RawMatches))
+	assert.Equal(t, uint64(kMaxRawMatches+5), gValidateState.NumMatches)
+}
@@ -33,9 +33,17 @@ type AtomicTest struct {
 
 	Status      int               `yaml:"test_status,omitempty"`
 	IsCleanedUp bool              `yaml:"is_cleaned_up,omitempty"`
+	IsCancelled bool              `yaml:"is_cancelled,omitempty"`
+	UnsafeRule  string            `yaml:"unsafe_rule,omitempty"`
+	IsDirty     bool              `yaml:"is_dirty,omitempty"` // residue found after cleanup
+	Residue     []ResidueItem     `yaml:"residue,omitempty"`
 	ArgsUsed    map[string]string `yaml:"args_used,omitempty"`
 	StartTime   int64
 	EndTime     int64
+
+	PrereqResults      []PrereqResult      `yaml:"prereq_results,omitempty"` // checkprereq stage
+	PrereqCacheLookups []PrereqCacheLookup `yaml:"prereq_cache_lookups,omitempty"`
+	Namespaces         map[string]string   `yaml:"namespaces,omitempty"` // with isolation, e.g. net -> 4026532208
 }
 
 type InputArgument struct {
@@ -51,6 +59,13 @@ type Dependency struct {
 	GetPrereqCommand string `yaml:"get_prereq_command,omitempty"`
 }
 
+// PrereqResult - result of dependency prereq_command, without get_prereq_command
+type PrereqResult struct {
+	Description string `json:"description" yaml:"description"`
+	IsMet       bool   `json:"is_met" yaml:"is_met"`
+	Output      string `json:"output,omitempty" yaml:"output,omitempty"`
+}
+
 type AtomicExecutor struct {
 	Name              string `yaml:"name"`
 	ElevationRequired bool   `yaml:"elevation_required"`
@@ -0,0 +1,34 @@
+package types
+
+type TestChange string
+
+const (
+	TestRegressed TestChange = "regressed" // lower status, or expected events lost
+	TestImproved  TestChange = "improved"
+	TestChanged   TestChange = "changed" // status changed, but not comparable, e.g. to Skipped
+	TestUnchanged TestChange = "unchanged"
+	TestAdded     TestChange = "added" // only in new run
+	TestRemoved   TestChange = "removed"
+)
+
+// TestComparison - test of both runs, aligned by technique, guid and iteration
+type TestComparison struct {
+	Technique    string     `json:"technique"`
+	TestIndex    string     `json:"test_index"`
+	TestGuid     string     `json:"test_guid"`
+	TestName     string     `json:"test_name"`
+	Iteration    int        `json:"iteration,omitempty"`
+	OldStatus    string     `json:"old_status,omitempty"`
+	NewStatus    string     `json:"new_status,omitempty"`
+	Change       TestChange `json:"change"`
+	LostEvents   []string   `json:"lost_events,omitempty"` // matched in old run, not in new, e.g. "_e2e: File DELETE path=/tmp/x"
+	GainedEvents []string   `json:"gained_events,omitempty"`
+}
+
+// RunComparison - output of atomic-harness compare
+type RunComparison struct {
+	OldDir string             `json:"old_dir"`
+	NewDir string             `json:"new_dir"`
+	Counts map[TestChange]int `json:"counts"`
+	Tests  []*TestComparison  `json:"tests"`
+}
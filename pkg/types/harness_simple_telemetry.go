@@ -35,9 +35,10 @@ type SimpleProcessFields struct {
 	Env        string `json:"env,omitempty"`
 	IsElevated bool   `json:"is_elevated,omitempty"`
 
-	UniquePid       string `json:"unique_pid",omitempty`
+	UniquePid       string `json:"unique_pid,omitempty"`
 	ParentUniquePid string `json:"parent_unique_pid,omitempty"`
 	ChainId         string `json:"chainid,omitempty"` // processes piped together have same chainid
+	PidNs           string `json:"pid_ns,omitempty"`  // pid namespace id, e.g. 4026532207
 }
 
 type SimpleProcessExitFields struct {
@@ -76,6 +77,7 @@ type SimpleNetflowFields struct {
 	FlowStr    string `json:"flow_str,omitempty"` // proto:ip:port->ip:port
 	FlowStrDns string `json:"flow_dns,omitempty"` // proto:ip:port->host:port
 	Flags      string `json:"flags,omitempty"`    // "SE" - IsStart, IsEnd
+	NetNs      string `json:"net_ns,omitempty"`   // net namespace id, e.g. 4026532208
 
 	Pid       int64  `json:"pid,omitempty"`
 	UniquePid string `json:"unique_pid,omitempty"`
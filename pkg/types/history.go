@@ -0,0 +1,57 @@
+package types
+
+// HistoryRun - a run in runs.jsonl of history dir
+type HistoryRun struct {
+	ResultsDir     string         `json:"results_dir"` // absolute path, identifies run
+	IngestTime     int64          `json:"ingest_time"` // unix nanoseconds, latest ingest of a run wins
+	StartTime      int64          `json:"start_time"`  // unix seconds
+	EndTime        int64          `json:"end_time,omitempty"`
+	Host           string         `json:"host"`               // hostname, or --remote host
+	Platform       string         `json:"platform,omitempty"` // linux, darwin, windows
+	Agent          string         `json:"agent,omitempty"`    // --agentinfo, e.g. "edr 7.2.1"
+	TelemetryTools []string       `json:"telemetry_tools,omitempty"`
+	Cancelled      bool           `json:"cancelled,omitempty"` // partial run, not counted in failing tests
+	Counts         map[string]int `json:"counts"`              // status name -> num tests
+}
+
+// HistoryTest - result of a test in a run, in tests.jsonl of history dir
+type HistoryTest struct {
+	ResultsDir       string            `json:"results_dir"` // HistoryRun of test
+	IngestTime       int64             `json:"ingest_time"`
+	Time             int64             `json:"time"` // start of run, unix seconds
+	Technique        string            `json:"technique"`
+	TestIndex        string            `json:"test_index"`
+	TestGuid         string            `json:"test_guid"`
+	TestName         string            `json:"test_name"`
+	Iteration        int               `json:"iteration,omitempty"`
+	Status           string            `json:"status"`
+	MatchString      string            `json:"match_string,omitempty"`
+	ToolMatchStrings map[string]string `json:"tool_match_strings,omitempty"` // telemetry tool suffix -> match string
+	MissingEvents    []string          `json:"missing_events,omitempty"`     // expected events not found
+}
+
+// TechniqueTrend - status counts of a technique's tests in each run
+type TechniqueTrend struct {
+	Technique string        `json:"technique"`
+	Runs      []*TrendPoint `json:"runs"`
+}
+
+type TrendPoint struct {
+	ResultsDir string         `json:"results_dir"`
+	Time       int64          `json:"time"`
+	Host       string         `json:"host"`
+	Cancelled  bool           `json:"cancelled,omitempty"`
+	Counts     map[string]int `json:"counts"` // status name -> num tests
+}
+
+// FailingTest - test whose latest result is not Validated
+type FailingTest struct {
+	Technique     string `json:"technique"`
+	TestIndex     string `json:"test_index"`
+	TestGuid      string `json:"test_guid"`
+	TestName      string `json:"test_name"`
+	Status        string `json:"status"`                   // latest
+	FailingSince  int64  `json:"failing_since"`            // first run failing since last Validated, unix seconds
+	NumFailing    int    `json:"num_failing"`              // results since last Validated
+	LastValidated int64  `json:"last_validated,omitempty"` // 0 if never
+}
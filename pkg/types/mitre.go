@@ -0,0 +1,28 @@
+package types
+
+// MitreTactic - from tactic rows of data/linux_techniques.csv
+// ,TA0009,collection,Collection,collect,===================
+// or x-mitre-tactic objects of STIX bundle
+type MitreTactic struct {
+	Id         string   // TA0009
+	ShortName  string   // collection
+	Name       string   // Collection
+	Techniques []string // technique ids listed under the tactic
+}
+
+// MitreTechnique - attack-pattern object of STIX bundle
+type MitreTechnique struct {
+	Id           string   // T1053.003
+	Name         string   // Cron
+	Tactics      []string // tactic shortnames
+	Platforms    []string // Linux, macOS, Windows, ...
+	IsRevoked    bool
+	IsDeprecated bool
+	RevokedBy    string // technique id of replacement, if revoked
+}
+
+// MitreAttackData - techniques and tactics loaded from enterprise-attack.json
+type MitreAttackData struct {
+	Techniques map[string]*MitreTechnique // technique id -> technique
+	Tactics    []*MitreTactic             // in matrix order
+}
@@ -0,0 +1,48 @@
+package types
+
+// NavigatorLayer - ATT&CK Navigator layer file, see
+// https://github.com/mitre-attack/attack-navigator/tree/master/layers
+type NavigatorLayer struct {
+	Name        string                 `json:"name"`
+	Versions    NavigatorVersions      `json:"versions"`
+	Domain      string                 `json:"domain"`
+	Description string                 `json:"description"`
+	Filters     *NavigatorFilters      `json:"filters,omitempty"`
+	Gradient    NavigatorGradient      `json:"gradient"`
+	LegendItems []NavigatorLegendItem  `json:"legendItems,omitempty"`
+	Techniques  []*NavigatorTechnique  `json:"techniques"`
+	Metadata    []NavigatorMetadataRow `json:"metadata,omitempty"`
+}
+
+type NavigatorVersions struct {
+	Layer     string `json:"layer"`
+	Navigator string `json:"navigator,omitempty"`
+}
+
+type NavigatorFilters struct {
+	Platforms []string `json:"platforms"` // Linux, macOS, Windows
+}
+
+type NavigatorGradient struct {
+	Colors   []string `json:"colors"`
+	MinValue int      `json:"minValue"`
+	MaxValue int      `json:"maxValue"`
+}
+
+type NavigatorLegendItem struct {
+	Label string `json:"label"`
+	Color string `json:"color"`
+}
+
+type NavigatorTechnique struct {
+	TechniqueId       string `json:"techniqueID"`
+	Score             *int   `json:"score,omitempty"` // not colored if nil
+	Comment           string `json:"comment,omitempty"`
+	Enabled           bool   `json:"enabled"`
+	ShowSubtechniques bool   `json:"showSubtechniques"`
+}
+
+type NavigatorMetadataRow struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
@@ -0,0 +1,22 @@
+package types
+
+// PrereqCacheIndex - index.json of prereq cache dir, populated by atrutil --prereqcache
+type PrereqCacheIndex struct {
+	Entries map[string]*PrereqCacheEntry `json:"entries"` // by url
+}
+
+type PrereqCacheEntry struct {
+	Url       string `json:"url"`
+	File      string `json:"file"` // relative to cache dir
+	Sha256    string `json:"sha256"`
+	Size      int64  `json:"size"`
+	FetchTime int64  `json:"fetch_time"` // unix seconds
+}
+
+// PrereqCacheLookup - url in get_prereq_command of dependency, and whether it was cached
+type PrereqCacheLookup struct {
+	Dependency int    `json:"dependency" yaml:"dependency"` // index in AtomicTest.Dependencies
+	Url        string `json:"url" yaml:"url"`
+	IsHit      bool   `json:"is_hit" yaml:"is_hit"`
+	File       string `json:"file,omitempty" yaml:"file,omitempty"` // cache file served for hit
+}
@@ -0,0 +1,19 @@
+package types
+
+// HostSnapshot - host state before test and after cleanup, see utils.TakeHostSnapshot()
+// Items are keyed by category, e.g. "file", "crontab", "user", then name.
+// Values are a digest of the item, e.g. content hash and mode of files.
+type HostSnapshot struct {
+	Items map[string]map[string]string
+}
+
+// ResidueItem - difference between snapshots, left behind by test
+type ResidueItem struct {
+	Category string `json:"category" yaml:"category"` // file, crontab, systemd, launchd, user, listen
+	Name     string `json:"name" yaml:"name"`         // path, username, or "tcp 0.0.0.0:4444"
+	Change   string `json:"change" yaml:"change"`     // added, removed, modified
+}
+
+func (r ResidueItem) String() string {
+	return r.Change + " " + r.Category + " " + r.Name
+}
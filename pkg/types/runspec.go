@@ -2,6 +2,7 @@ package types
 
 import (
 	"fmt"
+	"strings"
 )
 
 // RunSpec - schema for goartrun job
@@ -20,6 +21,20 @@ type RunSpec struct {
 	//Envs       []string
 
 	Stage string
+
+	TimeoutSeconds      int // test stage, default 30 if zero
+	StageTimeoutSeconds int // other stages, default 15 if zero
+
+	Unsafe           bool   // run even if commands violate safety policy
+	SafetyPolicyPath string // optional csv of rules added to default policy
+
+	SkipResidueCheck bool     // don't compare host state before test and after cleanup
+	ResiduePaths     []string // paths from criteria to include in residue check, in addition to args
+	ResidueFilesOnly bool     // only check files of args and ResiduePaths, not crontabs, units, users, sockets. Set for parallel runs
+
+	PrereqCacheDir string // serve cached urls of get_prereq_command from here, see atrutil --prereqcache
+
+	Isolate bool // linux: run stages in new mount, pid, uts, net namespaces on an overlay root
 }
 
 type TestState int
@@ -52,6 +67,9 @@ const (
 	StatusValidatePartial                 // 12
 	StatusValidateSuccess                 // 13
 	StatusDelegateValidation              // 14
+	StatusTestTimeout                     // 15
+	StatusCancelled                       // 16
+	StatusUnsafe                          // 17
 )
 
 // keeping these names at 4-character for status text align
@@ -68,22 +86,34 @@ func (s TestState) String() string {
 func (s TestStatus) String() string {
 	strings := [...]string{"Unknown", "MiscError", "NoAtomic", "NoCriteria",
 		"Skipped", "InvalidArgs", "RunnerFail", "PreReqFail",
-		"TestFail", "TestRan", "ToolFail", "NoTelemetry", "Partial", "Validated", "Ready2Eval"}
+		"TestFail", "TestRan", "ToolFail", "NoTelemetry", "Partial", "Validated", "Ready2Eval",
+		"Timeout", "Cancelled", "Unsafe"}
 
-	if s < StatusUnknown || s > StatusDelegateValidation {
+	if s < StatusUnknown || s > StatusUnsafe {
 		return "Unknown"
 	}
 
 	return strings[s]
 }
 
+// ParseTestStatus returns status with name from String(), case insensitive
+func ParseTestStatus(name string) (TestStatus, bool) {
+	for s := StatusUnknown; s <= StatusUnsafe; s++ {
+		if strings.EqualFold(s.String(), name) {
+			return s, true
+		}
+	}
+	return StatusUnknown, false
+}
+
 // TestSpec - schema summarizing atomic-validation-criteria for test(s)
 // for example, it could be all tests for "T1027"
 type TestSpec struct {
 	Technique string
-	TestIndex string // optional?
-	TestName  string // optional?
-	TestGuid  string // optional?
+	TestIndex string   // optional?
+	TestName  string   // optional?
+	TestGuid  string   // optional?
+	Tactics   []string // tactic shortnames from atomics index, e.g. "defense-evasion"
 
 	Criteria []*AtomicTestCriteria
 }
@@ -92,6 +122,20 @@ func (t TestSpec) Id() string {
 	return fmt.Sprintf("%s [%s] %s '%s'", t.Technique, t.TestIndex, t.TestName, t.TestGuid)
 }
 
+// RunInfo - saved as run_info.json in harness results dir
+type RunInfo struct {
+	StartTime int64    `json:"start_time"` // unix seconds
+	EndTime   int64    `json:"end_time,omitempty"`
+	TestIds   []string `json:"tests"` // AtomicTestCriteria.Id() of every test selected for run
+
+	// where and how the run was done, for run history
+	Host           string   `json:"host,omitempty"` // hostname, or --remote host
+	Platform       string   `json:"platform,omitempty"`
+	Agent          string   `json:"agent,omitempty"` // --agentinfo
+	TelemetryTools []string `json:"telemetry_tools,omitempty"`
+	Cancelled      bool     `json:"cancelled,omitempty"` // stopped with Ctrl-C before all tests ran
+}
+
 type TestProgress struct {
 	Technique string
 	TestIndex string // optional?
@@ -101,4 +145,83 @@ type TestProgress struct {
 	State    TestState
 	ExitCode int
 	Status   TestStatus
+
+	IsCleanedUp bool   `json:",omitempty"` // cleanup stage succeeded
+	Iteration   int    `json:",omitempty"` // with --repeat, 1-based
+	UnsafeRule  string `json:",omitempty"` // safety rule that refused the test
+	IsDirty     bool   `json:",omitempty"` // residue found after cleanup
+
+	Namespaces map[string]string `json:",omitempty"` // ids of isolation namespaces, for telemetry attribution
+}
+
+// RepeatSummary - per-test entry of repeat_summary.json, when run with --repeat
+type RepeatSummary struct {
+	Id         string            `json:"id"` // AtomicTestCriteria.Id()
+	TestName   string            `json:"test_name"`
+	Iterations []RepeatIteration `json:"iterations"`
+	EventRates []EventHitRate    `json:"event_hit_rates"`
+	IsFlaky    bool              `json:"is_flaky"` // status varied between iterations
+}
+
+type RepeatIteration struct {
+	Iteration   int        `json:"iteration"`
+	Status      TestStatus `json:"status"`
+	StatusName  string     `json:"status_name"`
+	MatchString string     `json:"match_string,omitempty"`
+}
+
+// EventHitRate - fraction of validated iterations in which expected event
+// or correlation was found
+type EventHitRate struct {
+	Id        string  `json:"id"`
+	EventType string  `json:"event_type"`
+	Hits      int     `json:"hits"`
+	Total     int     `json:"total"`
+	Rate      float64 `json:"rate"`
+}
+
+// BaselineEntry - minimum acceptable status of a test, in --baseline file
+type BaselineEntry struct {
+	Technique string `json:"technique"`
+	TestIndex string `json:"test_index,omitempty"` // used if no test_guid
+	TestGuid  string `json:"test_guid,omitempty"`
+	MinStatus string `json:"min_status"` // e.g. "Partial", see TestStatus.String()
+}
+
+// PlanEntry - one test in plan.json, written with --norun
+type PlanEntry struct {
+	Id                string              `json:"id"` // AtomicTestCriteria.Id()
+	Technique         string              `json:"technique"`
+	TestIndex         uint                `json:"test_index"`
+	TestName          string              `json:"test_name"`
+	TestGuid          string              `json:"test_guid"`
+	Iteration         int                 `json:"iteration,omitempty"`
+	Executor          string              `json:"executor"`
+	ElevationRequired bool                `json:"elevation_required"`
+	Args              map[string]string   `json:"args"`
+	Stages            []PlanStage         `json:"stages"`
+	Criteria          *AtomicTestCriteria `json:"criteria"`
+	SkipReason        string              `json:"skip_reason,omitempty"` // not run if set
+}
+
+// PlanStage - interpolated command, as goartrun would execute it
+type PlanStage struct {
+	Stage    string `json:"stage"` // checkPrereq0, getPrereq0, test, cleanup
+	Executor string `json:"executor"`
+	Command  string `json:"command"`
+}
+
+// PreflightResult - one test in preflight.json, written with --preflight
+type PreflightResult struct {
+	Id                string         `json:"id"` // AtomicTestCriteria.Id()
+	Technique         string         `json:"technique"`
+	TestIndex         uint           `json:"test_index"`
+	TestName          string         `json:"test_name"`
+	TestGuid          string         `json:"test_guid"`
+	Executor          string         `json:"executor"`
+	ElevationRequired bool           `json:"elevation_required"`
+	IsRunnable        bool           `json:"is_runnable"`
+	Reasons           []string       `json:"reasons,omitempty"` // why not runnable
+	Prereqs           []PrereqResult `json:"prereqs,omitempty"`
+	MissingBinaries   []string       `json:"missing_binaries,omitempty"`
 }
@@ -0,0 +1,29 @@
+package types
+
+import (
+	"regexp"
+)
+
+// SafetyRule - deny pattern, matched against each line of interpolated commands
+type SafetyRule struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// SafetyPolicy - tests whose commands match a deny rule, or modify a
+// protected path, are refused unless run with --unsafe
+type SafetyPolicy struct {
+	DenyRules      []SafetyRule
+	ProtectedPaths []string // path.Match patterns. Suffix "/**" protects everything under dir
+}
+
+// SafetyViolation - which rule refused the test
+type SafetyViolation struct {
+	Rule  string `json:"rule"`  // deny rule name, or "protected_path:<path>"
+	Stage string `json:"stage"` // checkPrereq0, getPrereq0, test, cleanup
+	Line  string `json:"line"`  // command line that matched
+}
+
+func (v SafetyViolation) String() string {
+	return v.Rule + " in " + v.Stage + ": " + v.Line
+}
@@ -0,0 +1,37 @@
+package types
+
+// ServeRunRequest - body of POST /api/runs, see atomic-harness serve
+type ServeRunRequest struct {
+	Tests   []string          `json:"tests,omitempty"`   // test specs, e.g. T1070.004#1
+	Runlist string            `json:"runlist,omitempty"` // path on server, as --runlist
+	Tactic  string            `json:"tactic,omitempty"`
+	Profile string            `json:"profile,omitempty"` // profile in server's --config
+	Flags   map[string]string `json:"flags,omitempty"`   // allowed flags, e.g. timeout, jobs, repeat
+}
+
+type ServeRunState string
+
+const (
+	ServeRunRunning     ServeRunState = "running"
+	ServeRunDone        ServeRunState = "done"
+	ServeRunFailed      ServeRunState = "failed" // harness exited with error
+	ServeRunCancelled   ServeRunState = "cancelled"
+	ServeRunInterrupted ServeRunState = "interrupted" // server exited while running
+)
+
+// ServeRun - run.json in run dir, and response of run API
+type ServeRun struct {
+	Id        string          `json:"id"`
+	State     ServeRunState   `json:"state"`
+	Request   ServeRunRequest `json:"request"`
+	Args      []string        `json:"args"`       // harness command-line
+	StartTime int64           `json:"start_time"` // unix seconds
+	EndTime   int64           `json:"end_time,omitempty"`
+	ExitCode  int             `json:"exit_code"`
+}
+
+// ServeArtifact - entry of GET /api/runs/{id}/artifacts
+type ServeArtifact struct {
+	Path string `json:"path"` // relative to run dir
+	Size int64  `json:"size"`
+}
@@ -21,7 +21,16 @@ type ExpectedEvent struct {
 	FieldChecks []FieldCriteria `json:"field_checks"`
 	IsMaybe     bool            `json:"is_maybe,omitempty"`
 
-	Matches []*SimpleEvent `json:"matches,omitempty"`
+	Matches    []*SimpleEvent `json:"matches,omitempty"`
+	RawMatches []string       `json:"raw_matches,omitempty"` // telemetry tool event of first matches. len(Matches) is the count
+	NearMisses []*NearMiss    `json:"near_misses,omitempty"` // best first
+}
+
+// NearMiss - event that met some, but not all, field checks of an ExpectedEvent
+type NearMiss struct {
+	NumChecksMet int          `json:"num_checks_met"`
+	Event        *SimpleEvent `json:"event"`
+	Raw          string       `json:"raw"` // telemetry tool event
 }
 
 // _C_,Process,Pipe,0,1
@@ -64,6 +73,12 @@ type AtomicTestCriteria struct {
 	Infos    []string          `json:"infos,omitempty"`    // FYI
 	Warnings []string          `json:"warnings,omitempty"` // !!!
 
+	// CFG rows
+	Exclusive           bool `json:"exclusive,omitempty"`     // must not run in parallel with other tests
+	TimeoutSeconds      int  `json:"timeout,omitempty"`       // test stage timeout
+	StageTimeoutSeconds int  `json:"stage_timeout,omitempty"` // prereq, cleanup stage timeout
+	PauseSeconds        *int `json:"pause,omitempty"`         // sleep after test, nil for default
+
 	ExpectedCorrelations []CorrelationRow `json:"exp_correlations,omitempty"`
 }
 
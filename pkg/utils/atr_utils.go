@@ -11,6 +11,8 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"regexp"
 	"runtime"
 	"strings"
 
@@ -48,7 +50,35 @@ func LoadAtomicsTechniqueYaml(tid string, atomicsDir string) (*types.Atomic, err
 		return &technique, nil
 	}
 
-	return nil, fmt.Errorf("missing atomic", tid)
+	return nil, fmt.Errorf("missing atomic %s", tid)
+}
+
+var AtomicsFolderRegex = regexp.MustCompile(`PathToAtomicsFolder(\\|\/)`)
+
+/*
+ * InterpolateWithArgs replaces PathToAtomicsFolder with base, and
+ * #{name} with value of args[name] in atomic test command.
+ */
+func InterpolateWithArgs(interpolatee, base string, args map[string]string) string {
+	interpolated := strings.TrimSpace(interpolatee)
+
+	// replace folder path if present in script
+
+	interpolated = strings.ReplaceAll(interpolated, "$PathToAtomicsFolder", base)
+	interpolated = strings.ReplaceAll(interpolated, "PathToAtomicsFolder", base)
+
+	for k, v := range args {
+		if AtomicsFolderRegex.MatchString(v) {
+			v = AtomicsFolderRegex.ReplaceAllString(v, "")
+			v = strings.ReplaceAll(v, `\`, `/`)
+			v = strings.TrimSuffix(base, "/") + "/" + v
+		}
+
+		v = filepath.FromSlash(v)
+		interpolated = strings.ReplaceAll(interpolated, "#{"+k+"}", v)
+	}
+
+	return interpolated
 }
 
 func GetPlatformName() string {
@@ -99,6 +129,7 @@ func LoadAtomicsIndexCsvPlatform(atomicsPath string, dest *map[string][]*types.T
 		spec.TestIndex = row[3]
 		spec.TestName = row[4]
 		spec.TestGuid = row[5]
+		spec.Tactics = []string{row[0]}
 
 		_, ok := (*dest)[spec.Technique]
 		if !ok {
@@ -112,6 +143,9 @@ func LoadAtomicsIndexCsvPlatform(atomicsPath string, dest *map[string][]*types.T
 		for _, entry := range (*dest)[spec.Technique] {
 			if spec.Technique == entry.Technique && spec.TestGuid == entry.TestGuid {
 				notPresent = false
+				if !StringInList(row[0], entry.Tactics) {
+					entry.Tactics = append(entry.Tactics, row[0])
+				}
 				break
 			}
 		}
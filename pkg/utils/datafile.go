@@ -74,7 +74,7 @@ func ParseFieldCriteria(str string, eventType string) (*types.FieldCriteria, err
 
 func EventFromRow(id int, row []string) types.ExpectedEvent {
 	obj := types.ExpectedEvent{}
-	obj.Id = string(id)
+	obj.Id = fmt.Sprintf("%d", id)
 	obj.EventType = row[1] //strings.ToTitle(strings.ToLower(row[1]))
 	idx := 2
 	ET := strings.ToUpper(obj.EventType)
@@ -111,6 +111,51 @@ func CorrelationFromRow(row []string) types.CorrelationRow {
 	return obj
 }
 
+/*
+ * CFG rows hold per-test settings for the harness
+ * CFG,exclusive,true
+ * CFG,timeout,120
+ * CFG,stagetimeout,60
+ * CFG,pause,0
+ */
+func ApplyConfigRow(criteria *types.AtomicTestCriteria, row []string) error {
+	if len(row) < 2 {
+		return fmt.Errorf("CFG row missing name")
+	}
+	val := ""
+	if len(row) > 2 {
+		val = strings.TrimSpace(row[2])
+	}
+	var err error
+	switch strings.ToLower(strings.TrimSpace(row[1])) {
+	case "exclusive":
+		criteria.Exclusive = val == "" || strings.ToLower(val) == "true" || val == "1"
+	case "timeout":
+		criteria.TimeoutSeconds, err = parseSeconds(val)
+	case "stagetimeout":
+		criteria.StageTimeoutSeconds, err = parseSeconds(val)
+	case "pause":
+		var seconds int
+		if seconds, err = parseSeconds(val); err == nil {
+			criteria.PauseSeconds = &seconds
+		}
+	default:
+		return fmt.Errorf("unknown CFG name: %s", row[1])
+	}
+	if err != nil {
+		return fmt.Errorf("CFG %s value should be seconds: '%s'", row[1], val)
+	}
+	return nil
+}
+
+func parseSeconds(val string) (int, error) {
+	seconds, err := strconv.Atoi(val)
+	if err == nil && seconds < 0 {
+		err = fmt.Errorf("negative")
+	}
+	return seconds, err
+}
+
 /*
  * loads CSV containing rows of TechniqueId,TacticId,Name
  * Populates dest with TechniqueId-Name
@@ -142,6 +187,60 @@ func LoadMitreTechniqueCsv(path string, dest *map[string]string) error {
 	return nil
 }
 
+/*
+ * loads tactics from same CSV as LoadMitreTechniqueCsv. Tactic rows
+ * have an empty first column: ,TacticId,ShortName,Name
+ * Technique rows that follow are added to the tactic with their TacticId.
+ * @return tactics in order of file
+ */
+func LoadMitreTacticCsv(path string) ([]*types.MitreTactic, error) {
+	data, err := ioutil.ReadFile(filepath.FromSlash(path))
+	if err != nil {
+		return nil, err
+	}
+
+	r := csv.NewReader(bytes.NewReader(data))
+	r.LazyQuotes = true
+	r.FieldsPerRecord = -1 // no validation on num columns per row
+
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	tactics := []*types.MitreTactic{}
+	byId := map[string]*types.MitreTactic{}
+
+	for _, row := range records {
+		if len(row) < 3 || strings.HasPrefix(row[0], "#") {
+			continue
+		}
+		if len(row[0]) == 0 {
+			if len(row) < 4 || !strings.HasPrefix(row[1], "TA") {
+				continue
+			}
+			tactic := &types.MitreTactic{Id: row[1], ShortName: row[2], Name: row[3]}
+			tactics = append(tactics, tactic)
+			byId[tactic.Id] = tactic
+			continue
+		}
+		tactic, ok := byId[row[1]]
+		if ok && !StringInList(row[0], tactic.Techniques) {
+			tactic.Techniques = append(tactic.Techniques, row[0])
+		}
+	}
+	return tactics, nil
+}
+
+func StringInList(val string, list []string) bool {
+	for _, entry := range list {
+		if entry == val {
+			return true
+		}
+	}
+	return false
+}
+
 func LoadAtomicDefaultArgs(criteria *types.AtomicTestCriteria, flagAtomicsPath string, isVerbose bool) {
 	var body []byte
 
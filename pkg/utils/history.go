@@ -0,0 +1,132 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+)
+
+/*
+ * Run history store: a dir with two append-only json-lines files.
+ * tests.jsonl has a HistoryTest per test result, and runs.jsonl a
+ * HistoryRun per ingested run, written after its tests, so a partly
+ * written ingest is ignored.  Ingesting a run again supersedes it.
+ */
+
+const kHistoryRunsFileName = "runs.jsonl"
+const kHistoryTestsFileName = "tests.jsonl"
+
+func appendJsonLines(path string, objs []interface{}) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	for _, obj := range objs {
+		data, err := json.Marshal(obj)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		w.Write(append(data, '\n'))
+	}
+	if err = w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// AppendHistory adds run and its tests to history dir, creating it if needed
+func AppendHistory(dir string, run *types.HistoryRun, tests []*types.HistoryTest) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	objs := []interface{}{}
+	for _, test := range tests {
+		test.ResultsDir = run.ResultsDir
+		test.IngestTime = run.IngestTime
+		objs = append(objs, test)
+	}
+	if err := appendJsonLines(filepath.Join(dir, kHistoryTestsFileName), objs); err != nil {
+		return err
+	}
+	return appendJsonLines(filepath.Join(dir, kHistoryRunsFileName), []interface{}{run})
+}
+
+// calls fn with each line of file, skipping lines that don't parse
+func readJsonLines(path string, fn func(data []byte)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) > 0 {
+			fn(scanner.Bytes())
+		}
+	}
+	return scanner.Err()
+}
+
+/*
+ * LoadHistory returns runs in history dir ordered by start time, and
+ * their tests in the same order.  Empty if dir doesn't exist.
+ */
+func LoadHistory(dir string) ([]*types.HistoryRun, []*types.HistoryTest, error) {
+	latest := map[string]*types.HistoryRun{}
+	err := readJsonLines(filepath.Join(dir, kHistoryRunsFileName), func(data []byte) {
+		run := &types.HistoryRun{}
+		if json.Unmarshal(data, run) != nil {
+			return
+		}
+		if prev, ok := latest[run.ResultsDir]; !ok || run.IngestTime >= prev.IngestTime {
+			latest[run.ResultsDir] = run
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	runs := []*types.HistoryRun{}
+	for _, run := range latest {
+		runs = append(runs, run)
+	}
+	sort.SliceStable(runs, func(i, j int) bool {
+		if runs[i].StartTime != runs[j].StartTime {
+			return runs[i].StartTime < runs[j].StartTime
+		}
+		return runs[i].ResultsDir < runs[j].ResultsDir
+	})
+	runIndex := map[string]int{}
+	for i, run := range runs {
+		runIndex[run.ResultsDir] = i
+	}
+
+	tests := []*types.HistoryTest{}
+	err = readJsonLines(filepath.Join(dir, kHistoryTestsFileName), func(data []byte) {
+		test := &types.HistoryTest{}
+		if json.Unmarshal(data, test) != nil {
+			return
+		}
+		if run, ok := latest[test.ResultsDir]; ok && run.IngestTime == test.IngestTime {
+			tests = append(tests, test)
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.SliceStable(tests, func(i, j int) bool {
+		return runIndex[tests[i].ResultsDir] < runIndex[tests[j].ResultsDir]
+	})
+	return runs, tests, nil
+}
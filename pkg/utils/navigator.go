@@ -0,0 +1,68 @@
+package utils
+
+import (
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+)
+
+/*
+ * NewNavigatorLayer returns an enterprise layer with a red to green
+ * gradient for scores 0 to 100.  platform is linux, macos or windows,
+ * or empty to not filter.
+ */
+func NewNavigatorLayer(name string, description string, platform string) *types.NavigatorLayer {
+	layer := &types.NavigatorLayer{Name: name, Description: description, Domain: "enterprise-attack"}
+	layer.Versions = types.NavigatorVersions{Layer: "4.5", Navigator: "4.9.1"}
+	layer.Gradient = types.NavigatorGradient{Colors: []string{"#ff6666", "#ffe766", "#8ec843"}, MinValue: 0, MaxValue: 100}
+	layer.Techniques = []*types.NavigatorTechnique{}
+	switch strings.ToLower(platform) {
+	case "linux":
+		layer.Filters = &types.NavigatorFilters{Platforms: []string{"Linux"}}
+	case "macos":
+		layer.Filters = &types.NavigatorFilters{Platforms: []string{"macOS"}}
+	case "windows":
+		layer.Filters = &types.NavigatorFilters{Platforms: []string{"Windows"}}
+	}
+	return layer
+}
+
+/*
+ * AddNavigatorTechnique adds technique to layer, or sets score and comment
+ * if present.  score < 0 leaves it uncolored.  Parent of a sub-technique
+ * is added if needed, with sub-techniques shown.
+ */
+func AddNavigatorTechnique(layer *types.NavigatorLayer, techniqueId string, score int, comment string) {
+	obj := getNavigatorTechnique(layer, techniqueId)
+	obj.Comment = comment
+	if score >= 0 {
+		obj.Score = &score
+	}
+	if i := strings.Index(techniqueId, "."); i > 0 {
+		getNavigatorTechnique(layer, techniqueId[:i]).ShowSubtechniques = true
+	}
+}
+
+func getNavigatorTechnique(layer *types.NavigatorLayer, techniqueId string) *types.NavigatorTechnique {
+	for _, obj := range layer.Techniques {
+		if obj.TechniqueId == techniqueId {
+			return obj
+		}
+	}
+	obj := &types.NavigatorTechnique{TechniqueId: techniqueId, Enabled: true}
+	layer.Techniques = append(layer.Techniques, obj)
+	return obj
+}
+
+// SaveNavigatorLayer writes layer to path, with techniques sorted by id
+func SaveNavigatorLayer(path string, layer *types.NavigatorLayer) error {
+	sort.SliceStable(layer.Techniques, func(i, j int) bool { return layer.Techniques[i].TechniqueId < layer.Techniques[j].TechniqueId })
+	data, err := json.MarshalIndent(layer, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
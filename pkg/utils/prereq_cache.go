@@ -0,0 +1,188 @@
+package utils
+
+/*
+ * Offline prereq cache: files downloaded by get_prereq_command are fetched
+ * beforehand on a connected machine (atrutil --prereqcache), and served
+ * to the test from a local http server, with urls in the command rewritten.
+ * Layout of cache dir:
+ *   index.json                     url -> entry
+ *   files/<sha256[:16]>/<basename> file content, basename of url path
+ */
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+)
+
+const kPrereqCacheIndexName = "index.json"
+const kPrereqDownloadTimeout = 5 * time.Minute
+
+var prereqUrlRegex = regexp.MustCompile(`https?://[^\s'"<>|;()]+`)
+
+// LoadPrereqCacheIndex reads index.json of dir. Returns empty index if dir has none.
+func LoadPrereqCacheIndex(dir string) (*types.PrereqCacheIndex, error) {
+	index := &types.PrereqCacheIndex{Entries: map[string]*types.PrereqCacheEntry{}}
+	data, err := os.ReadFile(filepath.Join(dir, kPrereqCacheIndexName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return index, nil
+		}
+		return nil, err
+	}
+	err = json.Unmarshal(data, index)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", kPrereqCacheIndexName, err)
+	}
+	if index.Entries == nil {
+		index.Entries = map[string]*types.PrereqCacheEntry{}
+	}
+	return index, nil
+}
+
+func SavePrereqCacheIndex(dir string, index *types.PrereqCacheIndex) error {
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, kPrereqCacheIndexName), data, 0644)
+}
+
+/*
+ * AddToPrereqCache downloads rawUrl into dir and adds it to index.
+ * Caller saves index.
+ */
+func AddToPrereqCache(dir string, index *types.PrereqCacheIndex, rawUrl string) (*types.PrereqCacheEntry, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	name := path.Base(u.Path)
+	if name == "/" || name == "." || len(name) == 0 {
+		name = "index.html"
+	}
+
+	err = os.MkdirAll(filepath.Join(dir, "files"), 0755)
+	if err != nil {
+		return nil, err
+	}
+	tmpFile, err := os.CreateTemp(filepath.Join(dir, "files"), ".download-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+
+	client := &http.Client{Timeout: kPrereqDownloadTimeout}
+	resp, err := client.Get(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: %s", rawUrl, resp.Status)
+	}
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmpFile, hash), resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	tmpFile.Close()
+	sum := hex.EncodeToString(hash.Sum(nil))
+
+	entry := &types.PrereqCacheEntry{Url: rawUrl, File: "files/" + sum[:16] + "/" + name, Sha256: sum, Size: size, FetchTime: time.Now().Unix()}
+	dest := filepath.Join(dir, filepath.FromSlash(entry.File))
+	err = os.MkdirAll(filepath.Dir(dest), 0755)
+	if err != nil {
+		return nil, err
+	}
+	err = os.Rename(tmpFile.Name(), dest)
+	if err != nil {
+		return nil, err
+	}
+	os.Chmod(dest, 0644)
+	index.Entries[rawUrl] = entry
+	return entry, nil
+}
+
+// FindPrereqUrls returns http(s) urls in command, without duplicates
+func FindPrereqUrls(command string) []string {
+	ret := []string{}
+	for _, u := range prereqUrlRegex.FindAllString(command, -1) {
+		u = strings.TrimRight(u, ".,`")
+		if !StringInList(u, ret) {
+			ret = append(ret, u)
+		}
+	}
+	return ret
+}
+
+/*
+ * ServePrereqCache serves files of cache dir on a local port.
+ * Returns base url, e.g. http://127.0.0.1:40123, and func to stop server.
+ */
+func ServePrereqCache(dir string) (string, func(), error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/files/", http.FileServer(http.Dir(dir)))
+	server := &http.Server{Handler: mux}
+	go server.Serve(listener)
+	return "http://" + listener.Addr().String(), func() { server.Close() }, nil
+}
+
+/*
+ * RewritePrereqUrls replaces urls in command that are in index with url of
+ * file on local server at baseUrl.  Returns new command and a lookup per url
+ * found, sorted by url.
+ */
+func RewritePrereqUrls(command string, index *types.PrereqCacheIndex, baseUrl string) (string, []types.PrereqCacheLookup) {
+	lookups := []types.PrereqCacheLookup{}
+	urls := FindPrereqUrls(command)
+	sort.Strings(urls)
+	// longest first, so a url that is a prefix of another isn't replaced within it
+	replaceOrder := append([]string{}, urls...)
+	sort.SliceStable(replaceOrder, func(i, j int) bool { return len(replaceOrder[i]) > len(replaceOrder[j]) })
+
+	replacements := map[string]string{}
+	for _, u := range urls {
+		lookup := types.PrereqCacheLookup{Url: u}
+		if entry, ok := index.Entries[u]; ok {
+			lookup.IsHit = true
+			lookup.File = entry.File
+			replacements[u] = baseUrl + "/" + entry.File
+		}
+		lookups = append(lookups, lookup)
+	}
+
+	// replace with placeholders first, so replaced text isn't matched again
+	for i, u := range replaceOrder {
+		if _, ok := replacements[u]; ok {
+			command = strings.ReplaceAll(command, u, fmt.Sprintf("\x00%d\x00", i))
+		}
+	}
+	for i, u := range replaceOrder {
+		if r, ok := replacements[u]; ok {
+			command = strings.ReplaceAll(command, fmt.Sprintf("\x00%d\x00", i), r)
+		}
+	}
+	return command, lookups
+}
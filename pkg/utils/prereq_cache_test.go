@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+)
+
+func TestFindPrereqUrls(t *testing.T) {
+	cmd := "wget -O /tmp/x 'https://github.com/a/b/raw/x.zip'; curl http://example.com/y.sh | sh\nInvoke-WebRequest \"https://github.com/a/b/raw/x.zip\" -OutFile (Join-Path $env:TEMP x.zip)"
+	assert.Equal(t, []string{"https://github.com/a/b/raw/x.zip", "http://example.com/y.sh"}, FindPrereqUrls(cmd))
+}
+
+func TestPrereqCache(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/tools/tool.sh" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("echo tool"))
+	}))
+	defer origin.Close()
+
+	dir := t.TempDir()
+	index, err := LoadPrereqCacheIndex(dir)
+	assert.Nil(t, err)
+
+	entry, err := AddToPrereqCache(dir, index, origin.URL+"/tools/tool.sh")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(9), entry.Size)
+	assert.Equal(t, "files/"+entry.Sha256[:16]+"/tool.sh", entry.File)
+	_, err = AddToPrereqCache(dir, index, origin.URL+"/missing")
+	assert.NotNil(t, err)
+
+	assert.Nil(t, SavePrereqCacheIndex(dir, index))
+	index, err = LoadPrereqCacheIndex(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(index.Entries))
+
+	baseUrl, stop, err := ServePrereqCache(dir)
+	assert.Nil(t, err)
+	defer stop()
+
+	cmd := "curl -o /tmp/tool.sh " + origin.URL + "/tools/tool.sh && curl -o /tmp/other https://example.com/other"
+	rewritten, lookups := RewritePrereqUrls(cmd, index, baseUrl)
+	assert.Equal(t, "curl -o /tmp/tool.sh "+baseUrl+"/"+entry.File+" && curl -o /tmp/other https://example.com/other", rewritten)
+	assert.Equal(t, []types.PrereqCacheLookup{
+		{Url: origin.URL + "/tools/tool.sh", IsHit: true, File: entry.File},
+		{Url: "https://example.com/other"},
+	}, lookups)
+
+	resp, err := http.Get(baseUrl + "/" + entry.File)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "echo tool", string(body))
+}
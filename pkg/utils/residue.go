@@ -0,0 +1,284 @@
+package utils
+
+/*
+ * Residue check: snapshot host state before a test and after cleanup,
+ * and report artifacts left behind.  Checks files under paths of test
+ * args and criteria, crontabs, systemd units, launchd plists, users and
+ * listening sockets.  Unreadable items are ignored.
+ */
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+)
+
+const kMaxResidueFilesPerPath = 2000
+const kMaxResidueHashSize = 1 << 20
+
+var crontabDirs = []string{"/etc/crontab", "/etc/cron.d", "/etc/cron.hourly", "/etc/cron.daily", "/etc/cron.weekly",
+	"/etc/cron.monthly", "/var/spool/cron", "/usr/lib/cron/tabs"}
+var systemdDirs = []string{"/etc/systemd/system", "/run/systemd/system", "/lib/systemd/system", "/usr/lib/systemd/system"}
+var launchdDirs = []string{"/Library/LaunchDaemons", "/Library/LaunchAgents"}
+
+var errTooManyFiles = errors.New("too many files")
+
+// not walked, even if referenced by args. Large or busy dirs would hit
+// kMaxResidueFilesPerPath and report changes made by other processes.
+var residueSkipDirs = []string{"/", "/proc", "/sys", "/dev", "/tmp", "/var/tmp", "/private/tmp", "/run", "/var",
+	"/var/log", "/etc", "/home", "/Users", "/root", "/usr", "/usr/bin", "/usr/sbin", "/usr/lib", "/usr/local",
+	"/usr/local/bin", "/bin", "/sbin", "/lib", "/lib64", "/opt"}
+
+// working dirs of runners start with this. Never recorded, since other
+// tests may be running in parallel
+const kRunnerTempDirPrefix = "artwork-"
+
+/*
+ * GetResiduePaths returns args values and extra paths that are absolute
+ * paths or start with ~ or $HOME, expanded and without duplicates.
+ */
+func GetResiduePaths(args map[string]string, extra []string) []string {
+	vals := []string{}
+	for _, val := range args {
+		vals = append(vals, val)
+	}
+	sort.Strings(vals)
+	vals = append(vals, extra...)
+
+	home, _ := os.UserHomeDir()
+	ret := []string{}
+	for _, val := range vals {
+		val = strings.TrimSpace(val)
+		if strings.HasPrefix(val, "~") {
+			val = home + val[1:]
+		} else if strings.HasPrefix(val, "$HOME") || strings.HasPrefix(val, "${HOME}") {
+			val = os.ExpandEnv(val)
+		}
+		if !filepath.IsAbs(val) || strings.ContainsAny(val, "*?\n") {
+			continue
+		}
+		val = filepath.Clean(val)
+		if StringInList(filepath.ToSlash(val), residueSkipDirs) || val == home || val == filepath.Clean(os.TempDir()) ||
+			StringInList(val, ret) {
+			continue
+		}
+		ret = append(ret, val)
+	}
+	return ret
+}
+
+/*
+ * TakeHostSnapshot records state of files under paths, and of persistence
+ * locations, users and listening sockets.  Files under excludes (e.g. the
+ * results dir) and runner working dirs are not recorded.  If filesOnly,
+ * only files under paths are recorded, as other tests running in parallel
+ * change the host wide items.
+ */
+func TakeHostSnapshot(paths []string, excludes []string, filesOnly bool) *types.HostSnapshot {
+	snap := &types.HostSnapshot{Items: map[string]map[string]string{}}
+	add := func(category string) map[string]string {
+		m := map[string]string{}
+		snap.Items[category] = m
+		return m
+	}
+
+	files := add("file")
+	for _, path := range paths {
+		snapshotFiles(files, path, excludes)
+	}
+	if filesOnly {
+		return snap
+	}
+
+	crontabs := add("crontab")
+	for _, path := range crontabDirs {
+		snapshotFiles(crontabs, path, excludes)
+	}
+
+	systemd := add("systemd")
+	launchd := add("launchd")
+	users := add("user")
+	homes := []string{}
+
+	data, _ := os.ReadFile("/etc/passwd")
+	for _, line := range strings.Split(string(data), "\n") {
+		a := strings.Split(line, ":")
+		if len(a) < 7 || strings.HasPrefix(a[0], "#") {
+			continue
+		}
+		users[a[0]] = strings.Join([]string{a[2], a[3], a[5], a[6]}, ":")
+		if strings.HasPrefix(a[5], "/home/") || strings.HasPrefix(a[5], "/Users/") || a[5] == "/root" {
+			homes = append(homes, a[5])
+		}
+	}
+	if home, err := os.UserHomeDir(); err == nil && !StringInList(home, homes) {
+		homes = append(homes, home)
+	}
+
+	for _, path := range systemdDirs {
+		snapshotFiles(systemd, path, excludes)
+	}
+	for _, path := range launchdDirs {
+		snapshotFiles(launchd, path, excludes)
+	}
+	for _, home := range homes {
+		snapshotFiles(systemd, filepath.Join(home, ".config/systemd/user"), excludes)
+		snapshotFiles(launchd, filepath.Join(home, "Library/LaunchAgents"), excludes)
+	}
+
+	listen := add("listen")
+	for _, proto := range []string{"tcp", "tcp6", "udp", "udp6"} {
+		for _, name := range GetListeningSockets(proto) {
+			listen[name] = ""
+		}
+	}
+	return snap
+}
+
+// DiffHostSnapshots returns items added, removed or modified, sorted by category and name
+func DiffHostSnapshots(before *types.HostSnapshot, after *types.HostSnapshot) []types.ResidueItem {
+	ret := []types.ResidueItem{}
+	for category, afterItems := range after.Items {
+		beforeItems := before.Items[category]
+		for name, val := range afterItems {
+			prev, ok := beforeItems[name]
+			if !ok {
+				ret = append(ret, types.ResidueItem{Category: category, Name: name, Change: "added"})
+			} else if prev != val {
+				ret = append(ret, types.ResidueItem{Category: category, Name: name, Change: "modified"})
+			}
+		}
+		for name := range beforeItems {
+			if _, ok := afterItems[name]; !ok {
+				ret = append(ret, types.ResidueItem{Category: category, Name: name, Change: "removed"})
+			}
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Category != ret[j].Category {
+			return ret[i].Category < ret[j].Category
+		}
+		return ret[i].Name < ret[j].Name
+	})
+	return ret
+}
+
+func isExcludedPath(path string, excludes []string) bool {
+	for _, dir := range excludes {
+		if len(dir) > 0 && (path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))) {
+			return true
+		}
+	}
+	return false
+}
+
+// snapshotFiles adds path, or files under it if dir, up to kMaxResidueFilesPerPath
+func snapshotFiles(items map[string]string, path string, excludes []string) {
+	num := 0
+	filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // unreadable, or path does not exist
+		}
+		if isExcludedPath(p, excludes) || strings.HasPrefix(d.Name(), kRunnerTempDirPrefix) ||
+			(d.IsDir() && p != path && StringInList(filepath.ToSlash(p), residueSkipDirs)) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if num >= kMaxResidueFilesPerPath {
+			return errTooManyFiles
+		}
+		if _, ok := items[p]; ok {
+			return nil // already added by overlapping path
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		items[p] = fileDigest(p, info)
+		num += 1
+		return nil
+	})
+}
+
+// content hash of small regular files, otherwise size and mtime. Includes mode
+func fileDigest(path string, info fs.FileInfo) string {
+	mode := info.Mode()
+	if mode.IsDir() {
+		return mode.String()
+	}
+	if mode&fs.ModeSymlink != 0 {
+		target, _ := os.Readlink(path)
+		return mode.String() + " " + target
+	}
+	if mode.IsRegular() && info.Size() <= kMaxResidueHashSize {
+		if data, err := os.ReadFile(path); err == nil {
+			sum := sha256.Sum256(data)
+			return mode.String() + " " + hex.EncodeToString(sum[:8])
+		}
+	}
+	return fmt.Sprintf("%s %d %d", mode.String(), info.Size(), info.ModTime().UnixNano())
+}
+
+/*
+ * GetListeningSockets returns listening tcp, or bound udp, sockets from
+ * /proc/net/<proto> as "tcp 0.0.0.0:4444".  Empty if not linux.
+ */
+func GetListeningSockets(proto string) []string {
+	data, err := os.ReadFile("/proc/net/" + proto)
+	if err != nil {
+		return nil
+	}
+	ret := []string{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		a := strings.Fields(scanner.Text())
+		if len(a) < 4 || a[0] == "sl" {
+			continue
+		}
+		// 0A is TCP_LISTEN, 07 is TCP_CLOSE, used for unconnected udp
+		if (strings.HasPrefix(proto, "tcp") && a[3] != "0A") || (strings.HasPrefix(proto, "udp") && a[3] != "07") {
+			continue
+		}
+		addr := ParseProcNetAddr(a[1])
+		if len(addr) > 0 {
+			ret = append(ret, proto+" "+addr)
+		}
+	}
+	return ret
+}
+
+// ParseProcNetAddr converts "0100007F:1F90" to "127.0.0.1:8080"
+func ParseProcNetAddr(s string) string {
+	a := strings.Split(s, ":")
+	if len(a) != 2 {
+		return ""
+	}
+	port, err := strconv.ParseUint(a[1], 16, 16)
+	if err != nil {
+		return ""
+	}
+	raw, err := hex.DecodeString(a[0])
+	if err != nil || (len(raw) != 4 && len(raw) != 16) {
+		return ""
+	}
+	// address is in 32-bit words in host (little-endian) order
+	ip := make(net.IP, len(raw))
+	for i := 0; i < len(raw); i += 4 {
+		ip[i], ip[i+1], ip[i+2], ip[i+3] = raw[i+3], raw[i+2], raw[i+1], raw[i]
+	}
+	return net.JoinHostPort(ip.String(), fmt.Sprintf("%d", port))
+}
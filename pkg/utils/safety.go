@@ -0,0 +1,250 @@
+package utils
+
+/*
+ * Safety policy checks on interpolated atomic test commands, before they
+ * are executed.  Used by harness and goartrun.
+ */
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+)
+
+// start of command, e.g. "(^|[\s;&|(])mkfs"
+const kCmdStart = `(^|[\s;&|(])`
+
+var defaultDenyRules = [][2]string{
+	{"no_preserve_root", `--no-preserve-root`},
+	{"make_filesystem", kCmdStart + `mkfs(\.\w+)?(\s|$)`},
+	{"partition_disk", kCmdStart + `(fdisk|sfdisk|parted|wipefs)\s`},
+	{"write_block_device", `(\bof=|>\s*)/dev/(sd|hd|vd|xvd|nvme|mmcblk|disk)\w*`},
+	{"fork_bomb", `:\(\)\s*\{\s*:\s*\|\s*:\s*&\s*\}\s*;\s*:`},
+	{"shutdown_host", `(?i)` + kCmdStart + `(shutdown|reboot|halt|poweroff|stop-computer|restart-computer|init\s+[06]|systemctl\s+(poweroff|reboot|halt))(\s|;|$)`},
+	{"format_drive", `(?i)` + kCmdStart + `format(\.com)?\s+[a-z]:`},
+	{"delete_shadow_copies", `(?i)vssadmin(\.exe)?\s+delete\s+shadows|wmic(\.exe)?\s+shadowcopy\s+delete`},
+}
+
+var defaultProtectedPaths = []string{
+	"/", "/bin", "/boot/**", "/dev", "/etc", "/etc/group", "/etc/passwd", "/etc/shadow", "/etc/sudoers",
+	"/home", "/home/*", "/lib", "/root", "/sbin", "/usr", "/var", "/Users", "/Users/*", "~", "$HOME",
+	"C:/", "C:/Windows", "C:/Windows/System32/**", "C:/Users", "C:/Users/*", "%USERPROFILE%", "$env:USERPROFILE",
+}
+
+// commands that modify or remove all of their path args
+var modifyAllArgsCmds = []string{"rm", "rmdir", "unlink", "shred", "srm", "truncate", "chmod", "chown", "chgrp",
+	"chattr", "mv", "tee", "remove-item", "ri", "del", "erase", "rd"}
+
+// commands that modify their last arg
+var modifyLastArgCmds = []string{"cp", "install", "ln", "rsync", "copy-item", "move-item", "copy", "move"}
+
+// DefaultSafetyPolicy returns built-in deny rules and protected paths
+func DefaultSafetyPolicy() *types.SafetyPolicy {
+	policy := &types.SafetyPolicy{}
+	for _, rule := range defaultDenyRules {
+		policy.DenyRules = append(policy.DenyRules, types.SafetyRule{Name: rule[0], Pattern: regexp.MustCompile(rule[1])})
+	}
+	policy.ProtectedPaths = append(policy.ProtectedPaths, defaultProtectedPaths...)
+	return policy
+}
+
+/*
+ * LoadSafetyPolicyCsv adds rules from csv file to policy.
+ * type,name,value
+ * deny,curl_pipe_shell,curl .*\| *(ba)?sh
+ * protect,,/opt/myapp/**
+ */
+func LoadSafetyPolicyCsv(path string, policy *types.SafetyPolicy) error {
+	data, err := os.ReadFile(filepath.FromSlash(path))
+	if err != nil {
+		return err
+	}
+
+	r := csv.NewReader(bytes.NewReader(data))
+	r.LazyQuotes = true
+	r.FieldsPerRecord = -1 // no validation on num columns per row
+
+	records, err := r.ReadAll()
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	for i, row := range records {
+		if i == 0 {
+			continue // skip header row
+		}
+		if len(row) == 0 || len(row[0]) == 0 || row[0][0] == '#' {
+			continue
+		}
+		if len(row) != 3 {
+			return fmt.Errorf("%s line %d: safety policy row should have 3 columns: %v", path, i+1, row)
+		}
+		switch strings.TrimSpace(row[0]) {
+		case "deny":
+			pattern, err := regexp.Compile(row[2])
+			if err != nil {
+				return fmt.Errorf("%s line %d: %w", path, i+1, err)
+			}
+			policy.DenyRules = append(policy.DenyRules, types.SafetyRule{Name: strings.TrimSpace(row[1]), Pattern: pattern})
+		case "protect":
+			policy.ProtectedPaths = append(policy.ProtectedPaths, strings.TrimSpace(row[2]))
+		default:
+			return fmt.Errorf("%s line %d: unknown rule type %s, should be deny or protect", path, i+1, row[0])
+		}
+	}
+	return nil
+}
+
+/*
+ * CheckCommandSafety checks each line of interpolated command against
+ * deny rules, and against paths modified by common commands and redirects.
+ * @return nil if command does not violate policy
+ */
+func CheckCommandSafety(policy *types.SafetyPolicy, stage string, command string) *types.SafetyViolation {
+	for _, line := range strings.Split(command, "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "::") ||
+			strings.HasPrefix(strings.ToUpper(line), "REM ") {
+			continue
+		}
+		for _, rule := range policy.DenyRules {
+			if rule.Pattern.MatchString(line) {
+				return &types.SafetyViolation{Rule: rule.Name, Stage: stage, Line: line}
+			}
+		}
+		for _, target := range GetModifiedPaths(line) {
+			for _, protected := range policy.ProtectedPaths {
+				if IsProtectedPath(target, protected) {
+					return &types.SafetyViolation{Rule: "protected_path:" + protected, Stage: stage, Line: line}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// CheckStagesSafety returns first violation in stages, or nil
+func CheckStagesSafety(policy *types.SafetyPolicy, stages []types.PlanStage) *types.SafetyViolation {
+	for _, stage := range stages {
+		if v := CheckCommandSafety(policy, stage.Stage, stage.Command); v != nil {
+			return v
+		}
+	}
+	return nil
+}
+
+/*
+ * GetModifiedPaths returns redirect targets, and path args of commands
+ * that remove or modify files, e.g. rm, mv, chmod, sed -i, dd of=.
+ * This is a heuristic on words of the line, not a shell parser.
+ */
+func GetModifiedPaths(line string) []string {
+	ret := []string{}
+	for _, cmd := range splitSimpleCommands(line) {
+		ret = append(ret, cmd.redirects...)
+
+		words := cmd.words
+		if len(words) < 2 {
+			continue
+		}
+
+		verb := strings.ToLower(path.Base(strings.ReplaceAll(words[0], `\`, "/")))
+		verb = strings.TrimSuffix(verb, ".exe")
+		args := []string{}
+		isInPlace := false
+		for _, word := range words[1:] {
+			if strings.HasPrefix(word, "-i") || word == "--in-place" {
+				isInPlace = true
+			}
+			if len(word) > 0 && !strings.HasPrefix(word, "-") {
+				args = append(args, word)
+			}
+		}
+
+		switch {
+		case StringInList(verb, modifyAllArgsCmds) || (verb == "sed" && isInPlace):
+			ret = append(ret, args...)
+		case StringInList(verb, modifyLastArgCmds) && len(args) > 0:
+			ret = append(ret, args[len(args)-1])
+		case verb == "dd":
+			for _, arg := range args {
+				if strings.HasPrefix(arg, "of=") {
+					ret = append(ret, arg[3:])
+				}
+			}
+		case verb == "find" && (StringInList("-delete", words) || StringInList("-exec", words)):
+			for _, word := range words[1:] {
+				if strings.HasPrefix(word, "-") {
+					break
+				}
+				ret = append(ret, word)
+			}
+		}
+	}
+	return ret
+}
+
+// normalize for comparison: forward slashes, lower case, no trailing "/"
+func normalizeSafetyPath(p string) string {
+	p = strings.ToLower(strings.ReplaceAll(p, `\`, "/"))
+	p = strings.ReplaceAll(p, "${home}", "$home")
+	if len(p) == 0 {
+		return p
+	}
+	p = path.Clean(p)
+	if len(p) > 1 {
+		p = strings.TrimSuffix(p, "/")
+	}
+	return p
+}
+
+/*
+ * IsProtectedPath returns true if target matches protected, a path.Match
+ * pattern.  Comparison is case-insensitive.  A protected pattern ending
+ * in "/**" matches the dir and everything under it.
+ */
+func IsProtectedPath(target string, protected string) bool {
+	// "rm -rf /home/*" removes the contents of /home
+	target = strings.TrimSuffix(strings.ReplaceAll(target, `\`, "/"), "*")
+	target = normalizeSafetyPath(target)
+	if strings.HasSuffix(protected, "/**") {
+		dir := normalizeSafetyPath(strings.TrimSuffix(protected, "/**"))
+		return target == dir || strings.HasPrefix(target, dir+"/")
+	}
+	ok, _ := path.Match(normalizeSafetyPath(protected), target)
+	return ok
+}
+
+/*
+ * GetInterpolatedStages returns the commands of each stage of test with
+ * args, as goartrun would run them.  base is the atomics folder.
+ * test.Executor must not be nil.
+ */
+func GetInterpolatedStages(test *types.AtomicTest, base string, args map[string]string) []types.PlanStage {
+	stages := []types.PlanStage{}
+
+	depExecutor := test.DependencyExecutorName
+	if len(depExecutor) == 0 {
+		depExecutor = test.Executor.Name
+	}
+	for i, dep := range test.Dependencies {
+		stages = append(stages, types.PlanStage{Stage: fmt.Sprintf("checkPrereq%d", i), Executor: depExecutor,
+			Command: InterpolateWithArgs(dep.PrereqCommand, base, args)})
+		stages = append(stages, types.PlanStage{Stage: fmt.Sprintf("getPrereq%d", i), Executor: depExecutor,
+			Command: InterpolateWithArgs(dep.GetPrereqCommand, base, args)})
+	}
+	stages = append(stages, types.PlanStage{Stage: "test", Executor: test.Executor.Name,
+		Command: InterpolateWithArgs(test.Executor.Command, base, args)})
+	if len(test.Executor.CleanupCommand) > 0 {
+		stages = append(stages, types.PlanStage{Stage: "cleanup", Executor: test.Executor.Name,
+			Command: InterpolateWithArgs(test.Executor.CleanupCommand, base, args)})
+	}
+	return stages
+}
@@ -0,0 +1,119 @@
+package utils
+
+/*
+ * Word splitting of shell command lines, used by safety policy and
+ * preflight checks.  This is not a shell parser: quoting, subshells and
+ * here-docs are only roughly handled.
+ */
+
+import (
+	"regexp"
+	"strings"
+)
+
+// prefixes that run the next word as the command
+var cmdPrefixes = []string{"sudo", "doas", "nohup", "exec", "command", "env", "time"}
+
+// skipped at start of command, e.g. "then rm -rf /tmp/x"
+var shellKeywords = []string{"if", "then", "else", "elif", "fi", "while", "until", "do", "done", "esac", "!", "{", "}", "[[", "]]"}
+
+// commands whose words are not a command line
+var shellCompoundCmds = []string{"for", "case", "select", "function"}
+
+var shellBuiltins = []string{".", ":", "[", "alias", "bg", "break", "builtin", "cd", "continue", "declare", "disown",
+	"echo", "eval", "exit", "export", "false", "fg", "getopts", "hash", "history", "jobs", "kill", "let", "local",
+	"popd", "printf", "pushd", "read", "readonly", "return", "set", "shift", "shopt", "source", "test", "trap",
+	"true", "type", "typeset", "ulimit", "umask", "unalias", "unset", "wait"}
+
+var cmdSeparatorRegex = regexp.MustCompile(`\|\||&&|[;|&]`)
+var fdDupRegex = regexp.MustCompile(`\d*>&[\d-]+`)
+var redirectRegex = regexp.MustCompile(`\d*>>?\s*([^\s;&|]+)`)
+var envAssignRegex = regexp.MustCompile(`^\w+=`)
+var heredocRegex = regexp.MustCompile(`<<-?\s*['"]?(\w+)['"]?`)
+
+type simpleCommand struct {
+	words     []string // command name first, quotes removed
+	redirects []string // output redirect targets
+}
+
+// splitSimpleCommands splits line on ; && || | & and removes prefixes like sudo
+func splitSimpleCommands(line string) []simpleCommand {
+	ret := []simpleCommand{}
+	line = fdDupRegex.ReplaceAllString(line, " ")
+
+	for _, s := range cmdSeparatorRegex.Split(line, -1) {
+		cmd := simpleCommand{}
+		for _, m := range redirectRegex.FindAllStringSubmatch(s, -1) {
+			cmd.redirects = append(cmd.redirects, strings.Trim(m[1], `"'`))
+		}
+		s = redirectRegex.ReplaceAllString(s, " ")
+
+		for _, word := range strings.Fields(s) {
+			cmd.words = append(cmd.words, strings.Trim(word, `"'()`))
+		}
+		for len(cmd.words) > 0 && (StringInList(cmd.words[0], cmdPrefixes) || StringInList(cmd.words[0], shellKeywords) ||
+			envAssignRegex.MatchString(cmd.words[0])) {
+			cmd.words = cmd.words[1:]
+		}
+		if len(cmd.words) > 0 && StringInList(cmd.words[0], shellCompoundCmds) {
+			cmd.words = nil
+		}
+		ret = append(ret, cmd)
+	}
+	return ret
+}
+
+/*
+ * GetShellLines returns the lines of command, with continuation lines
+ * joined, and without comments and here-doc bodies.
+ */
+func GetShellLines(command string) []string {
+	ret := []string{}
+	heredocEnd := ""
+	cur := ""
+	for _, line := range strings.Split(command, "\n") {
+		line = strings.TrimSpace(line)
+		if len(heredocEnd) > 0 {
+			if line == heredocEnd {
+				heredocEnd = ""
+			}
+			continue
+		}
+		if strings.HasSuffix(line, `\`) {
+			cur += strings.TrimSuffix(line, `\`) + " "
+			continue
+		}
+		line = cur + line
+		cur = ""
+		if m := heredocRegex.FindStringSubmatch(line); m != nil {
+			heredocEnd = m[1]
+		}
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ret = append(ret, line)
+	}
+	return ret
+}
+
+/*
+ * GetCommandNames returns the programs run by sh/bash command, without
+ * builtins, and skipping names with variables or atomics #{args}.
+ */
+func GetCommandNames(command string) []string {
+	ret := []string{}
+	for _, line := range GetShellLines(command) {
+		for _, cmd := range splitSimpleCommands(line) {
+			if len(cmd.words) == 0 {
+				continue
+			}
+			name := cmd.words[0]
+			if len(name) == 0 || strings.ContainsAny(name, "$#`(){}=<>*?") || StringInList(name, shellBuiltins) ||
+				StringInList(name, shellKeywords) || StringInList(name, ret) {
+				continue
+			}
+			ret = append(ret, name)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,170 @@
+package utils
+
+/*
+ * Loader for MITRE ATT&CK STIX 2 bundle, e.g. enterprise-attack.json from
+ * https://github.com/mitre/cti/tree/master/enterprise-attack
+ */
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	types "github.com/secureworks/atomic-harness/pkg/types"
+)
+
+type stixExternalRef struct {
+	SourceName string `json:"source_name"`
+	ExternalId string `json:"external_id"`
+}
+
+type stixKillChainPhase struct {
+	KillChainName string `json:"kill_chain_name"`
+	PhaseName     string `json:"phase_name"`
+}
+
+// fields of the object types we use: attack-pattern, x-mitre-tactic,
+// x-mitre-matrix and relationship
+type stixObject struct {
+	Type               string               `json:"type"`
+	Id                 string               `json:"id"`
+	Name               string               `json:"name"`
+	ExternalReferences []stixExternalRef    `json:"external_references"`
+	KillChainPhases    []stixKillChainPhase `json:"kill_chain_phases"`
+	Platforms          []string             `json:"x_mitre_platforms"`
+	ShortName          string               `json:"x_mitre_shortname"`
+	Revoked            bool                 `json:"revoked"`
+	Deprecated         bool                 `json:"x_mitre_deprecated"`
+	TacticRefs         []string             `json:"tactic_refs"`
+	RelationshipType   string               `json:"relationship_type"`
+	SourceRef          string               `json:"source_ref"`
+	TargetRef          string               `json:"target_ref"`
+}
+
+type stixBundle struct {
+	Objects []stixObject `json:"objects"`
+}
+
+func (obj *stixObject) MitreId() string {
+	for _, ref := range obj.ExternalReferences {
+		if ref.SourceName == "mitre-attack" {
+			return ref.ExternalId
+		}
+	}
+	return ""
+}
+
+/*
+ * LoadMitreStixBundle loads techniques and tactics from STIX bundle.
+ * All techniques are loaded, including revoked and deprecated, but
+ * the Techniques of each tactic only include active techniques for
+ * platform ("linux", "macos", "windows"). Empty platform means any.
+ */
+func LoadMitreStixBundle(path string, platform string) (*types.MitreAttackData, error) {
+	data, err := os.ReadFile(filepath.FromSlash(path))
+	if err != nil {
+		return nil, err
+	}
+	bundle := &stixBundle{}
+	if err = json.Unmarshal(data, bundle); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	ret := &types.MitreAttackData{}
+	ret.Techniques = map[string]*types.MitreTechnique{}
+
+	techniquesByStixId := map[string]*types.MitreTechnique{}
+	tacticsByStixId := map[string]*types.MitreTactic{}
+	tacticOrder := []string{}
+
+	for i := range bundle.Objects {
+		obj := &bundle.Objects[i]
+		switch obj.Type {
+		case "attack-pattern":
+			tid := obj.MitreId()
+			if len(tid) == 0 {
+				continue
+			}
+			technique := &types.MitreTechnique{Id: tid, Name: obj.Name, Platforms: obj.Platforms}
+			technique.IsRevoked = obj.Revoked
+			technique.IsDeprecated = obj.Deprecated
+			for _, phase := range obj.KillChainPhases {
+				if phase.KillChainName == "mitre-attack" {
+					technique.Tactics = append(technique.Tactics, phase.PhaseName)
+				}
+			}
+			techniquesByStixId[obj.Id] = technique
+
+			// revoked objects can share id with their replacement
+			prev, ok := ret.Techniques[tid]
+			if !ok || prev.IsRevoked || prev.IsDeprecated {
+				ret.Techniques[tid] = technique
+			}
+		case "x-mitre-tactic":
+			tactic := &types.MitreTactic{Id: obj.MitreId(), ShortName: obj.ShortName, Name: obj.Name}
+			tacticsByStixId[obj.Id] = tactic
+			tacticOrder = append(tacticOrder, obj.Id)
+		case "x-mitre-matrix":
+			if len(obj.TacticRefs) > 0 {
+				tacticOrder = obj.TacticRefs
+			}
+		}
+	}
+
+	for i := range bundle.Objects {
+		obj := &bundle.Objects[i]
+		if obj.Type != "relationship" || obj.RelationshipType != "revoked-by" {
+			continue
+		}
+		src, ok := techniquesByStixId[obj.SourceRef]
+		dest, ok2 := techniquesByStixId[obj.TargetRef]
+		if ok && ok2 {
+			src.RevokedBy = dest.Id
+		}
+	}
+
+	tacticsByShortName := map[string]*types.MitreTactic{}
+	for _, stixId := range tacticOrder {
+		tactic, ok := tacticsByStixId[stixId]
+		if !ok || tacticsByShortName[tactic.ShortName] != nil {
+			continue
+		}
+		ret.Tactics = append(ret.Tactics, tactic)
+		tacticsByShortName[tactic.ShortName] = tactic
+	}
+
+	// map order is random, keep techniques of each tactic sorted
+	tids := []string{}
+	for tid := range ret.Techniques {
+		tids = append(tids, tid)
+	}
+	sort.Strings(tids)
+	for _, tid := range tids {
+		technique := ret.Techniques[tid]
+		if technique.IsRevoked || technique.IsDeprecated || !IsForPlatform(technique, platform) {
+			continue
+		}
+		for _, name := range technique.Tactics {
+			if tactic, ok := tacticsByShortName[name]; ok {
+				tactic.Techniques = append(tactic.Techniques, tid)
+			}
+		}
+	}
+	return ret, nil
+}
+
+// platform is "linux", "macos" or "windows". Empty matches any
+func IsForPlatform(technique *types.MitreTechnique, platform string) bool {
+	if len(platform) == 0 {
+		return true
+	}
+	for _, name := range technique.Platforms {
+		if strings.EqualFold(name, platform) {
+			return true
+		}
+	}
+	return false
+}